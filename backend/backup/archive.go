@@ -0,0 +1,234 @@
+// Package backup snapshots the data directory to a tar.gz archive and
+// restores it from one.
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"pauls-bach/store"
+)
+
+// manifestName is the archive's first entry, describing the rest.
+const manifestName = "manifest.json"
+
+type Manifest struct {
+	CreatedAt string `json:"created_at"`
+	// The data files' layout; see store.SchemaVersion
+	SchemaVersion int    `json:"schema_version"`
+	Files         []File `json:"files"`
+}
+
+type File struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// dataFiles lists the files at the top level of dataDir, sorted. Hidden
+// files and subdirectories, such as a backup directory kept inside it,
+// aren't part of the store.
+func dataFiles(dataDir string) ([]string, error) {
+	entries, err := os.ReadDir(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if e.Type().IsRegular() && !strings.HasPrefix(e.Name(), ".") {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// archived reports whether a data file belongs in a backup. Temp files are
+// from writes that never finished, and SQLite's write-ahead log is empty
+// after a checkpoint.
+func archived(name string) bool {
+	return !strings.Contains(name, ".tmp-") &&
+		!strings.HasSuffix(name, "-wal") && !strings.HasSuffix(name, "-shm")
+}
+
+// write archives the store's files in dataDir to w. Nothing may change them
+// until it returns.
+func write(w io.Writer, dataDir string) (*Manifest, error) {
+	version, err := store.ReadSchemaVersion(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	m := &Manifest{
+		CreatedAt:     time.Now().UTC().Format(time.RFC3339),
+		SchemaVersion: version,
+		Files:         []File{},
+	}
+	names, err := dataFiles(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		if !archived(name) {
+			continue
+		}
+		f, err := checksum(filepath.Join(dataDir, name))
+		if err != nil {
+			return nil, err
+		}
+		f.Name = name
+		m.Files = append(m.Files, *f)
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	manifest, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeEntry(tw, manifestName, int64(len(manifest)), bytes.NewReader(manifest)); err != nil {
+		return nil, err
+	}
+	for _, f := range m.Files {
+		file, err := os.Open(filepath.Join(dataDir, f.Name))
+		if err != nil {
+			return nil, err
+		}
+		err = writeEntry(tw, f.Name, f.Size, file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func writeEntry(tw *tar.Writer, name string, size int64, r io.Reader) error {
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    size,
+		ModTime: time.Now(),
+	}); err != nil {
+		return err
+	}
+	_, err := io.CopyN(tw, r, size)
+	return err
+}
+
+func checksum(path string) (*File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return nil, err
+	}
+	return &File{Size: n, SHA256: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+// extract unpacks an archive into dir, which should be empty, and checks
+// it: the manifest must come first and list the required files, every file
+// in it must be there with the right size and checksum, and there must be
+// nothing else.
+func extract(r io.Reader, dir string, required []string) (*Manifest, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not a gzip archive: %w", err)
+	}
+	tr := tar.NewReader(gz)
+
+	hdr, err := tr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("read archive: %w", err)
+	}
+	if hdr.Name != manifestName {
+		return nil, fmt.Errorf("archive doesn't start with %s", manifestName)
+	}
+	var m Manifest
+	if err := json.NewDecoder(io.LimitReader(tr, 1<<20)).Decode(&m); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	if m.SchemaVersion > store.SchemaVersion {
+		return nil, fmt.Errorf("backup has schema version %d but this build only knows up to %d", m.SchemaVersion, store.SchemaVersion)
+	}
+	want := make(map[string]File, len(m.Files))
+	for _, f := range m.Files {
+		if !validName(f.Name) {
+			return nil, fmt.Errorf("manifest lists invalid file name %q", f.Name)
+		}
+		want[f.Name] = f
+	}
+	for _, name := range required {
+		if _, ok := want[name]; !ok {
+			return nil, fmt.Errorf("backup has no %s", name)
+		}
+	}
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("read archive: %w", err)
+		}
+		f, ok := want[hdr.Name]
+		if !ok {
+			return nil, fmt.Errorf("archive has %q, which the manifest doesn't list", hdr.Name)
+		}
+		delete(want, hdr.Name)
+		if hdr.Typeflag != tar.TypeReg || hdr.Size != f.Size {
+			return nil, fmt.Errorf("%s: not a %d byte file", f.Name, f.Size)
+		}
+		if err := extractFile(tr, filepath.Join(dir, f.Name), f); err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+	}
+	for _, f := range m.Files {
+		if _, missing := want[f.Name]; missing {
+			return nil, fmt.Errorf("archive is missing %s", f.Name)
+		}
+	}
+	return &m, nil
+}
+
+func extractFile(r io.Reader, path string, want File) error {
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	h := sha256.New()
+	if _, err := io.CopyN(io.MultiWriter(out, h), r, want.Size); err != nil {
+		return err
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != want.SHA256 {
+		return fmt.Errorf("checksum mismatch")
+	}
+	return out.Sync()
+}
+
+// validName accepts plain file names, which can't escape the directory
+// they're extracted to.
+func validName(name string) bool {
+	return name != "" && name == filepath.Base(name) && !strings.HasPrefix(name, ".") && name != manifestName
+}
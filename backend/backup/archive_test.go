@@ -0,0 +1,132 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"pauls-bach/store"
+)
+
+type entry struct {
+	name, data string
+}
+
+// archive packs entries after a manifest listing the files in listed, with
+// their checksums, and lets edit change the manifest first.
+func archive(t *testing.T, listed, entries []entry, edit func(*Manifest)) *bytes.Buffer {
+	t.Helper()
+	m := &Manifest{CreatedAt: "2024-01-01T00:00:00Z", SchemaVersion: store.SchemaVersion, Files: []File{}}
+	for _, e := range listed {
+		sum := sha256.Sum256([]byte(e.data))
+		m.Files = append(m.Files, File{Name: e.name, Size: int64(len(e.data)), SHA256: hex.EncodeToString(sum[:])})
+	}
+	if edit != nil {
+		edit(m)
+	}
+	manifest, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	if err := writeEntry(tw, manifestName, int64(len(manifest)), bytes.NewReader(manifest)); err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if err := writeEntry(tw, e.name, int64(len(e.data)), strings.NewReader(e.data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+func TestExtract(t *testing.T) {
+	required, err := store.RequiredFiles("csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files []entry
+	for _, name := range required {
+		files = append(files, entry{name, name + " data\n"})
+	}
+	with := func(extra ...entry) []entry {
+		return append(append([]entry{}, files...), extra...)
+	}
+	without := func(name string) []entry {
+		var kept []entry
+		for _, f := range files {
+			if f.name != name {
+				kept = append(kept, f)
+			}
+		}
+		return kept
+	}
+
+	dir := t.TempDir()
+	m, err := extract(archive(t, files, files, nil), dir, required)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Files) != len(files) {
+		t.Errorf("manifest lists %d files, want %d", len(m.Files), len(files))
+	}
+	for _, f := range files {
+		if data, err := os.ReadFile(filepath.Join(dir, f.name)); err != nil || string(data) != f.data {
+			t.Errorf("%s extracted as %q (%v), want %q", f.name, data, err, f.data)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		archive *bytes.Buffer
+		wantErr string
+	}{
+		{"tampered checksum", archive(t, files, with(), func(m *Manifest) {
+			m.Files[0].SHA256 = strings.Repeat("0", 64)
+		}), "checksum mismatch"},
+		{"unlisted entry", archive(t, files, with(entry{"extra.csv", "x"}), nil), "doesn't list"},
+		{"entry missing", archive(t, with(entry{"extra.csv", "x"}), files, nil), "missing extra.csv"},
+		{"path traversal", archive(t, with(entry{"../escape.csv", "x"}), with(entry{"../escape.csv", "x"}), nil), "invalid file name"},
+		{"absolute path", archive(t, with(entry{"/tmp/escape.csv", "x"}), with(entry{"/tmp/escape.csv", "x"}), nil), "invalid file name"},
+		{"newer schema", archive(t, files, files, func(m *Manifest) {
+			m.SchemaVersion = store.SchemaVersion + 1
+		}), "schema version"},
+		{"no users", archive(t, without("users.csv"), without("users.csv"), nil), "no users.csv"},
+		{"no ledger", archive(t, without("transactions.csv"), without("transactions.csv"), nil), "no transactions.csv"},
+		{"no schema version", archive(t, without("schema_version"), without("schema_version"), nil), "no schema_version"},
+		{"empty", archive(t, nil, nil, nil), "no schema_version"},
+		{"not gzip", bytes.NewBufferString("manifest.json"), "not a gzip archive"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			staging := filepath.Join(dir, "staging")
+			if err := os.Mkdir(staging, 0755); err != nil {
+				t.Fatal(err)
+			}
+			_, err := extract(tt.archive, staging, required)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("extract returned %v, want an error about %q", err, tt.wantErr)
+			}
+			if _, err := os.Stat(filepath.Join(dir, "escape.csv")); err == nil {
+				t.Error("wrote outside the staging directory")
+			}
+		})
+	}
+}
@@ -0,0 +1,244 @@
+package backup
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"pauls-bach/store"
+)
+
+// Manager takes backups of the store in DataDir and restores them. Store is
+// nil when the server isn't running, as for the backup and restore commands.
+type Manager struct {
+	Store   *store.Store
+	Backend string // to reopen the store after a restore; see store.Open
+	DataDir string
+	// Scheduled backups: Run writes one to Dir every Interval and keeps the
+	// newest Keep
+	Dir      string
+	Interval time.Duration
+	Keep     int
+}
+
+// Snapshot writes a backup of the store to w. It holds the write lock only
+// while it reads the files, not while w is written to.
+func (m *Manager) Snapshot(w io.Writer) (*Manifest, error) {
+	var buf bytes.Buffer
+	manifest, err := m.snapshot(&buf)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := buf.WriteTo(w); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+func (m *Manager) snapshot(w io.Writer) (*Manifest, error) {
+	store.WriteLock()
+	defer store.WriteUnlock()
+
+	if m.Store != nil {
+		if err := m.Store.Checkpoint(); err != nil {
+			return nil, fmt.Errorf("checkpoint store: %w", err)
+		}
+	}
+	return write(w, m.DataDir)
+}
+
+// Restore replaces the store's files with the backup read from r. The
+// archive is unpacked and checked against its manifest, which must list
+// the files the backend requires (see store.RequiredFiles), before anything
+// is touched, so a corrupt, truncated or partial one changes nothing. The files it
+// replaces are kept in a pre-restore directory inside DataDir.
+//
+// The restored store is opened (running any migrations it needs) before
+// Restore returns, and put in place of Store. If it can't be opened the
+// old files are put back.
+func (m *Manager) Restore(r io.Reader) (*Manifest, error) {
+	required, err := store.RequiredFiles(m.Backend)
+	if err != nil {
+		return nil, err
+	}
+	staging, err := os.MkdirTemp(m.DataDir, ".restore-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(staging)
+	manifest, err := extract(r, staging, required)
+	if err != nil {
+		return nil, fmt.Errorf("invalid backup: %w", err)
+	}
+
+	store.WriteLock()
+	defer store.WriteUnlock()
+
+	if m.Store != nil {
+		if err := m.Store.Close(); err != nil {
+			return nil, err
+		}
+	}
+	saved := filepath.Join(m.DataDir, "pre-restore-"+time.Now().Format("20060102-150405"))
+	undo, err := swap(m.DataDir, staging, saved)
+	if err == nil {
+		err = m.reopen()
+	}
+	if err != nil {
+		if undoErr := undo(); undoErr != nil {
+			return nil, fmt.Errorf("%w; putting the old files back also failed, they are in %s: %v", err, saved, undoErr)
+		}
+		if reopenErr := m.reopen(); reopenErr != nil {
+			return nil, fmt.Errorf("%w; reopening the old store also failed: %v", err, reopenErr)
+		}
+		return nil, err
+	}
+	log.Printf("backup: restored backup from %s; the replaced files are in %s", manifest.CreatedAt, saved)
+	return manifest, nil
+}
+
+// reopen opens the store in DataDir, as the server does at startup, and
+// puts it in place of Store, which everything else holds a pointer to.
+// Without a Store it just checks that the store opens.
+func (m *Manager) reopen() error {
+	s, err := store.Open(m.Backend, m.DataDir)
+	if err != nil {
+		return err
+	}
+	if _, err := s.RebuildBalances(); err != nil {
+		s.Close()
+		return err
+	}
+	if m.Store == nil {
+		return s.Close()
+	}
+	*m.Store = *s
+	return nil
+}
+
+// swap moves the files in dataDir to saved and the ones in staging to
+// dataDir. undo puts back whatever it moved, even if it failed part way.
+func swap(dataDir, staging, saved string) (undo func() error, err error) {
+	var out, in []string
+	undo = func() error {
+		var firstErr error
+		keep := func(err error) {
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+		for _, name := range in {
+			keep(os.Remove(filepath.Join(dataDir, name)))
+		}
+		for _, name := range out {
+			keep(os.Rename(filepath.Join(saved, name), filepath.Join(dataDir, name)))
+		}
+		if firstErr == nil {
+			keep(os.Remove(saved))
+		}
+		keep(syncDir(dataDir))
+		return firstErr
+	}
+
+	if err := os.Mkdir(saved, 0755); err != nil {
+		return func() error { return nil }, err
+	}
+	current, err := dataFiles(dataDir)
+	if err != nil {
+		return undo, err
+	}
+	for _, name := range current {
+		if err := os.Rename(filepath.Join(dataDir, name), filepath.Join(saved, name)); err != nil {
+			return undo, err
+		}
+		out = append(out, name)
+	}
+	restored, err := dataFiles(staging)
+	if err != nil {
+		return undo, err
+	}
+	for _, name := range restored {
+		if err := os.Rename(filepath.Join(staging, name), filepath.Join(dataDir, name)); err != nil {
+			return undo, err
+		}
+		in = append(in, name)
+	}
+	return undo, syncDir(dataDir)
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// backupPrefix starts the names of the files Run writes, which are followed
+// by the time, so they sort oldest first.
+const backupPrefix = "pauls-bach-"
+
+// Run writes a backup to Dir every Interval, forever; call it in its own
+// goroutine.
+func (m *Manager) Run() {
+	for range time.Tick(m.Interval) {
+		path, err := m.WriteFile()
+		if err != nil {
+			log.Printf("backup: %v", err)
+			continue
+		}
+		log.Printf("backup: wrote %s", path)
+	}
+}
+
+// WriteFile writes a backup into Dir, then deletes all but the newest Keep
+// there. It returns the new file's path.
+func (m *Manager) WriteFile() (string, error) {
+	if err := os.MkdirAll(m.Dir, 0755); err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if _, err := m.snapshot(&buf); err != nil {
+		return "", err
+	}
+	path := filepath.Join(m.Dir, backupPrefix+time.Now().Format("20060102-150405")+".tar.gz")
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return "", err
+	}
+	return path, m.prune()
+}
+
+func (m *Manager) prune() error {
+	if m.Keep <= 0 {
+		return nil
+	}
+	entries, err := os.ReadDir(m.Dir)
+	if err != nil {
+		return err
+	}
+	var backups []string
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), backupPrefix) && strings.HasSuffix(e.Name(), ".tar.gz") {
+			backups = append(backups, e.Name())
+		}
+	}
+	sort.Strings(backups)
+	for len(backups) > m.Keep {
+		if err := os.Remove(filepath.Join(m.Dir, backups[0])); err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
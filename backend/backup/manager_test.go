@@ -0,0 +1,121 @@
+package backup
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"pauls-bach/models"
+	"pauls-bach/store"
+)
+
+func addUser(t *testing.T, s *store.Store, name string) {
+	t.Helper()
+	u := &models.User{Username: name}
+	if err := s.Users.Create(u); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Post(&models.Transaction{UserID: u.ID, TxType: "grant", Points: models.StartingBalance}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func usernames(t *testing.T, s *store.Store) string {
+	t.Helper()
+	users, err := s.Users.GetAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, u := range users {
+		names = append(names, u.Username)
+	}
+	return strings.Join(names, " ")
+}
+
+// A backup restored over later changes brings the store back to where it
+// was, and keeps what it replaced.
+func TestRestoreRoundTrip(t *testing.T) {
+	for _, backend := range []string{"csv", "sqlite"} {
+		t.Run(backend, func(t *testing.T) {
+			dir := t.TempDir()
+			s, err := store.Open(backend, dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { s.Close() })
+			m := &Manager{Store: s, Backend: backend, DataDir: dir}
+			addUser(t, s, "alice")
+
+			var backup bytes.Buffer
+			if _, err := m.Snapshot(&backup); err != nil {
+				t.Fatal(err)
+			}
+			addUser(t, s, "bob")
+
+			manifest, err := m.Restore(&backup)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(manifest.Files) == 0 {
+				t.Error("manifest lists no files")
+			}
+			if got := usernames(t, s); got != "alice" {
+				t.Errorf("users %q after the restore, want alice", got)
+			}
+			u, err := s.Users.GetByUsername("alice")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if u.Balance != models.StartingBalance {
+				t.Errorf("alice's balance %d, want %d", u.Balance, models.StartingBalance)
+			}
+			// The store still takes writes
+			addUser(t, s, "carol")
+
+			saved, _ := filepath.Glob(filepath.Join(dir, "pre-restore-*"))
+			if len(saved) != 1 {
+				t.Fatalf("pre-restore directories %v, want one", saved)
+			}
+			reopened, err := store.OpenReadOnly(backend, saved[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reopened.Close()
+			if got := usernames(t, reopened); got != "alice bob" {
+				t.Errorf("users %q in the replaced files, want alice bob", got)
+			}
+		})
+	}
+}
+
+// A backup missing the store's data is refused and changes nothing.
+func TestRestoreRejectsPartialBackup(t *testing.T) {
+	dir := t.TempDir()
+	s, err := store.Open("csv", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	m := &Manager{Store: s, Backend: "csv", DataDir: dir}
+	addUser(t, s, "admin")
+
+	files := []entry{{"schema_version", "5\n"}, {"events.csv", "id,title\n"}}
+	if _, err := m.Restore(archive(t, files, files, nil)); err == nil || !strings.Contains(err.Error(), "no users.csv") {
+		t.Fatalf("Restore returned %v, want it to refuse a backup without users.csv", err)
+	}
+	if got := usernames(t, s); got != "admin" {
+		t.Errorf("users %q after the refused restore, want admin", got)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			t.Errorf("%s left in the data directory", e.Name())
+		}
+	}
+}
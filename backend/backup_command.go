@@ -0,0 +1,95 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"pauls-bach/backup"
+	"pauls-bach/config"
+	"pauls-bach/store"
+)
+
+// backupCommand implements "pauls-bach backup [-o FILE]". It works on the
+// data directory directly, so it refuses to run while the server is; use
+// GET /api/admin/backup or scheduled backups then. It opens the store
+// read-only and changes nothing, so it also refuses a data directory the
+// server would have to recover first.
+func backupCommand(cfg *config.Config, args []string) int {
+	flags := flag.NewFlagSet("backup", flag.ExitOnError)
+	out := flags.String("o", "", `file to write (default pauls-bach-<time>.tar.gz; "-" for stdout)`)
+	flags.Parse(args)
+
+	release, err := store.LockDir(cfg.DataDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "backup: %v\n", err)
+		return 1
+	}
+	defer release()
+
+	s, err := store.OpenReadOnly(cfg.StoreBackend, cfg.DataDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "backup: open store: %v\n", err)
+		return 1
+	}
+	defer s.Close()
+	m := &backup.Manager{Store: s, Backend: cfg.StoreBackend, DataDir: cfg.DataDir}
+
+	var w io.Writer = os.Stdout
+	if *out != "-" {
+		if *out == "" {
+			*out = fmt.Sprintf("pauls-bach-%s.tar.gz", time.Now().Format("20060102-150405"))
+		}
+		f, err := os.Create(*out)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "backup: %v\n", err)
+			return 1
+		}
+		defer f.Close()
+		w = f
+	}
+	manifest, err := m.Snapshot(w)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "backup: %v\n", err)
+		return 1
+	}
+	if *out != "-" {
+		fmt.Printf("wrote %s (%d files)\n", *out, len(manifest.Files))
+	}
+	return 0
+}
+
+// restoreCommand implements "pauls-bach restore FILE". Like backupCommand
+// it refuses to run while the server is; use POST /api/admin/restore then.
+func restoreCommand(cfg *config.Config, args []string) int {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: pauls-bach restore FILE")
+		return 2
+	}
+
+	release, err := store.LockDir(cfg.DataDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "restore: %v\n", err)
+		return 1
+	}
+	defer release()
+
+	f, err := os.Open(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "restore: %v\n", err)
+		return 1
+	}
+	defer f.Close()
+	m := &backup.Manager{Backend: cfg.StoreBackend, DataDir: cfg.DataDir}
+	manifest, err := m.Restore(f)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "restore: %v\n", err)
+		return 1
+	}
+	fmt.Printf("restored %d files from the backup taken %s\n", len(manifest.Files), manifest.CreatedAt)
+	return 0
+}
@@ -3,7 +3,12 @@ package config
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"log"
 	"os"
+	"strconv"
+	"time"
+
+	"pauls-bach/models"
 )
 
 type Config struct {
@@ -11,7 +16,30 @@ type Config struct {
 	AdminPIN     string
 	JWTSecret    string
 	DataDir      string
+	StoreBackend string // "csv" or "sqlite"
 	FrontendDist string
+	// Scheduled backups are written to BackupDir, if set, every
+	// BackupInterval; the newest BackupKeep are kept
+	BackupDir      string
+	BackupInterval time.Duration
+	BackupKeep     int
+	// Old odds snapshots are thinned out every OddsCompactInterval: per
+	// minute once they're OddsMinuteAfter old and per hour once they're
+	// OddsHourAfter (0 = the default); see store.OddsRetention
+	OddsMinuteAfter     time.Duration
+	OddsHourAfter       time.Duration
+	OddsCompactInterval time.Duration
+	// Event stream keepalives and caps on open streams (0 = no cap); see
+	// hub.Hub and sse.Handler
+	StreamHeartbeat         time.Duration
+	StreamMaxClients        int
+	StreamMaxClientsPerUser int
+	// Address of the relay that server instances share messages through
+	// (see hub.Relay), and that "pauls-bach relay" listens on; if unset,
+	// the instance runs on its own
+	RelayAddr string
+	// Overrides of the default economic rules, e.g. SELL_PAYOUT=0.6
+	Rules models.EventRules
 }
 
 func Load() *Config {
@@ -20,7 +48,34 @@ func Load() *Config {
 		AdminPIN:     getEnv("ADMIN_PIN", "1234"),
 		JWTSecret:    getEnv("JWT_SECRET", ""),
 		DataDir:      getEnv("DATA_DIR", "./data"),
+		StoreBackend: getEnv("STORE_BACKEND", "csv"),
 		FrontendDist: getEnv("FRONTEND_DIST", "../frontend/dist"),
+		BackupDir:    getEnv("BACKUP_DIR", ""),
+		RelayAddr:    getEnv("RELAY_ADDR", ""),
+	}
+	cfg.BackupInterval = getEnvDuration("BACKUP_INTERVAL", 24*time.Hour)
+	cfg.BackupKeep = 7
+	if n := getEnvInt("BACKUP_KEEP"); n != nil {
+		cfg.BackupKeep = *n
+	}
+	cfg.OddsMinuteAfter = getEnvDuration("ODDS_MINUTE_AFTER", 0)
+	cfg.OddsHourAfter = getEnvDuration("ODDS_HOUR_AFTER", 0)
+	cfg.OddsCompactInterval = getEnvDuration("ODDS_COMPACT_INTERVAL", time.Hour)
+	cfg.StreamHeartbeat = getEnvDuration("STREAM_HEARTBEAT", 25*time.Second)
+	cfg.StreamMaxClients = 1000
+	if n := getEnvInt("STREAM_MAX_CLIENTS"); n != nil {
+		cfg.StreamMaxClients = *n
+	}
+	cfg.StreamMaxClientsPerUser = 8
+	if n := getEnvInt("STREAM_MAX_CLIENTS_PER_USER"); n != nil {
+		cfg.StreamMaxClientsPerUser = *n
+	}
+	cfg.Rules = models.EventRules{
+		SellPayout:    getEnvFloat("SELL_PAYOUT"),
+		WinBonusRate:  getEnvFloat("WIN_BONUS_RATE"),
+		WinBonusFlat:  getEnvInt("WIN_BONUS_FLAT"),
+		BountyPoints:  getEnvInt("BOUNTY_POINTS"),
+		BountyBettors: getEnvInt("BOUNTY_BETTORS"),
 	}
 	if cfg.JWTSecret == "" {
 		b := make([]byte, 32)
@@ -36,3 +91,46 @@ func getEnv(key, fallback string) string {
 	}
 	return fallback
 }
+
+// getEnvFloat returns the variable parsed as a float, or nil if it's unset.
+func getEnvFloat(key string) *float64 {
+	v := os.Getenv(key)
+	if v == "" {
+		return nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		log.Fatalf("%s must be a number: %v", key, err)
+	}
+	return &f
+}
+
+// getEnvInt returns the variable parsed as an int, or nil if it's unset.
+func getEnvInt(key string) *int {
+	v := os.Getenv(key)
+	if v == "" {
+		return nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Fatalf("%s must be a whole number: %v", key, err)
+	}
+	return &n
+}
+
+// getEnvDuration returns the variable parsed as a duration such as "6h", or
+// fallback if it's unset.
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Fatalf("%s must be a duration such as 6h: %v", key, err)
+	}
+	if d <= 0 {
+		log.Fatalf("%s must be positive", key)
+	}
+	return d
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"pauls-bach/config"
+	"pauls-bach/ledger"
+	"pauls-bach/store"
+)
+
+// fsck implements "pauls-bach fsck [-repair] [-json]", which checks the
+// data directory's ledger and exits non-zero if it found problems it didn't
+// repair. It refuses to run while the server is; use the admin ledger
+// endpoints then. Without -repair it opens the store read-only, so it also
+// refuses a data directory the server would have to recover first.
+func fsck(cfg *config.Config, args []string) int {
+	flags := flag.NewFlagSet("fsck", flag.ExitOnError)
+	repair := flags.Bool("repair", false, "rebuild mismatched balances from the ledger, refund stakes on deleted events and delete orphaned records")
+	asJSON := flags.Bool("json", false, "print the report as JSON")
+	flags.Parse(args)
+
+	release, err := store.LockDir(cfg.DataDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fsck: %v\n", err)
+		return 2
+	}
+	defer release()
+
+	open := store.OpenReadOnly
+	if *repair {
+		open = store.Open
+	}
+	s, err := open(cfg.StoreBackend, cfg.DataDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fsck: open store: %v\n", err)
+		return 2
+	}
+	defer s.Close()
+
+	var report *ledger.Report
+	if *repair {
+		store.WriteLock()
+		report, err = ledger.Repair(s)
+		store.WriteUnlock()
+	} else {
+		store.ReadLock()
+		report, err = ledger.Check(s)
+		store.ReadUnlock()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fsck: %v\n", err)
+		return 2
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(report)
+	} else {
+		printReport(report)
+	}
+	if report.OK() || report.Repaired {
+		return 0
+	}
+	return 1
+}
+
+func printReport(r *ledger.Report) {
+	fmt.Printf("checked %d users and %d transactions\n", r.Users, r.Transactions)
+	for _, m := range r.Mismatches {
+		fmt.Printf("user %d (%s): balance %d, ledger adds up to %d (off by %+d)\n",
+			m.UserID, m.Username, m.Balance, m.Expected, m.Balance-m.Expected)
+	}
+	for _, o := range r.Orphans {
+		fmt.Printf("%s %d: event %d does not exist\n", o.Kind, o.ID, o.EventID)
+	}
+	switch {
+	case r.OK():
+		fmt.Println("no problems found")
+	case r.Repaired:
+		for _, f := range r.Refunds {
+			fmt.Printf("refunded user %d %d points staked on deleted event %d\n", f.UserID, f.Points, f.EventID)
+		}
+		fmt.Printf("repaired %d balances and %d orphaned records\n", len(r.Mismatches), len(r.Orphans))
+	default:
+		fmt.Printf("found %d balance mismatches and %d orphaned records; run with -repair to fix them\n", len(r.Mismatches), len(r.Orphans))
+	}
+}
@@ -3,13 +3,18 @@ package handlers
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"net/http"
+	"pauls-bach/hub"
+	"pauls-bach/ledger"
 	"pauls-bach/market"
 	"pauls-bach/middleware"
 	"pauls-bach/models"
-	"pauls-bach/sse"
 	"pauls-bach/store"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 )
@@ -17,18 +22,77 @@ import (
 type AdminHandler struct {
 	Store  *store.Store
 	Engine *market.Engine
-	Broker *sse.Broker
+	Hub    *hub.Hub
 }
 
 type createEventRequest struct {
 	Title       string   `json:"title"`
 	Description string   `json:"description"`
 	EventType   string   `json:"event_type"`
-	Outcomes    []string `json:"outcomes"` // For multi; ignored for binary
+	Outcomes    []string `json:"outcomes"` // For multi; ignored for binary and scalar
+	// Range a scalar event's value resolves in
+	ScalarMin *float64 `json:"scalar_min"`
+	ScalarMax *float64 `json:"scalar_max"`
+	// "pool" (default) or "lmsr"; Liquidity is the LMSR b parameter
+	PricingModel string  `json:"pricing_model"`
+	Liquidity    float64 `json:"liquidity"`
+	ClosesAt     string  `json:"closes_at"` // optional RFC3339; trading locks at this time
+	AllowHedging bool    `json:"allow_hedging"`
+	// Overrides of the server's economic rules; admin only
+	Rules *models.EventRules `json:"rules"`
 }
 
+// resolveRequest takes one of: weights per outcome (e.g. {"3": 70, "5": 30}),
+// a set of winning outcomes that split the payout evenly, or a single winner.
+// Scalar events take the value they resolved at instead.
 type resolveRequest struct {
-	WinningOutcomeID int `json:"winning_outcome_id"`
+	WinningOutcomeID  int             `json:"winning_outcome_id"`
+	WinningOutcomeIDs []int           `json:"winning_outcome_ids"`
+	Weights           map[int]float64 `json:"weights"`
+	Value             *float64        `json:"value"`
+}
+
+func (req *resolveRequest) resolution() []models.ResolutionWeight {
+	var res []models.ResolutionWeight
+	switch {
+	case len(req.Weights) > 0:
+		for outcomeID, w := range req.Weights {
+			res = append(res, models.ResolutionWeight{OutcomeID: outcomeID, Weight: w})
+		}
+		sort.Slice(res, func(i, j int) bool { return res[i].OutcomeID < res[j].OutcomeID })
+	case len(req.WinningOutcomeIDs) > 0:
+		for _, outcomeID := range req.WinningOutcomeIDs {
+			res = append(res, models.ResolutionWeight{OutcomeID: outcomeID, Weight: 1})
+		}
+	case req.WinningOutcomeID != 0:
+		res = []models.ResolutionWeight{{OutcomeID: req.WinningOutcomeID, Weight: 1}}
+	}
+	return res
+}
+
+// resolutionLabel describes the winners, e.g. "Yes", "A & C" or "A 70% / C 30%".
+func resolutionLabel(resolution []models.ResolutionWeight, odds []market.OutcomeOdds) string {
+	labels := make(map[int]string)
+	for _, o := range odds {
+		labels[o.OutcomeID] = o.Label
+	}
+	even := true
+	for _, r := range resolution {
+		if math.Abs(r.Weight-resolution[0].Weight) > 1e-9 {
+			even = false
+		}
+	}
+	parts := make([]string, len(resolution))
+	for i, r := range resolution {
+		parts[i] = labels[r.OutcomeID]
+		if !even {
+			parts[i] += fmt.Sprintf(" %.0f%%", r.Weight*100)
+		}
+	}
+	if even {
+		return strings.Join(parts, " & ")
+	}
+	return strings.Join(parts, " / ")
 }
 
 func (h *AdminHandler) CreateEvent(w http.ResponseWriter, r *http.Request) {
@@ -41,14 +105,74 @@ func (h *AdminHandler) CreateEvent(w http.ResponseWriter, r *http.Request) {
 		jsonError(w, "title is required", http.StatusBadRequest)
 		return
 	}
-	if req.EventType != "binary" && req.EventType != "multi" {
-		jsonError(w, "event_type must be 'binary' or 'multi'", http.StatusBadRequest)
+	if req.EventType != "binary" && req.EventType != "multi" && req.EventType != "scalar" {
+		jsonError(w, "event_type must be 'binary', 'multi' or 'scalar'", http.StatusBadRequest)
 		return
 	}
 	if req.EventType == "multi" && len(req.Outcomes) < 2 {
 		jsonError(w, "multi events need at least 2 outcomes", http.StatusBadRequest)
 		return
 	}
+	var scalarMin, scalarMax float64
+	if req.EventType == "scalar" {
+		if req.ScalarMin == nil || req.ScalarMax == nil {
+			jsonError(w, "scalar events need scalar_min and scalar_max", http.StatusBadRequest)
+			return
+		}
+		scalarMin, scalarMax = *req.ScalarMin, *req.ScalarMax
+		if scalarMax <= scalarMin {
+			jsonError(w, "scalar_max must be greater than scalar_min", http.StatusBadRequest)
+			return
+		}
+	}
+	if req.PricingModel == "" {
+		req.PricingModel = "pool"
+	}
+	if req.PricingModel != "pool" && req.PricingModel != "lmsr" {
+		jsonError(w, "pricing_model must be 'pool' or 'lmsr'", http.StatusBadRequest)
+		return
+	}
+	if req.PricingModel == "lmsr" {
+		// The market maker can lose up to b*ln(outcomes), so only admins set it
+		if isAdmin, _ := r.Context().Value(middleware.IsAdminKey).(bool); !isAdmin {
+			jsonError(w, "only admins can create lmsr events", http.StatusForbidden)
+			return
+		}
+		if req.Liquidity < 0 {
+			jsonError(w, "liquidity must be positive", http.StatusBadRequest)
+			return
+		}
+		if req.Liquidity == 0 {
+			req.Liquidity = market.DefaultLiquidity
+		}
+	} else {
+		req.Liquidity = 0
+	}
+	if req.Rules != nil {
+		if isAdmin, _ := r.Context().Value(middleware.IsAdminKey).(bool); !isAdmin {
+			jsonError(w, "only admins can set event rules", http.StatusForbidden)
+			return
+		}
+	}
+	// Fix the rules at creation so later changes to the defaults don't
+	// move the goalposts on open positions
+	rules := h.Engine.Rules.With(req.Rules)
+	if err := rules.Validate(); err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.ClosesAt != "" {
+		closesAt, err := time.Parse(time.RFC3339, req.ClosesAt)
+		if err != nil {
+			jsonError(w, "closes_at must be an RFC3339 timestamp", http.StatusBadRequest)
+			return
+		}
+		if !closesAt.After(time.Now()) {
+			jsonError(w, "closes_at must be in the future", http.StatusBadRequest)
+			return
+		}
+		req.ClosesAt = closesAt.Format(time.RFC3339)
+	}
 
 	store.WriteLock()
 	defer store.WriteUnlock()
@@ -56,45 +180,65 @@ func (h *AdminHandler) CreateEvent(w http.ResponseWriter, r *http.Request) {
 	creatorID, _ := r.Context().Value(middleware.UserIDKey).(int)
 
 	event := &models.Event{
-		Title:       req.Title,
-		Description: req.Description,
-		EventType:   req.EventType,
-		Status:      "open",
-		CreatorID:   creatorID,
+		Title:        req.Title,
+		Description:  req.Description,
+		EventType:    req.EventType,
+		Status:       "open",
+		CreatorID:    creatorID,
+		PricingModel: req.PricingModel,
+		Liquidity:    req.Liquidity,
+		ClosesAt:     req.ClosesAt,
+		ScalarMin:    scalarMin,
+		ScalarMax:    scalarMax,
+		AllowHedging: req.AllowHedging,
+		Rules:        rules.Snapshot(),
 	}
-	if err := h.Store.Events.Create(event); err != nil {
-		jsonError(w, "failed to create event", http.StatusInternalServerError)
-		return
-	}
-
 	var outcomeLabels []string
-	if req.EventType == "binary" {
+	switch req.EventType {
+	case "binary":
 		outcomeLabels = []string{"Yes", "No"}
-	} else {
+	case "scalar":
+		outcomeLabels = []string{market.ScalarLong, market.ScalarShort}
+	default:
 		outcomeLabels = req.Outcomes
 	}
 
-	for _, label := range outcomeLabels {
-		outcome := &models.Outcome{
-			EventID: event.ID,
-			Label:   label,
+	// An event without its outcomes can't be traded, so write them together
+	err := h.Store.Transact(func(s *store.Store) error {
+		if err := s.Events.Create(event); err != nil {
+			return err
 		}
-		if err := h.Store.Outcomes.Create(outcome); err != nil {
-			jsonError(w, "failed to create outcome", http.StatusInternalServerError)
-			return
+		for _, label := range outcomeLabels {
+			outcome := &models.Outcome{
+				EventID: event.ID,
+				Label:   label,
+			}
+			if err := s.Outcomes.Create(outcome); err != nil {
+				return err
+			}
 		}
+		return nil
+	})
+	if err != nil {
+		jsonError(w, "failed to create event", http.StatusInternalServerError)
+		return
 	}
 
 	odds, _ := h.Engine.GetOdds(event.ID)
 	snapshotOdds(h.Store, event.ID, odds)
 
-	h.Broker.Broadcast(sse.EventEventCreated, map[string]interface{}{
-		"event_id":    event.ID,
-		"title":       event.Title,
-		"description": event.Description,
-		"event_type":  event.EventType,
-		"odds":        odds,
-	})
+	h.Hub.Publish(hub.EventEventCreated, map[string]interface{}{
+		"event_id":      event.ID,
+		"title":         event.Title,
+		"description":   event.Description,
+		"event_type":    event.EventType,
+		"pricing_model": event.PricingModel,
+		"closes_at":     event.ClosesAt,
+		"scalar_min":    event.ScalarMin,
+		"scalar_max":    event.ScalarMax,
+		"allow_hedging": event.AllowHedging,
+		"odds":          odds,
+	}, hub.TopicGlobal, hub.EventTopic(event.ID))
 
 	// Log activity
 	creatorName := "Admin"
@@ -108,7 +252,7 @@ func (h *AdminHandler) CreateEvent(w http.ResponseWriter, r *http.Request) {
 		EventID: event.ID,
 	}
 	h.Store.Activity.Create(entry)
-	h.Broker.Broadcast(sse.EventActivityNew, entry)
+	h.Hub.Broadcast(hub.EventActivityNew, entry)
 
 	jsonResp(w, map[string]interface{}{
 		"event": event,
@@ -157,12 +301,16 @@ func (h *AdminHandler) SetBalance(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req struct {
-		Balance int `json:"balance"`
+		Balance int    `json:"balance"`
+		Reason  string `json:"reason"` // optional, kept in the ledger
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		jsonError(w, "invalid request", http.StatusBadRequest)
 		return
 	}
+	if req.Reason == "" {
+		req.Reason = "balance set by admin"
+	}
 
 	store.WriteLock()
 	defer store.WriteUnlock()
@@ -173,10 +321,17 @@ func (h *AdminHandler) SetBalance(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user.Balance = req.Balance
-	if err := h.Store.Users.Update(user); err != nil {
-		jsonError(w, "failed to update user", http.StatusInternalServerError)
-		return
+	if req.Balance != user.Balance {
+		user, err = h.Store.Post(&models.Transaction{
+			UserID: userID,
+			TxType: "admin_adjust",
+			Points: req.Balance - user.Balance,
+			Reason: req.Reason,
+		})
+		if err != nil {
+			jsonError(w, "failed to update user", http.StatusInternalServerError)
+			return
+		}
 	}
 
 	jsonResp(w, map[string]interface{}{"message": "updated", "balance": user.Balance}, http.StatusOK)
@@ -243,6 +398,9 @@ type updateEventRequest struct {
 		ID    int    `json:"id"`
 		Label string `json:"label"`
 	} `json:"outcomes"`
+	// nil leaves closes_at unchanged; "" clears it
+	ClosesAt     *string `json:"closes_at"`
+	AllowHedging *bool   `json:"allow_hedging"`
 }
 
 func (h *AdminHandler) UpdateEvent(w http.ResponseWriter, r *http.Request) {
@@ -271,8 +429,36 @@ func (h *AdminHandler) UpdateEvent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if len(req.Outcomes) > 0 && event.EventType == "scalar" {
+		jsonError(w, "scalar event outcomes can't be changed", http.StatusBadRequest)
+		return
+	}
+
 	event.Title = req.Title
 	event.Description = req.Description
+	if req.ClosesAt != nil {
+		event.ClosesAt = ""
+		if *req.ClosesAt != "" {
+			closesAt, err := time.Parse(time.RFC3339, *req.ClosesAt)
+			if err != nil {
+				jsonError(w, "closes_at must be an RFC3339 timestamp", http.StatusBadRequest)
+				return
+			}
+			if !closesAt.After(time.Now()) {
+				jsonError(w, "closes_at must be in the future", http.StatusBadRequest)
+				return
+			}
+			event.ClosesAt = closesAt.Format(time.RFC3339)
+		}
+		// Extending or clearing the deadline reopens a closed market
+		if event.Status == "closed" {
+			event.Status = "open"
+		}
+	}
+	// Turning hedging off keeps existing positions but blocks buying another outcome
+	if req.AllowHedging != nil {
+		event.AllowHedging = *req.AllowHedging
+	}
 	if err := h.Store.Events.Update(event); err != nil {
 		jsonError(w, "failed to update event", http.StatusInternalServerError)
 		return
@@ -293,10 +479,10 @@ func (h *AdminHandler) UpdateEvent(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	h.Broker.Broadcast(sse.EventEventCreated, map[string]interface{}{
+	h.Hub.Publish(hub.EventEventCreated, map[string]interface{}{
 		"event_id": event.ID,
 		"title":    event.Title,
-	})
+	}, hub.TopicGlobal, hub.EventTopic(event.ID))
 
 	jsonResp(w, map[string]string{"message": "event updated"}, http.StatusOK)
 }
@@ -311,36 +497,61 @@ func (h *AdminHandler) DeleteEvent(w http.ResponseWriter, r *http.Request) {
 	store.WriteLock()
 	defer store.WriteUnlock()
 
-	if _, err := h.Store.Events.GetByID(eventID); err != nil {
+	event, err := h.Store.Events.GetByID(eventID)
+	if err != nil {
 		jsonError(w, "event not found", http.StatusNotFound)
 		return
 	}
 
-	// Refund any open positions
-	positions, _ := h.Store.Positions.GetByEventID(eventID)
-	for _, p := range positions {
-		user, err := h.Store.Users.GetByID(p.UserID)
-		if err != nil {
-			continue
+	// The event's ledger entries stay, as every entry does
+	err = h.Store.Transact(func(s *store.Store) error {
+		// Refund the stakes of an unresolved event as voiding it would. A
+		// resolved one has already paid out or refunded them
+		if event.Status != "resolved" {
+			txs, err := s.Transactions.GetByEventID(eventID)
+			if err != nil {
+				return err
+			}
+			stakes, userIDs := market.NetStakes(txs)
+			for _, userID := range userIDs {
+				if stakes[userID] <= 0 {
+					continue
+				}
+				if _, err := s.Post(&models.Transaction{
+					UserID:  userID,
+					EventID: eventID,
+					TxType:  "refund",
+					Points:  stakes[userID],
+					Reason:  fmt.Sprintf("'%s' was deleted", event.Title),
+				}); err != nil {
+					return err
+				}
+			}
 		}
-		refund := int(p.Shares)
-		user.Balance += refund
-		h.Store.Users.Update(user)
-	}
 
-	h.Store.Positions.DeleteByEventID(eventID)
-	h.Store.Outcomes.DeleteByEventID(eventID)
-	h.Store.Transactions.DeleteByEventID(eventID)
-	h.Store.OddsSnapshots.DeleteByEventID(eventID)
-	if err := h.Store.Events.Delete(eventID); err != nil {
+		for _, del := range []func(int) error{
+			s.Positions.DeleteByEventID,
+			s.ResolvedPositions.DeleteByEventID,
+			s.Outcomes.DeleteByEventID,
+			s.OddsSnapshots.DeleteByEventID,
+			s.Orders.DeleteByEventID,
+			s.Events.Delete,
+		} {
+			if err := del(eventID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
 		jsonError(w, "failed to delete event", http.StatusInternalServerError)
 		return
 	}
 
-	h.Broker.Broadcast(sse.EventEventResolved, map[string]interface{}{
+	h.Hub.Publish(hub.EventEventResolved, map[string]interface{}{
 		"event_id": eventID,
 		"deleted":  true,
-	})
+	}, hub.TopicGlobal, hub.EventTopic(eventID))
 
 	jsonResp(w, map[string]string{"message": "event deleted"}, http.StatusOK)
 }
@@ -360,23 +571,36 @@ func (h *AdminHandler) UnresolveEvent(w http.ResponseWriter, r *http.Request) {
 		jsonError(w, "event not found", http.StatusNotFound)
 		return
 	}
-	if event.Status != "resolved" {
-		jsonError(w, "event is not resolved", http.StatusBadRequest)
+
+	clawedBack, err := h.Engine.Unresolve(eventID)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	event.Status = "open"
-	event.WinningOutcomeID = 0
-	event.ResolvedAt = ""
-	if err := h.Store.Events.Update(event); err != nil {
-		jsonError(w, "failed to unresolve event", http.StatusInternalServerError)
-		return
+	odds, _ := h.Engine.GetOdds(eventID)
+	snapshotOdds(h.Store, eventID, odds)
+	h.Hub.Publish(hub.EventOddsUpdated, map[string]interface{}{
+		"event_id": eventID,
+		"odds":     odds,
+	}, hub.EventTopic(eventID))
+
+	total := 0
+	for _, pts := range clawedBack {
+		total += pts
 	}
+	entry := &models.ActivityEntry{
+		Type:    "event_unresolved",
+		Message: fmt.Sprintf("'%s' was unresolved — %d pts in payouts reversed", event.Title, total),
+		EventID: eventID,
+	}
+	h.Store.Activity.Create(entry)
+	h.Hub.Broadcast(hub.EventActivityNew, entry)
 
-	h.Broker.Broadcast(sse.EventEventCreated, map[string]interface{}{
+	h.Hub.Publish(hub.EventEventCreated, map[string]interface{}{
 		"event_id": eventID,
 		"title":    event.Title,
-	})
+	}, hub.TopicGlobal, hub.EventTopic(eventID))
 
 	jsonResp(w, map[string]string{"message": "event unresolved"}, http.StatusOK)
 }
@@ -400,7 +624,20 @@ func (h *AdminHandler) ResolveEvent(w http.ResponseWriter, r *http.Request) {
 	// Get event title before resolving (positions get cleaned up during resolve)
 	event, _ := h.Store.Events.GetByID(eventID)
 
-	result, err := h.Engine.Resolve(eventID, req.WinningOutcomeID)
+	var result *market.ResolveResult
+	switch {
+	case event != nil && event.EventType == "scalar":
+		if req.Value == nil {
+			jsonError(w, "scalar events resolve to a value", http.StatusBadRequest)
+			return
+		}
+		result, err = h.Engine.ResolveScalar(eventID, *req.Value)
+	case req.Value != nil:
+		jsonError(w, "only scalar events resolve to a value", http.StatusBadRequest)
+		return
+	default:
+		result, err = h.Engine.Resolve(eventID, req.resolution())
+	}
 	if err != nil {
 		jsonError(w, err.Error(), http.StatusBadRequest)
 		return
@@ -408,14 +645,13 @@ func (h *AdminHandler) ResolveEvent(w http.ResponseWriter, r *http.Request) {
 
 	// Get winner label for broadcast
 	winnerLabel := ""
-	if event != nil {
+	var resolution []models.ResolutionWeight
+	var resolvedValue *float64
+	if resolved, _ := h.Store.Events.GetByID(eventID); resolved != nil {
+		resolution = resolved.Resolution
+		resolvedValue = resolved.ResolvedValue
 		odds, _ := h.Engine.GetOdds(eventID)
-		for _, o := range odds {
-			if o.OutcomeID == req.WinningOutcomeID {
-				winnerLabel = o.Label
-				break
-			}
-		}
+		winnerLabel = resolutionLabel(resolution, odds)
 	}
 
 	// Send personalized notifications to users who held positions
@@ -424,7 +660,7 @@ func (h *AdminHandler) ResolveEvent(w http.ResponseWriter, r *http.Request) {
 		title = event.Title
 	}
 	for _, uo := range result.UserOutcomes {
-		h.Broker.Send(uo.UserID, sse.EventUserResolved, map[string]interface{}{
+		h.Hub.Send(uo.UserID, hub.EventUserResolved, map[string]interface{}{
 			"won":    uo.Won,
 			"payout": uo.Payout,
 			"refund": uo.Refund,
@@ -433,21 +669,26 @@ func (h *AdminHandler) ResolveEvent(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Broadcast generic notification for users without positions
-	h.Broker.Broadcast(sse.EventEventResolved, map[string]interface{}{
-		"event_id":           eventID,
-		"title":              title,
-		"winning_outcome_id": req.WinningOutcomeID,
-		"winner_label":       winnerLabel,
-	})
+	h.Hub.Publish(hub.EventEventResolved, map[string]interface{}{
+		"event_id":       eventID,
+		"title":          title,
+		"resolution":     resolution,
+		"resolved_value": resolvedValue,
+		"winner_label":   winnerLabel,
+	}, hub.TopicGlobal, hub.EventTopic(eventID))
 
 	// Log activity: resolution
+	message := fmt.Sprintf("'%s' resolved — %s wins!", title, winnerLabel)
+	if resolvedValue != nil {
+		message = fmt.Sprintf("'%s' resolved at %s", title, strconv.FormatFloat(*resolvedValue, 'f', -1, 64))
+	}
 	resolveEntry := &models.ActivityEntry{
 		Type:    "event_resolved",
-		Message: fmt.Sprintf("'%s' resolved — %s wins!", title, winnerLabel),
+		Message: message,
 		EventID: eventID,
 	}
 	h.Store.Activity.Create(resolveEntry)
-	h.Broker.Broadcast(sse.EventActivityNew, resolveEntry)
+	h.Hub.Broadcast(hub.EventActivityNew, resolveEntry)
 
 	// Log activity: each winner payout
 	for _, uo := range result.UserOutcomes {
@@ -465,8 +706,89 @@ func (h *AdminHandler) ResolveEvent(w http.ResponseWriter, r *http.Request) {
 			EventID: eventID,
 		}
 		h.Store.Activity.Create(payoutEntry)
-		h.Broker.Broadcast(sse.EventActivityNew, payoutEntry)
+		h.Hub.Broadcast(hub.EventActivityNew, payoutEntry)
 	}
 
 	jsonResp(w, map[string]string{"message": "event resolved"}, http.StatusOK)
 }
+
+func (h *AdminHandler) VoidEvent(w http.ResponseWriter, r *http.Request) {
+	eventID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		jsonError(w, "invalid event id", http.StatusBadRequest)
+		return
+	}
+
+	store.WriteLock()
+	defer store.WriteUnlock()
+
+	event, err := h.Store.Events.GetByID(eventID)
+	if err != nil {
+		jsonError(w, "event not found", http.StatusNotFound)
+		return
+	}
+
+	result, err := h.Engine.Void(eventID)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	for _, uo := range result.UserOutcomes {
+		h.Hub.Send(uo.UserID, hub.EventUserResolved, map[string]interface{}{
+			"won":    uo.Won,
+			"payout": uo.Payout,
+			"refund": uo.Refund,
+			"title":  event.Title,
+		})
+	}
+
+	h.Hub.Publish(hub.EventEventResolved, map[string]interface{}{
+		"event_id": eventID,
+		"title":    event.Title,
+		"voided":   true,
+	}, hub.TopicGlobal, hub.EventTopic(eventID))
+
+	entry := &models.ActivityEntry{
+		Type:    "event_voided",
+		Message: fmt.Sprintf("'%s' was voided — stakes refunded", event.Title),
+		EventID: eventID,
+	}
+	h.Store.Activity.Create(entry)
+	h.Hub.Broadcast(hub.EventActivityNew, entry)
+
+	jsonResp(w, map[string]string{"message": "event voided"}, http.StatusOK)
+}
+
+// CheckLedger reports balances that don't match the users' transactions and
+// records left behind by deleted events.
+func (h *AdminHandler) CheckLedger(w http.ResponseWriter, r *http.Request) {
+	store.ReadLock()
+	defer store.ReadUnlock()
+
+	report, err := ledger.Check(h.Store)
+	if err != nil {
+		jsonError(w, "failed to check ledger", http.StatusInternalServerError)
+		return
+	}
+	jsonResp(w, report, http.StatusOK)
+}
+
+// RepairLedger fixes what CheckLedger reports and returns what it fixed.
+func (h *AdminHandler) RepairLedger(w http.ResponseWriter, r *http.Request) {
+	store.WriteLock()
+	defer store.WriteUnlock()
+
+	report, err := ledger.Repair(h.Store)
+	if err != nil {
+		jsonError(w, "failed to repair ledger", http.StatusInternalServerError)
+		return
+	}
+	jsonResp(w, report, http.StatusOK)
+}
+
+// StreamStats reports the event stream's clients and how many have lagged
+// or been turned away.
+func (h *AdminHandler) StreamStats(w http.ResponseWriter, r *http.Request) {
+	jsonResp(w, h.Hub.Stats(), http.StatusOK)
+}
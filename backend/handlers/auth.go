@@ -3,6 +3,7 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
+	"pauls-bach/hub"
 	"pauls-bach/middleware"
 	"pauls-bach/models"
 	"pauls-bach/store"
@@ -13,6 +14,7 @@ import (
 type AuthHandler struct {
 	Store     *store.Store
 	JWTSecret string
+	Hub       *hub.Hub
 }
 
 type loginRequest struct {
@@ -57,13 +59,29 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	user := &models.User{
 		Username: req.Username,
 		PinHash:  string(hash),
-		Balance:  1000,
 		IsAdmin:  false,
 	}
-	if err := h.Store.Users.Create(user); err != nil {
+	err = h.Store.Transact(func(s *store.Store) error {
+		if err := s.Users.Create(user); err != nil {
+			return err
+		}
+		var err error
+		user, err = s.Post(&models.Transaction{
+			UserID: user.ID,
+			TxType: "grant",
+			Points: models.StartingBalance,
+			Reason: "starting balance",
+		})
+		return err
+	})
+	if err != nil {
 		jsonError(w, "failed to create user", http.StatusInternalServerError)
 		return
 	}
+	h.Hub.Publish(hub.EventUserRegistered, map[string]interface{}{
+		"user_id":  user.ID,
+		"username": user.Username,
+	}, hub.TopicAdmin)
 
 	token, err := middleware.GenerateToken(h.JWTSecret, user.ID, user.Username, user.IsAdmin)
 	if err != nil {
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"pauls-bach/backup"
+)
+
+// maxRestoreSize caps the archive a restore request may upload.
+const maxRestoreSize = 256 << 20
+
+type BackupHandler struct {
+	Backups *backup.Manager
+}
+
+// Download sends a backup of the data directory as a tar.gz archive.
+func (h *BackupHandler) Download(w http.ResponseWriter, r *http.Request) {
+	name := fmt.Sprintf("pauls-bach-%s.tar.gz", time.Now().Format("20060102-150405"))
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	if _, err := h.Backups.Snapshot(w); err != nil {
+		w.Header().Del("Content-Disposition")
+		jsonError(w, "failed to write backup", http.StatusInternalServerError)
+		return
+	}
+}
+
+// Restore replaces the data with the backup archive in the request body and
+// returns its manifest.
+func (h *BackupHandler) Restore(w http.ResponseWriter, r *http.Request) {
+	manifest, err := h.Backups.Restore(http.MaxBytesReader(w, r.Body, maxRestoreSize))
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	jsonResp(w, manifest, http.StatusOK)
+}
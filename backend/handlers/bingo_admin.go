@@ -5,7 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"pauls-bach/models"
-	"pauls-bach/sse"
+	"pauls-bach/hub"
 	"pauls-bach/store"
 	"strconv"
 
@@ -36,7 +36,7 @@ func readableLineName(line string) string {
 
 type BingoAdminHandler struct {
 	Store  *store.Store
-	Broker *sse.Broker
+	Hub    *hub.Hub
 }
 
 type createBingoEventRequest struct {
@@ -114,7 +114,7 @@ func (h *BingoAdminHandler) UpdateBingoEvent(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	h.Broker.Broadcast(sse.EventBingoResolved, map[string]interface{}{
+	h.Hub.Broadcast(hub.EventBingoResolved, map[string]interface{}{
 		"bingo_event_id": eventID,
 		"title":          event.Title,
 	})
@@ -169,7 +169,7 @@ func (h *BingoAdminHandler) UnresolveBingoEvent(w http.ResponseWriter, r *http.R
 		h.removeInvalidWins(&board)
 	}
 
-	h.Broker.Broadcast(sse.EventBingoResolved, map[string]interface{}{
+	h.Hub.Broadcast(hub.EventBingoResolved, map[string]interface{}{
 		"bingo_event_id": eventID,
 		"title":          event.Title,
 		"unresolved":     true,
@@ -220,7 +220,7 @@ func (h *BingoAdminHandler) ResolveBingoEvent(w http.ResponseWriter, r *http.Req
 		}
 	}
 
-	h.Broker.Broadcast(sse.EventBingoResolved, map[string]interface{}{
+	h.Hub.Broadcast(hub.EventBingoResolved, map[string]interface{}{
 		"bingo_event_id": eventID,
 		"title":          event.Title,
 	})
@@ -322,7 +322,7 @@ func (h *BingoAdminHandler) checkBingo(board *models.BingoBoard) {
 			}
 			h.Store.BingoWinners.Create(winner)
 
-			h.Broker.Broadcast(sse.EventBingoWinner, map[string]interface{}{
+			h.Hub.Broadcast(hub.EventBingoWinner, map[string]interface{}{
 				"username": username,
 				"line":     line.name,
 				"message":  fmt.Sprintf("%s got BINGO! (%s)", username, line.name),
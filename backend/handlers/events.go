@@ -22,15 +22,29 @@ type eventResponse struct {
 	Title            string                     `json:"title"`
 	Description      string                     `json:"description"`
 	EventType        string                     `json:"event_type"`
+	PricingModel     string                     `json:"pricing_model"`
+	Liquidity        float64                    `json:"liquidity,omitempty"`
 	Status           string                     `json:"status"`
-	WinningOutcomeID int                        `json:"winning_outcome_id,omitempty"`
+	Resolution       []models.ResolutionWeight  `json:"resolution,omitempty"`
+	Voided           bool                       `json:"voided,omitempty"`
 	CreatedAt        string                     `json:"created_at"`
 	ResolvedAt       string                     `json:"resolved_at,omitempty"`
+	ClosesAt         string                     `json:"closes_at,omitempty"`
+	AllowHedging     bool                       `json:"allow_hedging,omitempty"`
+	Rules            market.Rules               `json:"rules"`
+	Scalar           *scalarRange               `json:"scalar,omitempty"`
+	ResolvedValue    *float64                   `json:"resolved_value,omitempty"`
+	ExpectedValue    *float64                   `json:"expected_value,omitempty"` // scalar: value implied by the odds
 	LastTradeAt      string                     `json:"last_trade_at,omitempty"`
 	Odds             []market.OutcomeOdds       `json:"odds"`
 	Bettors          map[int][]string           `json:"bettors"`
 }
 
+type scalarRange struct {
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+}
+
 type eventDetailResponse struct {
 	eventResponse
 	UserPositions []userPosition `json:"user_positions,omitempty"`
@@ -54,6 +68,23 @@ func (h *EventHandler) getBettors(eventID int) map[int][]string {
 	return bettors
 }
 
+func scalarRangeOf(event *models.Event) *scalarRange {
+	if event.EventType != "scalar" {
+		return nil
+	}
+	return &scalarRange{Min: event.ScalarMin, Max: event.ScalarMax}
+}
+
+// expectedValue returns the implied value of a scalar event, or nil for
+// other event types.
+func expectedValue(event *models.Event, odds []market.OutcomeOdds) *float64 {
+	if event.EventType != "scalar" {
+		return nil
+	}
+	ev := market.ExpectedValue(event, odds)
+	return &ev
+}
+
 func (h *EventHandler) List(w http.ResponseWriter, r *http.Request) {
 	store.ReadLock()
 	defer store.ReadUnlock()
@@ -78,10 +109,19 @@ func (h *EventHandler) List(w http.ResponseWriter, r *http.Request) {
 			Title:            e.Title,
 			Description:      e.Description,
 			EventType:        e.EventType,
+			PricingModel:     e.PricingModel,
+			Liquidity:        e.Liquidity,
 			Status:           e.Status,
-			WinningOutcomeID: e.WinningOutcomeID,
+			Resolution:       e.Resolution,
+			Voided:           e.Voided,
 			CreatedAt:        e.CreatedAt,
 			ResolvedAt:       e.ResolvedAt,
+			ClosesAt:         e.ClosesAt,
+			AllowHedging:     e.AllowHedging,
+			Rules:            h.Engine.RulesFor(&e),
+			Scalar:           scalarRangeOf(&e),
+			ResolvedValue:    e.ResolvedValue,
+			ExpectedValue:    expectedValue(&e, odds),
 			LastTradeAt:      lastTrades[e.ID],
 			Odds:             odds,
 			Bettors:          bettors,
@@ -135,10 +175,19 @@ func (h *EventHandler) Get(w http.ResponseWriter, r *http.Request) {
 			Title:            event.Title,
 			Description:      event.Description,
 			EventType:        event.EventType,
+			PricingModel:     event.PricingModel,
+			Liquidity:        event.Liquidity,
 			Status:           event.Status,
-			WinningOutcomeID: event.WinningOutcomeID,
+			Resolution:       event.Resolution,
+			Voided:           event.Voided,
 			CreatedAt:        event.CreatedAt,
 			ResolvedAt:       event.ResolvedAt,
+			ClosesAt:         event.ClosesAt,
+			AllowHedging:     event.AllowHedging,
+			Rules:            h.Engine.RulesFor(event),
+			Scalar:           scalarRangeOf(event),
+			ResolvedValue:    event.ResolvedValue,
+			ExpectedValue:    expectedValue(event, odds),
 			Odds:             odds,
 			Bettors:          bettors,
 		},
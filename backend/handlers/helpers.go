@@ -21,11 +21,18 @@ func jsonError(w http.ResponseWriter, msg string, status int) {
 }
 
 func snapshotOdds(s *store.Store, eventID int, odds []market.OutcomeOdds) {
+	// Scalar events also record the value the odds imply
+	var expectedValue *float64
+	if event, err := s.Events.GetByID(eventID); err == nil && event.EventType == "scalar" {
+		ev := market.ExpectedValue(event, odds)
+		expectedValue = &ev
+	}
 	for _, o := range odds {
 		s.OddsSnapshots.Create(&models.OddsSnapshot{
-			EventID:   eventID,
-			OutcomeID: o.OutcomeID,
-			Odds:      o.Odds,
+			EventID:       eventID,
+			OutcomeID:     o.OutcomeID,
+			Odds:          o.Odds,
+			ExpectedValue: expectedValue,
 		})
 	}
 }
@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"pauls-bach/middleware"
 	"pauls-bach/store"
+	"sort"
 	"strconv"
 
 	"github.com/go-chi/chi/v5"
@@ -22,7 +23,11 @@ type historyEntry struct {
 	TxType        string  `json:"tx_type"`
 	Shares        float64 `json:"shares"`
 	Points        int     `json:"points"`
+	Reason        string  `json:"reason,omitempty"`
 	CreatedAt     string  `json:"created_at"`
+	// Set for closed limit orders (tx_type "order_filled", "order_cancelled", "order_expired")
+	Side       string  `json:"side,omitempty"`
+	LimitPrice float64 `json:"limit_price,omitempty"`
 }
 
 func (h *HistoryHandler) Get(w http.ResponseWriter, r *http.Request) {
@@ -77,9 +82,47 @@ func (h *HistoryHandler) Get(w http.ResponseWriter, r *http.Request) {
 			TxType:       tx.TxType,
 			Shares:       tx.Shares,
 			Points:       tx.Points,
+			Reason:       tx.Reason,
 			CreatedAt:    tx.CreatedAt,
 		})
 	}
 
+	// Closed limit orders are listed alongside the trades they produced
+	orders, _ := h.Store.Orders.GetByUserID(requestedID)
+	for _, o := range orders {
+		if o.Status == "open" {
+			continue
+		}
+		outcomeLabel := ""
+		if outcomes, _ := h.Store.Outcomes.GetByEventID(o.EventID); outcomes != nil {
+			for _, oc := range outcomes {
+				if oc.ID == o.OutcomeID {
+					outcomeLabel = oc.Label
+					break
+				}
+			}
+		}
+		shares, points := o.Shares, o.Amount
+		if o.Status == "filled" {
+			shares, points = o.FilledShares, o.FilledPoints
+		}
+		entries = append(entries, historyEntry{
+			ID:           o.ID,
+			EventID:      o.EventID,
+			EventTitle:   eventMap[o.EventID],
+			OutcomeID:    o.OutcomeID,
+			OutcomeLabel: outcomeLabel,
+			TxType:       "order_" + o.Status,
+			Shares:       shares,
+			Points:       points,
+			CreatedAt:    o.ClosedAt,
+			Side:         o.Side,
+			LimitPrice:   o.LimitPrice,
+		})
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].CreatedAt > entries[j].CreatedAt
+	})
+
 	jsonResp(w, entries, http.StatusOK)
 }
@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"pauls-bach/hub"
+	"pauls-bach/market"
+	"pauls-bach/middleware"
+	"pauls-bach/models"
+	"pauls-bach/store"
+	"sort"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type OrderHandler struct {
+	Store  *store.Store
+	Engine *market.Engine
+	Hub    *hub.Hub
+}
+
+type placeOrderRequest struct {
+	OutcomeID  int     `json:"outcome_id"`
+	Side       string  `json:"side"`
+	LimitPrice float64 `json:"limit_price"`
+	Amount     int     `json:"amount"` // buy: points to spend
+	Shares     float64 `json:"shares"` // sell: shares to sell
+	ExpiresAt  string  `json:"expires_at,omitempty"`
+}
+
+type bookLevel struct {
+	OutcomeID  int     `json:"outcome_id"`
+	Side       string  `json:"side"`
+	LimitPrice float64 `json:"limit_price"`
+	Amount     int     `json:"amount"`
+	Shares     float64 `json:"shares"`
+	Orders     int     `json:"orders"`
+}
+
+// matchOrders fills any resting orders crossed by the latest trade on the
+// event and notifies their owners. Callers broadcast the resulting odds.
+func matchOrders(s *store.Store, engine *market.Engine, eventHub *hub.Hub, eventID int) []models.Order {
+	closed, err := engine.MatchOrders(eventID)
+	if err != nil {
+		log.Printf("match orders on event %d: %v", eventID, err)
+	}
+	if len(closed) == 0 {
+		return nil
+	}
+
+	event, _ := s.Events.GetByID(eventID)
+	outcomes, _ := s.Outcomes.GetByEventID(eventID)
+	for _, o := range closed {
+		eventHub.Send(o.UserID, hub.EventOrderUpdated, o)
+		if o.Status != "filled" || event == nil {
+			continue
+		}
+
+		outcomeLabel := ""
+		for _, oc := range outcomes {
+			if oc.ID == o.OutcomeID {
+				outcomeLabel = oc.Label
+				break
+			}
+		}
+		username := ""
+		if user, _ := s.Users.GetByID(o.UserID); user != nil {
+			username = user.Username
+		}
+		verb := "bought"
+		if o.Side == "sell" {
+			verb = "sold"
+		}
+		entry := &models.ActivityEntry{
+			Type:    "trade",
+			Message: fmt.Sprintf("%s's limit order %s %.0f shares of %s on '%s'", username, verb, o.FilledShares, outcomeLabel, event.Title),
+			UserID:  o.UserID,
+			EventID: eventID,
+		}
+		s.Activity.Create(entry)
+		eventHub.Broadcast(hub.EventActivityNew, entry)
+	}
+	return closed
+}
+
+func (h *OrderHandler) Place(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int)
+	eventID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		jsonError(w, "invalid event id", http.StatusBadRequest)
+		return
+	}
+
+	var req placeOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	store.WriteLock()
+	defer store.WriteUnlock()
+
+	order := &models.Order{
+		UserID:     userID,
+		EventID:    eventID,
+		OutcomeID:  req.OutcomeID,
+		Side:       req.Side,
+		LimitPrice: req.LimitPrice,
+		Amount:     req.Amount,
+		Shares:     req.Shares,
+		ExpiresAt:  req.ExpiresAt,
+	}
+	if err := h.Engine.PlaceOrder(order); err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The limit may already be crossed, in which case it fills right away
+	if closed := matchOrders(h.Store, h.Engine, h.Hub, eventID); len(closed) > 0 {
+		odds, _ := h.Engine.GetOdds(eventID)
+		snapshotOdds(h.Store, eventID, odds)
+		h.Hub.Publish(hub.EventOddsUpdated, map[string]interface{}{
+			"event_id": eventID,
+			"odds":     odds,
+		}, hub.EventTopic(eventID))
+		for _, o := range closed {
+			if o.ID == order.ID {
+				order = &o
+				break
+			}
+		}
+	}
+
+	jsonResp(w, order, http.StatusCreated)
+}
+
+func (h *OrderHandler) Cancel(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int)
+	orderID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		jsonError(w, "invalid order id", http.StatusBadRequest)
+		return
+	}
+
+	store.WriteLock()
+	defer store.WriteUnlock()
+
+	order, err := h.Engine.CancelOrder(userID, orderID)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	jsonResp(w, order, http.StatusOK)
+}
+
+func (h *OrderHandler) List(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int)
+	status := r.URL.Query().Get("status")
+
+	store.ReadLock()
+	defer store.ReadUnlock()
+
+	orders, err := h.Store.Orders.GetByUserID(userID)
+	if err != nil {
+		jsonError(w, "failed to load orders", http.StatusInternalServerError)
+		return
+	}
+
+	result := make([]models.Order, 0, len(orders))
+	for i := len(orders) - 1; i >= 0; i-- { // newest first
+		if status != "" && orders[i].Status != status {
+			continue
+		}
+		result = append(result, orders[i])
+	}
+
+	jsonResp(w, result, http.StatusOK)
+}
+
+// Book returns the event's open orders aggregated by outcome, side and price.
+func (h *OrderHandler) Book(w http.ResponseWriter, r *http.Request) {
+	eventID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		jsonError(w, "invalid event id", http.StatusBadRequest)
+		return
+	}
+
+	store.ReadLock()
+	defer store.ReadUnlock()
+
+	orders, err := h.Store.Orders.GetOpenByEventID(eventID)
+	if err != nil {
+		jsonError(w, "failed to load order book", http.StatusInternalServerError)
+		return
+	}
+
+	type levelKey struct {
+		outcomeID int
+		side      string
+		price     float64
+	}
+	levels := make(map[levelKey]*bookLevel)
+	for _, o := range orders {
+		k := levelKey{o.OutcomeID, o.Side, o.LimitPrice}
+		l, ok := levels[k]
+		if !ok {
+			l = &bookLevel{OutcomeID: o.OutcomeID, Side: o.Side, LimitPrice: o.LimitPrice}
+			levels[k] = l
+		}
+		if o.Side == "buy" {
+			l.Amount += o.Amount - o.FilledPoints
+		} else {
+			l.Shares += o.Remaining()
+		}
+		l.Orders++
+	}
+
+	book := make([]bookLevel, 0, len(levels))
+	for _, l := range levels {
+		book = append(book, *l)
+	}
+	// Best prices first: highest bids, then lowest asks
+	sort.Slice(book, func(i, j int) bool {
+		if book[i].OutcomeID != book[j].OutcomeID {
+			return book[i].OutcomeID < book[j].OutcomeID
+		}
+		if book[i].Side != book[j].Side {
+			return book[i].Side == "buy"
+		}
+		if book[i].Side == "buy" {
+			return book[i].LimitPrice > book[j].LimitPrice
+		}
+		return book[i].LimitPrice < book[j].LimitPrice
+	})
+
+	jsonResp(w, book, http.StatusOK)
+}
@@ -21,13 +21,15 @@ type portfolioPosition struct {
 	Shares         float64 `json:"shares"`
 	AvgPrice       float64 `json:"avg_price"`
 	PotentialPayout int    `json:"potential_payout"`
+	Hedged         bool    `json:"hedged,omitempty"` // the user also holds other outcomes of this event
 }
 
 type portfolioResponse struct {
 	Positions      []portfolioPosition `json:"positions"`
 	TotalInvested  int                 `json:"total_invested"`
-	TotalPotential int                 `json:"total_potential"`
+	TotalPotential int                 `json:"total_potential"` // best case: the most valuable outcome of each event wins
 	ActiveMarkets  int                 `json:"active_markets"`
+	ReservedPoints int                 `json:"reserved_points"` // held by open limit orders
 }
 
 func (h *PortfolioHandler) Get(w http.ResponseWriter, r *http.Request) {
@@ -45,7 +47,14 @@ func (h *PortfolioHandler) Get(w http.ResponseWriter, r *http.Request) {
 	resp := portfolioResponse{
 		Positions: make([]portfolioPosition, 0),
 	}
+	resp.ReservedPoints, _ = h.Engine.ReservedPoints(userID)
 	eventsSeen := make(map[int]bool)
+	// Only one outcome of a hedged event can win, so count its best position
+	outcomesHeld := make(map[int]int)
+	for _, p := range positions {
+		outcomesHeld[p.EventID]++
+	}
+	bestPayout := make(map[int]int)
 
 	for _, p := range positions {
 		event, err := h.Store.Events.GetByID(p.EventID)
@@ -55,22 +64,12 @@ func (h *PortfolioHandler) Get(w http.ResponseWriter, r *http.Request) {
 
 		odds, _ := h.Engine.GetOdds(p.EventID)
 		outcomeLabel := ""
-		var totalPool float64
-		var outcomeShares float64
 		for _, o := range odds {
-			totalPool += o.Shares
 			if o.OutcomeID == p.OutcomeID {
 				outcomeLabel = o.Label
-				outcomeShares = o.Shares
 			}
 		}
-
-		poolPayout := 0
-		if outcomeShares > 0 {
-			poolPayout = int(math.Round(totalPool * (p.Shares / outcomeShares)))
-		}
-		bonus := int(math.Round(p.Shares*0.25)) + 20
-		potentialPayout := poolPayout + bonus
+		potentialPayout := h.Engine.PotentialPayout(event, odds, p.OutcomeID, p.Shares)
 
 		resp.Positions = append(resp.Positions, portfolioPosition{
 			EventID:        p.EventID,
@@ -80,15 +79,21 @@ func (h *PortfolioHandler) Get(w http.ResponseWriter, r *http.Request) {
 			Shares:         p.Shares,
 			AvgPrice:       p.AvgPrice,
 			PotentialPayout: potentialPayout,
+			Hedged:         outcomesHeld[p.EventID] > 1,
 		})
 
-		resp.TotalInvested += int(math.Round(p.Shares))
-		resp.TotalPotential += potentialPayout
+		resp.TotalInvested += int(math.Round(market.CostBasis(event, &p)))
+		if potentialPayout > bestPayout[p.EventID] {
+			bestPayout[p.EventID] = potentialPayout
+		}
 		if !eventsSeen[p.EventID] {
 			eventsSeen[p.EventID] = true
 			resp.ActiveMarkets++
 		}
 	}
+	for _, payout := range bestPayout {
+		resp.TotalPotential += payout
+	}
 
 	jsonResp(w, resp, http.StatusOK)
 }
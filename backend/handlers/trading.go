@@ -3,11 +3,13 @@ package handlers
 import (
 	"encoding/json"
 	"fmt"
+	"log"
+	"math"
 	"net/http"
+	"pauls-bach/hub"
 	"pauls-bach/market"
 	"pauls-bach/middleware"
 	"pauls-bach/models"
-	"pauls-bach/sse"
 	"pauls-bach/store"
 	"strconv"
 
@@ -17,7 +19,7 @@ import (
 type TradingHandler struct {
 	Store  *store.Store
 	Engine *market.Engine
-	Broker *sse.Broker
+	Hub    *hub.Hub
 }
 
 type buyRequest struct {
@@ -47,19 +49,21 @@ func (h *TradingHandler) Buy(w http.ResponseWriter, r *http.Request) {
 	store.WriteLock()
 	defer store.WriteUnlock()
 
-	if err := h.Engine.Buy(userID, eventID, req.OutcomeID, req.Amount); err != nil {
+	shares, err := h.Engine.Buy(userID, eventID, req.OutcomeID, req.Amount)
+	if err != nil {
 		jsonError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	matchOrders(h.Store, h.Engine, h.Hub, eventID)
 
 	odds, _ := h.Engine.GetOdds(eventID)
 	user, _ := h.Store.Users.GetByID(userID)
 	snapshotOdds(h.Store, eventID, odds)
 
-	h.Broker.Broadcast(sse.EventOddsUpdated, map[string]interface{}{
+	h.Hub.Publish(hub.EventOddsUpdated, map[string]interface{}{
 		"event_id": eventID,
 		"odds":     odds,
-	})
+	}, hub.EventTopic(eventID))
 
 	// Log activity
 	if event, _ := h.Store.Events.GetByID(eventID); event != nil {
@@ -72,40 +76,51 @@ func (h *TradingHandler) Buy(w http.ResponseWriter, r *http.Request) {
 		}
 		entry := &models.ActivityEntry{
 			Type:    "trade",
-			Message: fmt.Sprintf("%s bought %d shares of %s on '%s'", user.Username, req.Amount, outcomeLabel, event.Title),
+			Message: fmt.Sprintf("%s bought %.2f shares of %s on '%s'", user.Username, shares, outcomeLabel, event.Title),
 			UserID:  userID,
 			EventID: eventID,
 		}
 		h.Store.Activity.Create(entry)
-		h.Broker.Broadcast(sse.EventActivityNew, entry)
+		h.Hub.Broadcast(hub.EventActivityNew, entry)
 
-		// Check bounty: award 10 pts to creator when 5+ unique users bet
-		if event.CreatorID > 0 && !event.BountyPaid {
+		// Check bounty: award the creator once enough unique users bet
+		rules := h.Engine.RulesFor(event)
+		if event.CreatorID > 0 && !event.BountyPaid && rules.BountyPoints > 0 {
 			positions, _ := h.Store.Positions.GetByEventID(eventID)
 			uniqueUsers := make(map[int]bool)
 			for _, p := range positions {
 				uniqueUsers[p.UserID] = true
 			}
-			if len(uniqueUsers) >= 5 {
-				event.BountyPaid = true
-				h.Store.Events.Update(event)
-				if creator, _ := h.Store.Users.GetByID(event.CreatorID); creator != nil {
-					creator.Balance += 10
-					h.Store.Users.Update(creator)
-					h.Store.Transactions.Create(&models.Transaction{
+			if len(uniqueUsers) >= rules.BountyBettors {
+				var creator *models.User
+				err := h.Store.Transact(func(s *store.Store) error {
+					event.BountyPaid = true
+					if err := s.Events.Update(event); err != nil {
+						return err
+					}
+					if _, err := s.Users.GetByID(event.CreatorID); err != nil {
+						return nil
+					}
+					var err error
+					creator, err = s.Post(&models.Transaction{
 						UserID:  event.CreatorID,
 						EventID: eventID,
-						TxType:  "bonus",
-						Points:  10,
+						TxType:  "bounty",
+						Points:  rules.BountyPoints,
 					})
+					return err
+				})
+				if err != nil {
+					log.Printf("bounty for event %d: %v", eventID, err)
+				} else if creator != nil {
 					bountyEntry := &models.ActivityEntry{
 						Type:    "bounty",
-						Message: fmt.Sprintf("%s earned 10 pts bounty — 5 players bet on '%s'", creator.Username, event.Title),
+						Message: fmt.Sprintf("%s earned %d pts bounty — %d players bet on '%s'", creator.Username, rules.BountyPoints, len(uniqueUsers), event.Title),
 						UserID:  event.CreatorID,
 						EventID: eventID,
 					}
 					h.Store.Activity.Create(bountyEntry)
-					h.Broker.Broadcast(sse.EventActivityNew, bountyEntry)
+					h.Hub.Broadcast(hub.EventActivityNew, bountyEntry)
 				}
 			}
 		}
@@ -113,6 +128,7 @@ func (h *TradingHandler) Buy(w http.ResponseWriter, r *http.Request) {
 
 	jsonResp(w, map[string]interface{}{
 		"message": "purchase successful",
+		"shares":  shares,
 		"odds":    odds,
 		"balance": user.Balance,
 	}, http.StatusOK)
@@ -140,15 +156,16 @@ func (h *TradingHandler) Sell(w http.ResponseWriter, r *http.Request) {
 		jsonError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	matchOrders(h.Store, h.Engine, h.Hub, eventID)
 
 	odds, _ := h.Engine.GetOdds(eventID)
 	user, _ := h.Store.Users.GetByID(userID)
 	snapshotOdds(h.Store, eventID, odds)
 
-	h.Broker.Broadcast(sse.EventOddsUpdated, map[string]interface{}{
+	h.Hub.Publish(hub.EventOddsUpdated, map[string]interface{}{
 		"event_id": eventID,
 		"odds":     odds,
-	})
+	}, hub.EventTopic(eventID))
 
 	// Log activity
 	if event, _ := h.Store.Events.GetByID(eventID); event != nil {
@@ -166,7 +183,7 @@ func (h *TradingHandler) Sell(w http.ResponseWriter, r *http.Request) {
 			EventID: eventID,
 		}
 		h.Store.Activity.Create(entry)
-		h.Broker.Broadcast(sse.EventActivityNew, entry)
+		h.Hub.Broadcast(hub.EventActivityNew, entry)
 	}
 
 	jsonResp(w, map[string]interface{}{
@@ -176,3 +193,59 @@ func (h *TradingHandler) Sell(w http.ResponseWriter, r *http.Request) {
 		"balance":     user.Balance,
 	}, http.StatusOK)
 }
+
+// maxQuoteAmount bounds the points or shares a quote may be asked for.
+const maxQuoteAmount = 1_000_000_000
+
+// Quote prices a buy or sell without executing it. amount is points for a
+// buy and shares for a sell.
+func (h *TradingHandler) Quote(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int)
+	eventID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		jsonError(w, "invalid event id", http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+	outcomeID, err := strconv.Atoi(query.Get("outcome_id"))
+	if err != nil {
+		jsonError(w, "invalid outcome_id", http.StatusBadRequest)
+		return
+	}
+	side := query.Get("side")
+	if side == "" {
+		side = "buy"
+	}
+
+	var quote *market.Quote
+	switch side {
+	case "buy":
+		amount, parseErr := strconv.Atoi(query.Get("amount"))
+		if parseErr != nil || amount <= 0 || amount > maxQuoteAmount {
+			jsonError(w, "amount must be a whole number of points between 1 and "+strconv.Itoa(maxQuoteAmount), http.StatusBadRequest)
+			return
+		}
+		store.ReadLock()
+		defer store.ReadUnlock()
+		quote, err = h.Engine.QuoteBuy(userID, eventID, outcomeID, amount)
+	case "sell":
+		shares, parseErr := strconv.ParseFloat(query.Get("amount"), 64)
+		if parseErr != nil || math.IsNaN(shares) || shares <= 0 || shares > maxQuoteAmount {
+			jsonError(w, "amount must be a number of shares above 0 and at most "+strconv.Itoa(maxQuoteAmount), http.StatusBadRequest)
+			return
+		}
+		store.ReadLock()
+		defer store.ReadUnlock()
+		quote, err = h.Engine.QuoteSell(userID, eventID, outcomeID, shares)
+	default:
+		jsonError(w, "side must be 'buy' or 'sell'", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	jsonResp(w, quote, http.StatusOK)
+}
@@ -0,0 +1,48 @@
+package hub
+
+// sent is a message as the hub sent it, kept for replay.
+type sent struct {
+	Delivery
+	topics []string
+}
+
+// history is a ring buffer of the most recent messages, oldest first.
+type history struct {
+	buf   []sent
+	start int // index of the oldest
+	n     int
+}
+
+func newHistory(size int) *history {
+	return &history{buf: make([]sent, size)}
+}
+
+func (h *history) add(m sent) {
+	if len(h.buf) == 0 {
+		return
+	}
+	if h.n < len(h.buf) {
+		h.buf[(h.start+h.n)%len(h.buf)] = m
+		h.n++
+		return
+	}
+	h.buf[h.start] = m
+	h.start = (h.start + 1) % len(h.buf)
+}
+
+// since returns the messages after id that sub matches, and false if some
+// of them have already been dropped from the buffer. lastID is the ID of
+// the newest message sent.
+func (h *history) since(id, lastID uint64, sub subscription) ([]Delivery, bool) {
+	if id > lastID || lastID-id > uint64(h.n) {
+		return nil, false
+	}
+	var missed []Delivery
+	for i := h.n - int(lastID-id); i < h.n; i++ {
+		m := h.buf[(h.start+i)%len(h.buf)]
+		if sub.matches(m.topics) {
+			missed = append(missed, m.Delivery)
+		}
+	}
+	return missed, true
+}
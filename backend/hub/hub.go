@@ -0,0 +1,366 @@
+// Package hub fans typed messages out to the clients that follow them,
+// whichever transport they are connected over (see packages sse and ws).
+// Messages are published to topics, numbered, and kept for a while, so a
+// client that reconnects can have the ones it missed replayed.
+package hub
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Message types
+const (
+	EventOddsUpdated   = "odds_updated"
+	EventEventCreated  = "event_created"
+	EventEventResolved = "event_resolved"
+	EventEventClosed   = "event_closed"
+	EventUserResolved  = "user_resolved"
+	EventBingoResolved = "bingo_resolved"
+	EventBingoWinner   = "bingo_winner"
+	EventActivityNew   = "activity_new"
+	EventOrderUpdated  = "order_updated"
+	// Admin topic only
+	EventUserRegistered = "user_registered"
+	// Sent to a client when it connects
+	EventConnected = "connected"
+	// Sent instead of the messages a reconnecting client missed when they
+	// are too old to replay; it should refetch whatever it shows
+	EventResync = "resync"
+	// Sent just before a transport disconnects a client that has fallen
+	// too far behind; it should reconnect to have the rest replayed
+	EventLagged = "lagged"
+)
+
+type Message struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+}
+
+// historySize is how many recent messages the hub keeps to replay to
+// clients that reconnect.
+const historySize = 1024
+
+// clientBuffer is how many messages may be queued for a client before it
+// counts as lagging.
+const clientBuffer = 64
+
+var (
+	ErrTooManyClients     = errors.New("too many open streams, try again later")
+	ErrTooManyUserClients = errors.New("too many open streams for this user")
+)
+
+// Delivery is a message as sent to clients: its ID and the JSON of its
+// Message.
+type Delivery struct {
+	ID   uint64
+	Data []byte
+}
+
+// A Client is one connection attached to the hub.
+type Client struct {
+	UserID  int // 0 = anonymous
+	IsAdmin bool
+
+	ch     chan Delivery
+	sub    subscription
+	lagged chan struct{}
+}
+
+// Messages delivers the messages of the client's topics, in order.
+func (c *Client) Messages() <-chan Delivery { return c.ch }
+
+// Lagged is closed when the hub detaches the client for falling behind.
+// Its transport should tell it so (see EventLagged) and disconnect it.
+func (c *Client) Lagged() <-chan struct{} { return c.lagged }
+
+type Hub struct {
+	// Caps on attached clients, in total and per logged-in user; 0 means
+	// no cap
+	MaxClients        int
+	MaxClientsPerUser int
+
+	publisher Publisher
+	mu        sync.Mutex
+	clients   map[*Client]struct{}
+	perUser   map[int]int // logged-in users' clients
+	jwtSecret string
+	// ID of the latest message; the publisher numbers them
+	lastID  uint64
+	history *history
+	stats   Stats
+}
+
+// Stats counts the hub's clients and what happened to them since it
+// started.
+type Stats struct {
+	Clients int `json:"clients"`
+	Users   int `json:"users"` // logged-in users with a client attached
+	// Totals
+	Connections uint64 `json:"connections"`
+	Published   uint64 `json:"published"`
+	Replayed    uint64 `json:"replayed"`
+	Resyncs     uint64 `json:"resyncs"`
+	Lagged      uint64 `json:"lagged"`   // clients disconnected for falling behind
+	Rejected    uint64 `json:"rejected"` // connections refused by the caps
+}
+
+// New returns a hub that publishes messages through pub: NewLocal() for a
+// single server instance, or a networked Publisher to share them between
+// several.
+func New(jwtSecret string, pub Publisher) *Hub {
+	h := &Hub{
+		publisher: pub,
+		clients:   make(map[*Client]struct{}),
+		perUser:   make(map[int]int),
+		jwtSecret: jwtSecret,
+		history:   newHistory(historySize),
+	}
+	pub.Start(h.receive)
+	return h
+}
+
+// Attached is the state of a client's stream when it attached.
+type Attached struct {
+	current uint64 // ID of the latest message
+	resumed bool
+	missed  []Delivery
+	resync  bool // what it missed is too old to replay
+}
+
+// First returns the messages to send the client before any others: a
+// connected message for a new client, and for one resuming its stream what
+// it missed, or a resync message if that can't be replayed.
+func (a *Attached) First() []Delivery {
+	switch {
+	case !a.resumed:
+		return []Delivery{{ID: a.current, Data: notice(EventConnected)}}
+	case a.resync:
+		return []Delivery{{ID: a.current, Data: notice(EventResync)}}
+	}
+	return a.missed
+}
+
+// notice returns the JSON of a message without data.
+func notice(msgType string) []byte {
+	return []byte(`{"type":"` + msgType + `"}`)
+}
+
+// Attach adds a client following the given topics (all it may read if
+// there are none; see Subscribe), unless that would exceed a cap. A client
+// resuming a stream passes the ID of the last message it saw.
+func (h *Hub) Attach(userID int, isAdmin bool, topics []string, lastEventID *uint64) (*Client, *Attached, error) {
+	sub, err := newSubscription(topics, userID, isAdmin)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	switch {
+	case h.MaxClients > 0 && len(h.clients) >= h.MaxClients:
+		h.stats.Rejected++
+		return nil, nil, ErrTooManyClients
+	case h.MaxClientsPerUser > 0 && userID != 0 && h.perUser[userID] >= h.MaxClientsPerUser:
+		h.stats.Rejected++
+		return nil, nil, ErrTooManyUserClients
+	}
+
+	c := &Client{UserID: userID, IsAdmin: isAdmin, ch: make(chan Delivery, clientBuffer), sub: sub, lagged: make(chan struct{})}
+	h.clients[c] = struct{}{}
+	if userID != 0 {
+		h.perUser[userID]++
+	}
+	h.stats.Connections++
+
+	a := &Attached{current: h.lastID, resumed: lastEventID != nil}
+	if a.resumed {
+		missed, ok := h.history.since(*lastEventID, h.lastID, sub)
+		if ok {
+			a.missed = missed
+			h.stats.Replayed += uint64(len(missed))
+		} else {
+			a.resync = true
+			h.stats.Resyncs++
+		}
+	}
+	return c, a, nil
+}
+
+// Detach removes the client.
+func (h *Hub) Detach(c *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.remove(c)
+}
+
+// remove forgets the client, if it hasn't been already. The caller holds mu.
+func (h *Hub) remove(c *Client) {
+	if _, ok := h.clients[c]; !ok {
+		return
+	}
+	delete(h.clients, c)
+	if c.UserID != 0 {
+		if h.perUser[c.UserID]--; h.perUser[c.UserID] == 0 {
+			delete(h.perUser, c.UserID)
+		}
+	}
+}
+
+// Subscribe adds topics to the ones the client follows.
+func (h *Hub) Subscribe(c *Client, topics []string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, t := range topics {
+		if err := c.sub.add(t, c.UserID, c.IsAdmin); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Unsubscribe stops the client following topics.
+func (h *Hub) Unsubscribe(c *Client, topics []string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, t := range topics {
+		c.sub.remove(t, c.UserID)
+	}
+}
+
+// Stats returns the hub's current counts.
+func (h *Hub) Stats() Stats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	stats := h.stats
+	stats.Clients = len(h.clients)
+	stats.Users = len(h.perUser)
+	return stats
+}
+
+// Publish sends a message to the clients subscribed to any of the topics,
+// through the hub's Publisher.
+func (h *Hub) Publish(msgType string, data interface{}, topics ...string) {
+	msg := Message{Type: msgType, Data: data}
+	bytes, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	if err := h.publisher.Publish(bytes, topics); err != nil {
+		log.Printf("hub: failed to publish %s: %v", msgType, err)
+	}
+}
+
+// receive delivers a message from the publisher to the clients subscribed
+// to any of the topics.
+func (h *Hub) receive(d Delivery, topics []string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.lastID != 0 && d.ID != h.lastID+1 {
+		// Messages were lost, e.g. while the publisher reconnected. The
+		// clients can't have them replayed, so have them refetch instead,
+		// and start the history afresh
+		h.history = newHistory(historySize)
+		resync := Delivery{ID: d.ID - 1, Data: notice(EventResync)}
+		for c := range h.clients {
+			select {
+			case c.ch <- resync:
+			default:
+				h.lag(c)
+			}
+		}
+		h.stats.Resyncs += uint64(len(h.clients))
+	}
+
+	h.lastID = d.ID
+	h.stats.Published++
+	h.history.add(sent{d, topics})
+	for c := range h.clients {
+		if !c.sub.matches(topics) {
+			continue
+		}
+		select {
+		case c.ch <- d:
+		default:
+			// Client too slow. Disconnecting it beats leaving a gap in
+			// its stream: it reconnects and has what it missed replayed
+			h.lag(c)
+		}
+	}
+}
+
+// Lag detaches a client that has fallen behind; see Client.Lagged.
+// Transports call it for clients the hub can't tell are behind, such as
+// ones that stop acknowledging messages.
+func (h *Hub) Lag(c *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lag(c)
+}
+
+func (h *Hub) lag(c *Client) {
+	if _, ok := h.clients[c]; !ok {
+		return
+	}
+	h.remove(c)
+	h.stats.Lagged++
+	close(c.lagged)
+}
+
+// ErrorStatus is the HTTP status for an error from Attach or Subscribe.
+func ErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrTopicForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, ErrTooManyUserClients):
+		return http.StatusTooManyRequests
+	case errors.Is(err, ErrTooManyClients):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusBadRequest
+}
+
+// Broadcast sends a message to the global topic.
+func (h *Hub) Broadcast(msgType string, data interface{}) {
+	h.Publish(msgType, data, TopicGlobal)
+}
+
+// Send sends a message to the user's topic.
+func (h *Hub) Send(userID int, msgType string, data interface{}) {
+	h.Publish(msgType, data, UserTopic(userID))
+}
+
+// Authenticate returns the user a JWT token string is for, or 0 if it's
+// missing or invalid (anonymous), and when the token expires (zero if it
+// doesn't).
+func (h *Hub) Authenticate(tokenStr string) (userID int, isAdmin bool, expires time.Time) {
+	if tokenStr == "" {
+		return 0, false, time.Time{}
+	}
+	token, err := jwt.Parse(tokenStr, func(t *jwt.Token) (interface{}, error) {
+		return []byte(h.jwtSecret), nil
+	})
+	if err != nil || !token.Valid {
+		return 0, false, time.Time{}
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return 0, false, time.Time{}
+	}
+	uid, ok := claims["user_id"].(float64)
+	if !ok {
+		return 0, false, time.Time{}
+	}
+	isAdmin, _ = claims["is_admin"].(bool)
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		expires = exp.Time
+	}
+	return int(uid), isAdmin, expires
+}
@@ -0,0 +1,280 @@
+package hub
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func newTestHub() *Hub {
+	return New("secret", NewLocal())
+}
+
+// received returns the messages waiting for c, without blocking.
+func received(c *Client) []Delivery {
+	var ds []Delivery
+	for {
+		select {
+		case d := <-c.Messages():
+			ds = append(ds, d)
+		default:
+			return ds
+		}
+	}
+}
+
+// types returns the message types of ds.
+func types(t *testing.T, ds []Delivery) []string {
+	t.Helper()
+	var got []string
+	for _, d := range ds {
+		var m struct{ Type string }
+		if err := json.Unmarshal(d.Data, &m); err != nil {
+			t.Fatalf("message %s: %v", d.Data, err)
+		}
+		got = append(got, m.Type)
+	}
+	return got
+}
+
+// publish publishes n messages of type msgType to the global topic, and
+// returns their IDs.
+func publish(t *testing.T, h *Hub, msgType string, n int) []uint64 {
+	t.Helper()
+	watcher, _, err := h.Attach(0, false, []string{TopicGlobal}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Detach(watcher)
+	var ids []uint64
+	for i := 0; i < n; i++ {
+		h.Broadcast(msgType, i)
+		for _, d := range received(watcher) {
+			ids = append(ids, d.ID)
+		}
+	}
+	if len(ids) != n {
+		t.Fatalf("published %d messages, saw %d", n, len(ids))
+	}
+	return ids
+}
+
+func TestAttachNew(t *testing.T) {
+	h := newTestHub()
+	ids := publish(t, h, "a", 3)
+
+	c, attached, err := h.Attach(0, false, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := attached.First()
+	if got := types(t, first); len(got) != 1 || got[0] != EventConnected {
+		t.Fatalf("first messages %v, want connected", got)
+	}
+	// The connected message carries the latest ID, to resume from
+	if first[0].ID != ids[2] {
+		t.Errorf("connected with ID %d, want %d", first[0].ID, ids[2])
+	}
+	h.Broadcast("b", nil)
+	if got := received(c); len(got) != 1 || got[0].ID != ids[2]+1 {
+		t.Errorf("received %v after connecting, want message %d", got, ids[2]+1)
+	}
+}
+
+// A client resuming its stream is replayed exactly the messages after the
+// last one it saw.
+func TestAttachReplaysMissed(t *testing.T) {
+	h := newTestHub()
+	ids := publish(t, h, "a", 5)
+
+	tests := []struct {
+		name string
+		last uint64
+		want []uint64
+	}{
+		{"missed some", ids[1], ids[2:]},
+		{"missed one", ids[3], ids[4:]},
+		{"up to date", ids[4], nil},
+		{"missed all kept", ids[0] - 1, ids},
+	}
+	for _, tt := range tests {
+		c, attached, err := h.Attach(0, false, nil, &tt.last)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []uint64
+		for _, d := range attached.First() {
+			got = append(got, d.ID)
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: replayed %v, want %v", tt.name, got, tt.want)
+		} else {
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("%s: replayed %v, want %v", tt.name, got, tt.want)
+					break
+				}
+			}
+		}
+		h.Detach(c)
+	}
+	if stats := h.Stats(); stats.Replayed != 3+1+0+5 {
+		t.Errorf("%d messages replayed, want 9", stats.Replayed)
+	}
+}
+
+// What has dropped out of the history can't be replayed, so the client is
+// told to resync.
+func TestAttachResyncs(t *testing.T) {
+	h := newTestHub()
+	ids := publish(t, h, "a", historySize+10)
+
+	for name, last := range map[string]uint64{
+		"beyond history":  ids[5],
+		"just beyond":     ids[8],
+		"from the future": ids[len(ids)-1] + 1,
+		"an earlier run":  1,
+	} {
+		_, attached, err := h.Attach(0, false, nil, &last)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := types(t, attached.First()); len(got) != 1 || got[0] != EventResync {
+			t.Errorf("%s: first messages %v, want resync", name, got)
+		}
+	}
+
+	// The oldest message still kept is replayable
+	last := ids[9]
+	_, attached, err := h.Attach(0, false, nil, &last)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := attached.First(); len(got) != historySize || got[0].ID != ids[10] {
+		t.Errorf("replayed %d messages from %d, want %d from %d", len(got), got[0].ID, historySize, ids[10])
+	}
+}
+
+// Messages missing from the publisher's numbering can't be replayed either:
+// clients are told to resync, and the history starts again.
+func TestReceiveGap(t *testing.T) {
+	h := newTestHub()
+	ids := publish(t, h, "a", 3)
+	c, _, err := h.Attach(0, false, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h.receive(Delivery{ID: ids[2] + 5, Data: notice("b")}, []string{TopicGlobal})
+	got := received(c)
+	if types := types(t, got); len(types) != 2 || types[0] != EventResync || types[1] != "b" {
+		t.Fatalf("received %v, want resync then b", types)
+	}
+	if got[0].ID != ids[2]+4 {
+		t.Errorf("resync has ID %d, want %d", got[0].ID, ids[2]+4)
+	}
+
+	last := ids[2]
+	_, attached, err := h.Attach(0, false, nil, &last)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := types(t, attached.First()); len(got) != 1 || got[0] != EventResync {
+		t.Errorf("resuming from before the gap got %v, want resync", got)
+	}
+}
+
+// A client that stops reading is detached once its buffer fills, rather
+// than holding up the others or missing messages.
+func TestLaggingClient(t *testing.T) {
+	h := newTestHub()
+	slow, _, err := h.Attach(0, false, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fast, _, err := h.Attach(0, false, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < clientBuffer; i++ {
+		h.Broadcast("a", i)
+		received(fast)
+	}
+	select {
+	case <-slow.Lagged():
+		t.Fatal("lagged with room in its buffer")
+	default:
+	}
+	h.Broadcast("a", clientBuffer)
+	select {
+	case <-slow.Lagged():
+	default:
+		t.Fatal("not lagged with its buffer full")
+	}
+	if got := received(fast); len(got) != 1 {
+		t.Errorf("fast client received %d messages, want 1", len(got))
+	}
+	// What it has is still in order, for the transport to send before it
+	// disconnects
+	if got := received(slow); len(got) != clientBuffer {
+		t.Errorf("slow client has %d messages, want %d", len(got), clientBuffer)
+	}
+	h.Broadcast("a", 0)
+	if got := received(slow); len(got) != 0 {
+		t.Errorf("slow client received %d messages after lagging", len(got))
+	}
+	if stats := h.Stats(); stats.Clients != 1 || stats.Lagged != 1 {
+		t.Errorf("stats %+v, want 1 client and 1 lagged", stats)
+	}
+
+	// Lagging it again, or detaching it, does nothing more
+	h.Lag(slow)
+	h.Detach(slow)
+	if stats := h.Stats(); stats.Clients != 1 || stats.Lagged != 1 {
+		t.Errorf("stats %+v, want 1 client and 1 lagged", stats)
+	}
+}
+
+func TestClientCaps(t *testing.T) {
+	h := newTestHub()
+	h.MaxClients = 3
+	h.MaxClientsPerUser = 2
+
+	if _, _, err := h.Attach(7, false, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	second, _, err := h.Attach(7, false, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := h.Attach(7, false, nil, nil); !errors.Is(err, ErrTooManyUserClients) {
+		t.Errorf("third stream for a user: %v, want %v", err, ErrTooManyUserClients)
+	}
+	if _, _, err := h.Attach(0, false, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := h.Attach(8, false, nil, nil); !errors.Is(err, ErrTooManyClients) {
+		t.Errorf("fourth stream: %v, want %v", err, ErrTooManyClients)
+	}
+	if stats := h.Stats(); stats.Clients != 3 || stats.Users != 1 || stats.Rejected != 2 {
+		t.Errorf("stats %+v, want 3 clients, 1 user and 2 rejected", stats)
+	}
+
+	h.Detach(second)
+	if _, _, err := h.Attach(8, false, nil, nil); err != nil {
+		t.Errorf("stream after one closed: %v", err)
+	}
+
+	for err, want := range map[error]int{
+		ErrTooManyClients:     http.StatusServiceUnavailable,
+		ErrTooManyUserClients: http.StatusTooManyRequests,
+		ErrTopicForbidden:     http.StatusForbidden,
+		errors.New("other"):   http.StatusBadRequest,
+	} {
+		if got := ErrorStatus(err); got != want {
+			t.Errorf("ErrorStatus(%v) = %d, want %d", err, got, want)
+		}
+	}
+}
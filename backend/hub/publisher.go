@@ -0,0 +1,49 @@
+package hub
+
+import (
+	"sync"
+	"time"
+)
+
+// A Publisher carries the messages published on a hub to the hubs that
+// deliver them to clients: only that one for Local, or those of every
+// server instance connected to the same relay for Relay. It numbers the
+// messages, and each hub is handed them in order.
+type Publisher interface {
+	// Publish sends the JSON of a Message to the topics.
+	Publish(data []byte, topics []string) error
+	// Start hands every message published from then on to deliver, one at
+	// a time. Messages missing from the numbering, e.g. while a networked
+	// publisher was reconnecting, are lost; see Hub.receive.
+	Start(deliver func(d Delivery, topics []string))
+}
+
+// Local is the Publisher of a hub that runs on its own.
+type Local struct {
+	mu      sync.Mutex
+	lastID  uint64
+	deliver func(Delivery, []string)
+}
+
+func NewLocal() *Local {
+	// IDs count up from when the server started, so they keep increasing
+	// across restarts, and a client that was connected to an earlier run
+	// is told to resync instead of being replayed the wrong messages
+	return &Local{lastID: uint64(time.Now().UnixMicro())}
+}
+
+func (l *Local) Start(deliver func(Delivery, []string)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.deliver = deliver
+}
+
+func (l *Local) Publish(data []byte, topics []string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lastID++
+	if l.deliver != nil {
+		l.deliver(Delivery{ID: l.lastID, Data: data}, topics)
+	}
+	return nil
+}
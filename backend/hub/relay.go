@@ -0,0 +1,253 @@
+package hub
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// A relay lets several server instances share their messages, so that
+// clients get every one whichever instance they're connected to. Each
+// instance's Relay publisher keeps a TCP connection to a RelayServer, which
+// numbers the messages it's sent and fans them out to all of them, the
+// sender included. The protocol is one JSON relayMessage per line.
+//
+// The relay trusts whatever connects to it, so it should only listen on a
+// private network.
+
+// relayMessage is a message on its way to (without ID) or from the relay.
+type relayMessage struct {
+	ID     uint64          `json:"id,omitempty"`
+	Topics []string        `json:"topics"`
+	Data   json.RawMessage `json:"data"`
+}
+
+// validate checks a relayed message could have come from Hub.Publish: its
+// data is a JSON object with something in it, for topics clients can
+// subscribe to.
+func (m relayMessage) validate() error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(m.Data, &fields); err != nil || len(fields) == 0 {
+		return errors.New("data is not a JSON object")
+	}
+	if len(m.Topics) == 0 {
+		return errors.New("no topics")
+	}
+	for _, t := range m.Topics {
+		if !knownTopic(t) {
+			return fmt.Errorf("unknown topic %q", t)
+		}
+	}
+	return nil
+}
+
+// maxRelayLine bounds the size of a relayed message.
+const maxRelayLine = 1 << 20
+
+// relayBuffer is how many messages may be queued for an instance before
+// the relay disconnects it for falling behind, and how many an instance
+// may queue for the relay before it fails to publish them.
+const relayBuffer = 1024
+
+const (
+	relayRetry        = 2 * time.Second
+	relayWriteTimeout = 5 * time.Second
+)
+
+var ErrRelayBehind = errors.New("too many messages waiting for the relay")
+
+// Relay is the Publisher of a hub that shares its messages with other
+// server instances through the RelayServer at Addr. Publishing only queues
+// a message, as callers hold the store lock, and a goroutine sends the
+// queue on. It reconnects when the connection drops; messages published
+// meanwhile wait in the queue, and once that's full fail with
+// ErrRelayBehind.
+type Relay struct {
+	Addr string
+	out  chan []byte
+}
+
+func NewRelay(addr string) *Relay {
+	return &Relay{Addr: addr, out: make(chan []byte, relayBuffer)}
+}
+
+func (r *Relay) Start(deliver func(Delivery, []string)) {
+	go r.run(deliver)
+}
+
+// run keeps a connection to the relay open, sending it the queue and
+// delivering what it sends.
+func (r *Relay) run(deliver func(Delivery, []string)) {
+	var unsent []byte
+	for {
+		conn, err := net.Dial("tcp", r.Addr)
+		if err != nil {
+			log.Printf("hub: relay %s: %v", r.Addr, err)
+			time.Sleep(relayRetry)
+			continue
+		}
+		log.Printf("hub: connected to relay %s", r.Addr)
+
+		done := make(chan struct{})
+		stopped := make(chan []byte)
+		go func(first []byte) { stopped <- r.write(conn, first, done) }(unsent)
+		err = readRelay(conn, func(m relayMessage) {
+			deliver(Delivery{ID: m.ID, Data: m.Data}, m.Topics)
+		})
+		close(done)
+		conn.Close()
+		unsent = <-stopped
+		log.Printf("hub: lost relay %s: %v", r.Addr, err)
+		time.Sleep(relayRetry)
+	}
+}
+
+// write sends first, if set, and then the queue to conn until done is
+// closed or a write fails, which closes conn so that run reconnects. It
+// returns the line it failed to send, to be sent first next time.
+func (r *Relay) write(conn net.Conn, first []byte, done <-chan struct{}) []byte {
+	line := first
+	for {
+		if line != nil {
+			conn.SetWriteDeadline(time.Now().Add(relayWriteTimeout))
+			if _, err := conn.Write(line); err != nil {
+				conn.Close()
+				return line
+			}
+		}
+		select {
+		case line = <-r.out:
+		case <-done:
+			return nil
+		}
+	}
+}
+
+func (r *Relay) Publish(data []byte, topics []string) error {
+	line, err := json.Marshal(relayMessage{Topics: topics, Data: data})
+	if err != nil {
+		return err
+	}
+	select {
+	case r.out <- append(line, '\n'):
+		return nil
+	default:
+		return ErrRelayBehind
+	}
+}
+
+// readRelay calls handle with each message read from conn until it fails.
+// Messages that aren't valid are logged and skipped.
+func readRelay(conn net.Conn, handle func(relayMessage)) error {
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 4096), maxRelayLine)
+	for scanner.Scan() {
+		var m relayMessage
+		if err := json.Unmarshal(scanner.Bytes(), &m); err != nil {
+			return err
+		}
+		if err := m.validate(); err != nil {
+			log.Printf("relay: dropped a message from %s: %v", conn.RemoteAddr(), err)
+			continue
+		}
+		handle(m)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return errors.New("connection closed")
+}
+
+// RelayServer fans messages out between the server instances connected to
+// it. Run one, with "pauls-bach relay", and point every instance at it.
+type RelayServer struct {
+	mu     sync.Mutex
+	peers  map[chan []byte]struct{}
+	lastID uint64
+}
+
+func NewRelayServer() *RelayServer {
+	return &RelayServer{
+		peers: make(map[chan []byte]struct{}),
+		// As for Local, so IDs keep increasing if the relay restarts
+		lastID: uint64(time.Now().UnixMicro()),
+	}
+}
+
+// Serve accepts instances on ln until it fails.
+func (s *RelayServer) Serve(ln net.Listener) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *RelayServer) handle(conn net.Conn) {
+	peer := make(chan []byte, relayBuffer)
+	s.mu.Lock()
+	s.peers[peer] = struct{}{}
+	s.mu.Unlock()
+	log.Printf("relay: %s connected", conn.RemoteAddr())
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for line := range peer {
+			conn.SetWriteDeadline(time.Now().Add(relayWriteTimeout))
+			if _, err := conn.Write(line); err != nil {
+				break
+			}
+		}
+		// Dropped, or failed to write: disconnect the instance
+		conn.Close()
+	}()
+
+	err := readRelay(conn, s.publish)
+	s.drop(peer)
+	conn.Close()
+	<-done
+	log.Printf("relay: %s disconnected: %v", conn.RemoteAddr(), err)
+}
+
+// publish numbers a message and queues it for every instance.
+func (s *RelayServer) publish(m relayMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastID++
+	m.ID = s.lastID
+	line, err := json.Marshal(m)
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+	for peer := range s.peers {
+		select {
+		case peer <- line:
+		default:
+			// Instance too slow. Its hub sees the gap when it reconnects
+			// and has its clients resync
+			s.dropLocked(peer)
+		}
+	}
+}
+
+func (s *RelayServer) drop(peer chan []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dropLocked(peer)
+}
+
+func (s *RelayServer) dropLocked(peer chan []byte) {
+	if _, ok := s.peers[peer]; ok {
+		delete(s.peers, peer)
+		close(peer)
+	}
+}
@@ -0,0 +1,224 @@
+package hub
+
+import (
+	"encoding/json"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// trackingListener remembers the connections it accepts, so a test can
+// drop them.
+type trackingListener struct {
+	net.Listener
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func (l *trackingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err == nil {
+		l.mu.Lock()
+		l.conns = append(l.conns, conn)
+		l.mu.Unlock()
+	}
+	return conn, err
+}
+
+func (l *trackingListener) dropAll() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, conn := range l.conns {
+		conn.Close()
+	}
+	l.conns = nil
+}
+
+func (s *RelayServer) peerCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.peers)
+}
+
+func startRelay(t *testing.T) (*RelayServer, *trackingListener) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tl := &trackingListener{Listener: ln}
+	s := NewRelayServer()
+	go s.Serve(tl)
+	t.Cleanup(func() {
+		ln.Close()
+		tl.dropAll()
+	})
+	return s, tl
+}
+
+// waitFor polls cond until it holds, for up to timeout.
+func waitFor(t *testing.T, timeout time.Duration, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// next returns the next message for c, failing if none comes in time.
+func next(t *testing.T, c *Client) Delivery {
+	t.Helper()
+	select {
+	case d := <-c.Messages():
+		return d
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message")
+		return Delivery{}
+	}
+}
+
+func TestRelay(t *testing.T) {
+	server, ln := startRelay(t)
+	addr := ln.Addr().String()
+	a, b := New("secret", NewRelay(addr)), New("secret", NewRelay(addr))
+	waitFor(t, 5*time.Second, "both hubs to connect", func() bool { return server.peerCount() == 2 })
+	ca, _, err := a.Attach(0, false, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cb, _, err := b.Attach(0, false, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A message published on one hub reaches both, with the same ID
+	a.Broadcast("hello", 1)
+	da, db := next(t, ca), next(t, cb)
+	if da.ID != db.ID || string(db.Data) != `{"type":"hello","data":1}` {
+		t.Fatalf("a got %d %s, b got %d %s", da.ID, da.Data, db.ID, db.Data)
+	}
+	b.Publish("odds", 2, EventTopic(4))
+	if d := next(t, ca); d.ID != da.ID+1 || string(d.Data) != `{"type":"odds","data":2}` {
+		t.Errorf("a got %d %s, want odds with ID %d", d.ID, d.Data, da.ID+1)
+	}
+	next(t, cb)
+
+	// Either hub can replay it to a client resuming after the first
+	last := da.ID
+	_, attached, err := b.Attach(0, false, []string{"events"}, &last)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if missed := attached.First(); len(missed) != 1 || missed[0].ID != da.ID+1 {
+		t.Errorf("replayed %v, want the odds message", missed)
+	}
+
+	// Once dropped, a hub reconnects, and what it published meanwhile is
+	// sent then. (What it wrote before it noticed the drop is lost, as
+	// with any TCP connection.)
+	ln.dropAll()
+	waitFor(t, 5*time.Second, "the relay to drop the hubs", func() bool { return server.peerCount() == 0 })
+	time.Sleep(100 * time.Millisecond)
+	a.Broadcast("while down", 3)
+	waitFor(t, 10*time.Second, "both hubs to reconnect", func() bool { return server.peerCount() == 2 })
+	d := next(t, ca)
+	if string(d.Data) != `{"type":"while down","data":3}` || d.ID != da.ID+2 {
+		t.Fatalf("a got %d %s after the reconnect, want the message published while down with ID %d", d.ID, d.Data, da.ID+2)
+	}
+
+	// b gets it too, unless it reconnected after it was sent, in which case
+	// it sees the gap and has its clients resync
+	a.Broadcast("after", 4)
+	d = next(t, cb)
+	switch string(d.Data) {
+	case `{"type":"while down","data":3}`:
+	case `{"type":"resync"}`:
+	default:
+		t.Fatalf("b got %s after the reconnect", d.Data)
+	}
+	if d.ID != da.ID+2 {
+		t.Errorf("b got ID %d, want %d", d.ID, da.ID+2)
+	}
+	if d := next(t, cb); string(d.Data) != `{"type":"after","data":4}` || d.ID != da.ID+3 {
+		t.Errorf("b got %d %s, want after with ID %d", d.ID, d.Data, da.ID+3)
+	}
+	next(t, ca)
+}
+
+// Messages that couldn't have come from a hub are dropped, and the ones
+// after them still get through.
+func TestRelayDropsInvalidMessages(t *testing.T) {
+	server, ln := startRelay(t)
+	h := New("secret", NewRelay(ln.Addr().String()))
+	waitFor(t, 5*time.Second, "the hub to connect", func() bool { return server.peerCount() == 1 })
+	c, _, err := h.Attach(0, false, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	for _, line := range []string{
+		`{"topics":["bogus"],"data":{"type":"x"}}`,
+		`{"topics":["global"],"data":[1]}`,
+		`{"topics":["global"],"data":{}}`,
+		`{"topics":[],"data":{"type":"x"}}`,
+		`{"topics":["event:0"],"data":{"type":"x"}}`,
+		`{"topics":["global"],"data":{"type":"valid"}}`,
+	} {
+		if _, err := conn.Write([]byte(line + "\n")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d := next(t, c); string(d.Data) != `{"type":"valid"}` {
+		t.Errorf("got %s, want only the valid message", d.Data)
+	}
+}
+
+func TestRelayMessageValidate(t *testing.T) {
+	tests := []struct {
+		msg   string
+		valid bool
+	}{
+		{`{"topics":["global"],"data":{"type":"a"}}`, true},
+		{`{"topics":["admin","user:3","event:9"],"data":{"type":"a"}}`, true},
+		{`{"topics":["global"],"data":{}}`, false},
+		{`{"topics":["global"],"data":[{"type":"a"}]}`, false},
+		{`{"topics":["global"],"data":"a"}`, false},
+		{`{"topics":["global"]}`, false},
+		{`{"data":{"type":"a"}}`, false},
+		{`{"topics":["global","user:x"],"data":{"type":"a"}}`, false},
+		{`{"topics":["events"],"data":{"type":"a"}}`, false},
+		{`{"topics":["user"],"data":{"type":"a"}}`, false},
+	}
+	for _, tt := range tests {
+		var m relayMessage
+		if err := json.Unmarshal([]byte(tt.msg), &m); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.validate(); (err == nil) != tt.valid {
+			t.Errorf("%s: validate returned %v", tt.msg, err)
+		}
+	}
+}
+
+// Publishing only queues, so it doesn't wait on the network; once the
+// queue is full it fails instead.
+func TestRelayPublishQueueFull(t *testing.T) {
+	r := NewRelay("127.0.0.1:1")
+	for i := 0; i < relayBuffer; i++ {
+		if err := r.Publish([]byte(`{"type":"a"}`), []string{TopicGlobal}); err != nil {
+			t.Fatalf("message %d: %v", i, err)
+		}
+	}
+	if err := r.Publish([]byte(`{"type":"a"}`), []string{TopicGlobal}); err != ErrRelayBehind {
+		t.Errorf("Publish with the queue full returned %v, want %v", err, ErrRelayBehind)
+	}
+}
@@ -0,0 +1,149 @@
+package hub
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Every message is published to one or more topics, and a client gets the
+// messages of the topics it subscribed to. Besides the topics themselves it
+// may subscribe to these shorthands:
+//
+//	events  every event's topic
+//	user    the client's own user topic
+//
+// A client that doesn't name any gets every topic it's allowed to read.
+const (
+	// Market-wide news: events created, closed and resolved, the activity
+	// feed and bingo
+	TopicGlobal = "global"
+	// Admin-only notices
+	TopicAdmin = "admin"
+
+	topicAllEvents = "events"
+	topicOwnUser   = "user"
+)
+
+// EventTopic carries the messages about one event, such as its odds.
+func EventTopic(eventID int) string {
+	return "event:" + strconv.Itoa(eventID)
+}
+
+// UserTopic carries the messages for one user, such as their orders.
+func UserTopic(userID int) string {
+	return "user:" + strconv.Itoa(userID)
+}
+
+// knownTopic reports whether t is a topic messages are published to.
+func knownTopic(t string) bool {
+	switch {
+	case t == TopicGlobal || t == TopicAdmin:
+		return true
+	case strings.HasPrefix(t, "event:"):
+		id, err := strconv.Atoi(strings.TrimPrefix(t, "event:"))
+		return err == nil && id > 0
+	case strings.HasPrefix(t, "user:"):
+		id, err := strconv.Atoi(strings.TrimPrefix(t, "user:"))
+		return err == nil && id > 0
+	}
+	return false
+}
+
+// subscription is the topics a client gets.
+type subscription struct {
+	topics    map[string]bool
+	allEvents bool
+}
+
+func (s subscription) matches(topics []string) bool {
+	for _, t := range topics {
+		if s.topics[t] || (s.allEvents && strings.HasPrefix(t, "event:")) {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrTopicForbidden is returned for a topic the client may not read.
+var ErrTopicForbidden = errors.New("not allowed to subscribe to topic")
+
+// newSubscription returns the subscription to topics; see add. No topics
+// means all of them.
+func newSubscription(topics []string, userID int, isAdmin bool) (subscription, error) {
+	sub := subscription{topics: make(map[string]bool)}
+	if len(topics) == 0 {
+		sub.topics[TopicGlobal] = true
+		sub.allEvents = true
+		if userID != 0 {
+			sub.topics[UserTopic(userID)] = true
+		}
+		if isAdmin {
+			sub.topics[TopicAdmin] = true
+		}
+		return sub, nil
+	}
+	for _, t := range topics {
+		if err := sub.add(t, userID, isAdmin); err != nil {
+			return sub, err
+		}
+	}
+	return sub, nil
+}
+
+// add subscribes to topic t. Only the user themselves may read a user
+// topic, and only admins the admin topic.
+func (s *subscription) add(t string, userID int, isAdmin bool) error {
+	switch {
+	case t == TopicGlobal:
+		s.topics[t] = true
+	case t == topicAllEvents:
+		s.allEvents = true
+	case strings.HasPrefix(t, "event:"):
+		id, err := strconv.Atoi(strings.TrimPrefix(t, "event:"))
+		if err != nil || id <= 0 {
+			return fmt.Errorf("invalid topic %q", t)
+		}
+		s.topics[EventTopic(id)] = true
+	case t == topicOwnUser || t == UserTopic(userID):
+		if userID == 0 {
+			return fmt.Errorf("%w %q: log in first", ErrTopicForbidden, t)
+		}
+		s.topics[UserTopic(userID)] = true
+	case strings.HasPrefix(t, "user:"):
+		return fmt.Errorf("%w %q", ErrTopicForbidden, t)
+	case t == TopicAdmin:
+		if !isAdmin {
+			return fmt.Errorf("%w %q", ErrTopicForbidden, t)
+		}
+		s.topics[t] = true
+	default:
+		return fmt.Errorf("unknown topic %q", t)
+	}
+	return nil
+}
+
+// remove unsubscribes from topic t.
+func (s *subscription) remove(t string, userID int) {
+	switch t {
+	case topicAllEvents:
+		s.allEvents = false
+	case topicOwnUser:
+		delete(s.topics, UserTopic(userID))
+	default:
+		delete(s.topics, t)
+	}
+}
+
+// SplitTopics splits a comma-separated list of topics, as clients pass them
+// in a URL.
+func SplitTopics(param string) []string {
+	var topics []string
+	for _, t := range strings.Split(param, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			topics = append(topics, t)
+		}
+	}
+	return topics
+}
@@ -0,0 +1,139 @@
+package hub
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// Each message below is published to one topic; a client gets the ones
+// its subscription covers.
+func TestTopicFiltering(t *testing.T) {
+	published := []struct {
+		msgType string
+		topic   string
+	}{
+		{"global", TopicGlobal},
+		{"event1", EventTopic(1)},
+		{"event2", EventTopic(2)},
+		{"user7", UserTopic(7)},
+		{"user8", UserTopic(8)},
+		{"admin", TopicAdmin},
+	}
+	tests := []struct {
+		name    string
+		userID  int
+		isAdmin bool
+		topics  []string
+		want    []string
+	}{
+		{"anonymous, everything", 0, false, nil, []string{"global", "event1", "event2"}},
+		{"user, everything", 7, false, nil, []string{"global", "event1", "event2", "user7"}},
+		{"admin, everything", 7, true, nil, []string{"global", "event1", "event2", "user7", "admin"}},
+		{"one event", 0, false, []string{"event:2"}, []string{"event2"}},
+		{"events shorthand", 0, false, []string{"events"}, []string{"event1", "event2"}},
+		{"user shorthand", 7, false, []string{"user"}, []string{"user7"}},
+		{"own user topic", 8, false, []string{"user:8", "global"}, []string{"global", "user8"}},
+		{"admin topic", 7, true, []string{"admin"}, []string{"admin"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHub()
+			last := publish(t, h, "before", 1)[0]
+			c, _, err := h.Attach(tt.userID, tt.isAdmin, tt.topics, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, m := range published {
+				h.Publish(m.msgType, nil, m.topic)
+			}
+			if got := types(t, received(c)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("received %v, want %v", got, tt.want)
+			}
+
+			// Replays are filtered the same way
+			_, attached, err := h.Attach(tt.userID, tt.isAdmin, tt.topics, &last)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := types(t, attached.First()); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("replayed %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTopicRejected(t *testing.T) {
+	tests := []struct {
+		name      string
+		userID    int
+		isAdmin   bool
+		topic     string
+		forbidden bool
+	}{
+		{"anonymous user shorthand", 0, false, "user", true},
+		{"someone else's user topic", 7, false, "user:8", true},
+		{"admin topic", 7, false, "admin", true},
+		{"bad event ID", 0, false, "event:x", false},
+		{"zero event ID", 0, false, "event:0", false},
+		{"unknown", 0, false, "everything", false},
+	}
+	for _, tt := range tests {
+		h := newTestHub()
+		_, _, err := h.Attach(tt.userID, tt.isAdmin, []string{TopicGlobal, tt.topic}, nil)
+		if err == nil {
+			t.Errorf("%s: attached", tt.name)
+			continue
+		}
+		if errors.Is(err, ErrTopicForbidden) != tt.forbidden {
+			t.Errorf("%s: error %v, forbidden %v", tt.name, err, tt.forbidden)
+		}
+		if stats := h.Stats(); stats.Clients != 0 {
+			t.Errorf("%s: %d clients attached", tt.name, stats.Clients)
+		}
+
+		// Nor can an attached client add it later
+		c, _, err := h.Attach(tt.userID, tt.isAdmin, []string{TopicGlobal}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := h.Subscribe(c, []string{tt.topic}); err == nil {
+			t.Errorf("%s: subscribed", tt.name)
+		}
+	}
+}
+
+func TestSubscribeUnsubscribe(t *testing.T) {
+	h := newTestHub()
+	c, _, err := h.Attach(7, false, []string{"event:1"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publishAll := func() []string {
+		h.Publish("event1", nil, EventTopic(1))
+		h.Publish("event2", nil, EventTopic(2))
+		h.Publish("user7", nil, UserTopic(7))
+		return types(t, received(c))
+	}
+
+	if err := h.Subscribe(c, []string{"events", "user"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := publishAll(), []string{"event1", "event2", "user7"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("subscribed: received %v, want %v", got, want)
+	}
+	h.Unsubscribe(c, []string{"events", "user"})
+	if got, want := publishAll(), []string{"event1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unsubscribed: received %v, want %v", got, want)
+	}
+}
+
+func TestSplitTopics(t *testing.T) {
+	got := SplitTopics(" global, event:3,,user ")
+	if want := []string{"global", "event:3", "user"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("SplitTopics = %v, want %v", got, want)
+	}
+	if got := SplitTopics(""); got != nil {
+		t.Errorf("SplitTopics of nothing = %v", got)
+	}
+}
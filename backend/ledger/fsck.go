@@ -0,0 +1,218 @@
+// Package ledger checks that the stored balances agree with the ledger
+// they are derived from, and that nothing points at a deleted event.
+package ledger
+
+import (
+	"fmt"
+
+	"pauls-bach/market"
+	"pauls-bach/models"
+	"pauls-bach/store"
+)
+
+// Report is what Check found. An empty report means the data is consistent.
+type Report struct {
+	Users        int `json:"users"`
+	Transactions int `json:"transactions"`
+	// Users whose balance isn't what their transactions add up to
+	Mismatches []Mismatch `json:"mismatches"`
+	// Records that point at an event that no longer exists
+	Orphans []Orphan `json:"orphans"`
+	// Set by Repair once it has corrected everything in the report
+	Repaired bool `json:"repaired"`
+	// The stakes Repair refunded on deleted events that still had
+	// positions
+	Refunds []Refund `json:"refunds"`
+}
+
+// OK reports whether the check found nothing wrong.
+func (r *Report) OK() bool {
+	return len(r.Mismatches) == 0 && len(r.Orphans) == 0
+}
+
+type Mismatch struct {
+	UserID   int    `json:"user_id"`
+	Username string `json:"username"`
+	Balance  int    `json:"balance"`  // as stored
+	Expected int    `json:"expected"` // what the ledger adds up to
+}
+
+type Refund struct {
+	UserID  int `json:"user_id"`
+	EventID int `json:"event_id"`
+	Points  int `json:"points"`
+}
+
+type Orphan struct {
+	Kind    string `json:"kind"` // "outcome", "position", "resolved_position", "odds_snapshot" or "order"
+	ID      int    `json:"id"`
+	EventID int    `json:"event_id"`
+}
+
+// Check adds up every user's ledger entries and compares the result with
+// their balance, and looks for records left behind by deleted events. The
+// caller holds the store lock.
+func Check(s *store.Store) (*Report, error) {
+	users, err := s.Users.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	txs, err := s.Transactions.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	balances, err := s.LedgerBalances()
+	if err != nil {
+		return nil, err
+	}
+	report := &Report{
+		Users:        len(users),
+		Transactions: len(txs),
+		Mismatches:   []Mismatch{},
+		Orphans:      []Orphan{},
+		Refunds:      []Refund{},
+	}
+
+	for _, u := range users {
+		if u.Balance != balances[u.ID] {
+			report.Mismatches = append(report.Mismatches, Mismatch{
+				UserID:   u.ID,
+				Username: u.Username,
+				Balance:  u.Balance,
+				Expected: balances[u.ID],
+			})
+		}
+	}
+
+	events, err := s.Events.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	exists := make(map[int]bool, len(events))
+	for _, e := range events {
+		exists[e.ID] = true
+	}
+	orphan := func(kind string, id, eventID int) {
+		if !exists[eventID] {
+			report.Orphans = append(report.Orphans, Orphan{Kind: kind, ID: id, EventID: eventID})
+		}
+	}
+
+	outcomes, err := s.Outcomes.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range outcomes {
+		orphan("outcome", o.ID, o.EventID)
+	}
+	positions, err := s.Positions.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range positions {
+		orphan("position", p.ID, p.EventID)
+	}
+	resolved, err := s.ResolvedPositions.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range resolved {
+		orphan("resolved_position", p.ID, p.EventID)
+	}
+	snapshots, err := s.OddsSnapshots.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range snapshots {
+		orphan("odds_snapshot", o.ID, o.EventID)
+	}
+	orders, err := s.Orders.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range orders {
+		orphan("order", o.ID, o.EventID)
+	}
+	return report, nil
+}
+
+// Repair runs Check and fixes what it finds in one transaction. The ledger
+// is taken as right: mismatched balances are rebuilt from it. Orphaned
+// records are deleted. Open positions mean the event was deleted without
+// refunding its stakes, so before deleting those Repair refunds everyone
+// who traded on it, as voiding it would have. The caller holds the store
+// write lock.
+func Repair(s *store.Store) (*Report, error) {
+	var report *Report
+	err := s.Transact(func(s *store.Store) error {
+		var err error
+		if report, err = Check(s); err != nil {
+			return err
+		}
+		if _, err := s.RebuildBalances(); err != nil {
+			return err
+		}
+
+		seen := make(map[int]bool)
+		var eventIDs []int
+		unrefunded := make(map[int]bool)
+		for _, o := range report.Orphans {
+			if !seen[o.EventID] {
+				seen[o.EventID] = true
+				eventIDs = append(eventIDs, o.EventID)
+			}
+			if o.Kind == "position" {
+				unrefunded[o.EventID] = true
+			}
+		}
+		for _, eventID := range eventIDs {
+			if unrefunded[eventID] {
+				if err := refund(s, report, eventID); err != nil {
+					return err
+				}
+			}
+			for _, del := range []func(int) error{
+				s.Outcomes.DeleteByEventID,
+				s.Positions.DeleteByEventID,
+				s.ResolvedPositions.DeleteByEventID,
+				s.OddsSnapshots.DeleteByEventID,
+				s.Orders.DeleteByEventID,
+			} {
+				if err := del(eventID); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	report.Repaired = true
+	return report, nil
+}
+
+// refund gives back the net stakes on a deleted event.
+func refund(s *store.Store, report *Report, eventID int) error {
+	txs, err := s.Transactions.GetByEventID(eventID)
+	if err != nil {
+		return err
+	}
+	stakes, userIDs := market.NetStakes(txs)
+	for _, userID := range userIDs {
+		if stakes[userID] <= 0 {
+			continue
+		}
+		if _, err := s.Post(&models.Transaction{
+			UserID:  userID,
+			EventID: eventID,
+			TxType:  "refund",
+			Points:  stakes[userID],
+			Reason:  fmt.Sprintf("event %d was deleted", eventID),
+		}); err != nil {
+			return err
+		}
+		report.Refunds = append(report.Refunds, Refund{UserID: userID, EventID: eventID, Points: stakes[userID]})
+	}
+	return nil
+}
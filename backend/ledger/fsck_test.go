@@ -0,0 +1,90 @@
+package ledger
+
+import (
+	"testing"
+
+	"pauls-bach/market"
+	"pauls-bach/models"
+	"pauls-bach/store"
+)
+
+// An event deleted out from under its positions gets its stakes refunded
+// before the positions go.
+func TestRepairRefundsOrphanedPositions(t *testing.T) {
+	s, err := store.Open("csv", t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	e := &market.Engine{Store: s, Rules: market.Rules{SellPayout: 0.5}}
+
+	var users []int
+	for _, name := range []string{"a", "b"} {
+		u := &models.User{Username: name}
+		if err := s.Users.Create(u); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Post(&models.Transaction{UserID: u.ID, TxType: "grant", Points: models.StartingBalance}); err != nil {
+			t.Fatal(err)
+		}
+		users = append(users, u.ID)
+	}
+	event := &models.Event{Title: "E", EventType: "binary", Status: "open", PricingModel: "pool"}
+	if err := s.Events.Create(event); err != nil {
+		t.Fatal(err)
+	}
+	var outcomes []int
+	for _, label := range []string{"Yes", "No"} {
+		o := &models.Outcome{EventID: event.ID, Label: label}
+		if err := s.Outcomes.Create(o); err != nil {
+			t.Fatal(err)
+		}
+		outcomes = append(outcomes, o.ID)
+	}
+	if _, err := e.Buy(users[0], event.ID, outcomes[0], 100); err != nil {
+		t.Fatal(err)
+	}
+	shares, err := e.Buy(users[1], event.ID, outcomes[1], 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Sell(users[1], event.ID, outcomes[1], shares); err != nil {
+		t.Fatal(err)
+	}
+	b, err := s.Users.GetByID(users[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	stakeB := models.StartingBalance - b.Balance
+	if err := s.Events.Delete(event.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := Repair(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[int]int{users[0]: 100, users[1]: stakeB}
+	if len(report.Refunds) != len(want) {
+		t.Fatalf("refunds %+v, want %v", report.Refunds, want)
+	}
+	for _, r := range report.Refunds {
+		if r.Points != want[r.UserID] || r.EventID != event.ID {
+			t.Errorf("refund %+v, want %d points", r, want[r.UserID])
+		}
+	}
+	for _, userID := range users {
+		if u, _ := s.Users.GetByID(userID); u.Balance != models.StartingBalance {
+			t.Errorf("user %d has %d after the refund, want %d", userID, u.Balance, models.StartingBalance)
+		}
+	}
+
+	// Nothing is left to repair, or refund twice
+	report, err = Repair(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() || len(report.Refunds) != 0 {
+		t.Errorf("second repair found %+v", report)
+	}
+}
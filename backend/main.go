@@ -6,14 +6,19 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"time"
 
+	"pauls-bach/backup"
 	"pauls-bach/config"
 	"pauls-bach/handlers"
+	"pauls-bach/hub"
 	"pauls-bach/market"
 	mw "pauls-bach/middleware"
 	"pauls-bach/models"
+	"pauls-bach/scheduler"
 	"pauls-bach/sse"
 	"pauls-bach/store"
+	"pauls-bach/ws"
 
 	"github.com/go-chi/chi/v5"
 	chimw "github.com/go-chi/chi/v5/middleware"
@@ -23,27 +28,93 @@ import (
 func main() {
 	cfg := config.Load()
 
-	s, err := store.New(cfg.DataDir)
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			os.Exit(cmd(cfg, os.Args[2:]))
+		}
+	}
+
+	// Held for as long as the server runs, so fsck, backup and restore
+	// can't work on the data directory under it
+	release, err := store.LockDir(cfg.DataDir)
+	if err != nil {
+		log.Fatalf("failed to lock data directory: %v", err)
+	}
+	defer release()
+	s, err := store.Open(cfg.StoreBackend, cfg.DataDir)
 	if err != nil {
 		log.Fatalf("failed to init store: %v", err)
 	}
 
+	// Balances are a projection of the ledger; make sure they still match it
+	store.WriteLock()
+	if _, err := s.RebuildBalances(); err != nil {
+		log.Fatalf("failed to rebuild balances: %v", err)
+	}
+	store.WriteUnlock()
+
 	// Bootstrap admin account
 	bootstrapAdmin(s, cfg.AdminPIN)
 
-	engine := &market.Engine{Store: s}
-	broker := sse.NewBroker(cfg.JWTSecret)
+	rules := market.DefaultRules.With(&cfg.Rules)
+	if err := rules.Validate(); err != nil {
+		log.Fatalf("invalid economic rules: %v", err)
+	}
+	engine := &market.Engine{Store: s, Rules: rules}
+	var publisher hub.Publisher = hub.NewLocal()
+	if cfg.RelayAddr != "" {
+		publisher = hub.NewRelay(cfg.RelayAddr)
+	}
+	eventHub := hub.New(cfg.JWTSecret, publisher)
+	eventHub.MaxClients = cfg.StreamMaxClients
+	eventHub.MaxClientsPerUser = cfg.StreamMaxClientsPerUser
 
-	authH := &handlers.AuthHandler{Store: s, JWTSecret: cfg.JWTSecret}
+	authH := &handlers.AuthHandler{Store: s, JWTSecret: cfg.JWTSecret, Hub: eventHub}
 	eventH := &handlers.EventHandler{Store: s, Engine: engine}
-	tradingH := &handlers.TradingHandler{Store: s, Engine: engine, Broker: broker}
-	adminH := &handlers.AdminHandler{Store: s, Engine: engine, Broker: broker}
+	tradingH := &handlers.TradingHandler{Store: s, Engine: engine, Hub: eventHub}
+	adminH := &handlers.AdminHandler{Store: s, Engine: engine, Hub: eventHub}
 	leaderboardH := &handlers.LeaderboardHandler{Store: s}
 	historyH := &handlers.HistoryHandler{Store: s}
 	bingoH := &handlers.BingoHandler{Store: s}
-	bingoAdminH := &handlers.BingoAdminHandler{Store: s, Broker: broker}
+	bingoAdminH := &handlers.BingoAdminHandler{Store: s, Hub: eventHub}
 	activityH := &handlers.ActivityHandler{Store: s}
 	portfolioH := &handlers.PortfolioHandler{Store: s, Engine: engine}
+	orderH := &handlers.OrderHandler{Store: s, Engine: engine, Hub: eventHub}
+	streamH := &sse.Handler{Hub: eventHub, Heartbeat: cfg.StreamHeartbeat}
+	wsH := &ws.Handler{
+		Hub:       eventHub,
+		Heartbeat: cfg.StreamHeartbeat,
+		Trades:    map[string]http.HandlerFunc{"buy": tradingH.Buy, "sell": tradingH.Sell},
+	}
+
+	sched := &scheduler.Scheduler{Store: s, Engine: engine, Hub: eventHub, Interval: 10 * time.Second}
+	go sched.Run()
+
+	retention := store.DefaultOddsRetention
+	if cfg.OddsMinuteAfter != 0 {
+		retention.MinuteAfter = cfg.OddsMinuteAfter
+	}
+	if cfg.OddsHourAfter != 0 {
+		retention.HourAfter = cfg.OddsHourAfter
+	}
+	if err := retention.Validate(); err != nil {
+		log.Fatalf("invalid odds retention: %v", err)
+	}
+	compactor := &scheduler.OddsCompactor{Store: s, Retention: retention, Interval: cfg.OddsCompactInterval}
+	go compactor.Run()
+
+	backups := &backup.Manager{
+		Store:    s,
+		Backend:  cfg.StoreBackend,
+		DataDir:  cfg.DataDir,
+		Dir:      cfg.BackupDir,
+		Interval: cfg.BackupInterval,
+		Keep:     cfg.BackupKeep,
+	}
+	if cfg.BackupDir != "" {
+		go backups.Run()
+	}
+	backupH := &handlers.BackupHandler{Backups: backups}
 
 	r := chi.NewRouter()
 	r.Use(chimw.Logger)
@@ -53,7 +124,8 @@ func main() {
 	r.Route("/api", func(r chi.Router) {
 		r.Post("/auth/login", authH.Login)
 		r.Post("/auth/register", authH.Register)
-		r.Get("/stream", broker.ServeHTTP)
+		r.Get("/stream", streamH.ServeHTTP)
+		r.Get("/ws", wsH.ServeHTTP)
 
 		r.Group(func(r chi.Router) {
 			r.Use(mw.Auth(cfg.JWTSecret))
@@ -63,6 +135,11 @@ func main() {
 			r.Get("/events/{id}/odds-history", eventH.OddsHistory)
 			r.Post("/events/{id}/buy", tradingH.Buy)
 			r.Post("/events/{id}/sell", tradingH.Sell)
+			r.Get("/events/{id}/quote", tradingH.Quote)
+			r.Get("/events/{id}/orders", orderH.Book)
+			r.Post("/events/{id}/orders", orderH.Place)
+			r.Get("/orders", orderH.List)
+			r.Delete("/orders/{id}", orderH.Cancel)
 			r.Get("/leaderboard", leaderboardH.Get)
 			r.Get("/users/{id}/history", historyH.Get)
 			r.Get("/bingo/events", bingoH.ListBingoEvents)
@@ -87,10 +164,16 @@ func main() {
 			r.Delete("/admin/events/{id}", adminH.DeleteEvent)
 			r.Post("/admin/events/{id}/resolve", adminH.ResolveEvent)
 			r.Post("/admin/events/{id}/unresolve", adminH.UnresolveEvent)
+			r.Post("/admin/events/{id}/void", adminH.VoidEvent)
 			r.Post("/admin/bingo/events", bingoAdminH.CreateBingoEvent)
 			r.Put("/admin/bingo/events/{id}", bingoAdminH.UpdateBingoEvent)
 			r.Post("/admin/bingo/events/{id}/resolve", bingoAdminH.ResolveBingoEvent)
 			r.Post("/admin/bingo/events/{id}/unresolve", bingoAdminH.UnresolveBingoEvent)
+			r.Get("/admin/ledger/check", adminH.CheckLedger)
+			r.Post("/admin/ledger/repair", adminH.RepairLedger)
+			r.Get("/admin/stream/stats", adminH.StreamStats)
+			r.Get("/admin/backup", backupH.Download)
+			r.Post("/admin/restore", backupH.Restore)
 	
 		})
 	})
@@ -117,6 +200,15 @@ func main() {
 	log.Fatal(http.ListenAndServe(":"+cfg.Port, r))
 }
 
+// commands are the subcommands run instead of the server, as in
+// "pauls-bach fsck".
+var commands = map[string]func(cfg *config.Config, args []string) int{
+	"fsck":    fsck,
+	"backup":  backupCommand,
+	"restore": restoreCommand,
+	"relay":   relayCommand,
+}
+
 func bootstrapAdmin(s *store.Store, adminPIN string) {
 	store.WriteLock()
 	defer store.WriteUnlock()
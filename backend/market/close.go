@@ -0,0 +1,62 @@
+package market
+
+import (
+	"fmt"
+	"time"
+
+	"pauls-bach/models"
+)
+
+// checkTradable returns an error unless the event currently accepts trades.
+// An event past its closes_at is rejected even if the scheduler hasn't
+// flipped its status yet.
+func checkTradable(event *models.Event) error {
+	switch {
+	case event.Status == "closed" || closeDue(event, time.Now()):
+		return fmt.Errorf("event is closed for trading")
+	case event.Status != "open":
+		return fmt.Errorf("event is not open for trading")
+	}
+	return nil
+}
+
+func closeDue(event *models.Event, now time.Time) bool {
+	if event.ClosesAt == "" {
+		return false
+	}
+	closesAt, err := time.Parse(time.RFC3339, event.ClosesAt)
+	return err == nil && !closesAt.After(now)
+}
+
+// CloseDueEvents moves open events whose closes_at has passed to "closed" and
+// cancels the orders resting on them. It returns the events it closed and
+// the cancelled orders.
+func (e *Engine) CloseDueEvents(now time.Time) ([]models.Event, []models.Order, error) {
+	events, err := e.Store.Events.GetAll()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var closed []models.Event
+	var cancelled []models.Order
+	for _, ev := range events {
+		if ev.Status != "open" || !closeDue(&ev, now) {
+			continue
+		}
+		ev.Status = "closed"
+		var orders []models.Order
+		err := e.transact(func(e *Engine) (err error) {
+			if err := e.Store.Events.Update(&ev); err != nil {
+				return err
+			}
+			orders, err = e.CancelEventOrders(ev.ID)
+			return err
+		})
+		if err != nil {
+			return closed, cancelled, err
+		}
+		closed = append(closed, ev)
+		cancelled = append(cancelled, orders...)
+	}
+	return closed, cancelled, nil
+}
@@ -11,6 +11,7 @@ import (
 
 type Engine struct {
 	Store *store.Store
+	Rules Rules // server-wide defaults; events may override them
 }
 
 type UserOutcome struct {
@@ -36,183 +37,175 @@ func (e *Engine) GetOdds(eventID int) ([]OutcomeOdds, error) {
 	if err != nil {
 		return nil, err
 	}
-	positions, err := e.Store.Positions.GetByEventID(eventID)
+	q, err := e.outcomeShares(eventID, outcomes)
 	if err != nil {
 		return nil, err
 	}
+	event, _ := e.Store.Events.GetByID(eventID)
+	return oddsFor(event, outcomes, q), nil
+}
 
-	sharesByOutcome := make(map[int]float64)
-	for _, p := range positions {
-		sharesByOutcome[p.OutcomeID] += p.Shares
+// oddsFor prices the outcomes given their outstanding shares q. LMSR events
+// price off the cost curve; pool events (and a nil event) by share of the pot.
+func oddsFor(event *models.Event, outcomes []models.Outcome, q []float64) []OutcomeOdds {
+	var prices []float64
+	if event != nil && event.PricingModel == "lmsr" {
+		prices = lmsrPrices(q, lmsrLiquidity(event))
 	}
 
 	var totalShares float64
-	for _, s := range sharesByOutcome {
+	for _, s := range q {
 		totalShares += s
 	}
 
 	odds := make([]OutcomeOdds, len(outcomes))
 	for i, o := range outcomes {
-		s := sharesByOutcome[o.ID]
 		var pct float64
-		if totalShares == 0 {
+		switch {
+		case prices != nil:
+			pct = prices[i] * 100
+		case totalShares == 0:
 			pct = 100.0 / float64(len(outcomes))
-		} else {
-			pct = (s / totalShares) * 100
+		default:
+			pct = (q[i] / totalShares) * 100
 		}
 		odds[i] = OutcomeOdds{
 			OutcomeID: o.ID,
 			Label:     o.Label,
 			Odds:      math.Round(pct*100) / 100,
-			Shares:    s,
+			Shares:    q[i],
 		}
 	}
-	return odds, nil
+	return odds
 }
 
-func (e *Engine) Buy(userID, eventID, outcomeID, amount int) error {
-	if amount <= 0 {
-		return fmt.Errorf("amount must be positive")
-	}
-
-	user, err := e.Store.Users.GetByID(userID)
+// outcomeShares returns the outstanding shares of each outcome, in the same
+// order as outcomes.
+func (e *Engine) outcomeShares(eventID int, outcomes []models.Outcome) ([]float64, error) {
+	positions, err := e.Store.Positions.GetByEventID(eventID)
 	if err != nil {
-		return fmt.Errorf("user not found")
-	}
-	if user.Balance < amount {
-		return fmt.Errorf("insufficient balance")
+		return nil, err
 	}
-
-	event, err := e.Store.Events.GetByID(eventID)
-	if err != nil {
-		return fmt.Errorf("event not found")
+	sharesByOutcome := make(map[int]float64)
+	for _, p := range positions {
+		sharesByOutcome[p.OutcomeID] += p.Shares
 	}
-	if event.Status != "open" {
-		return fmt.Errorf("event is not open for betting")
+	q := make([]float64, len(outcomes))
+	for i, o := range outcomes {
+		q[i] = sharesByOutcome[o.ID]
 	}
+	return q, nil
+}
 
-	// Verify outcome belongs to event
-	outcomes, err := e.Store.Outcomes.GetByEventID(eventID)
-	if err != nil {
-		return err
-	}
-	validOutcome := false
-	for _, o := range outcomes {
-		if o.ID == outcomeID {
-			validOutcome = true
-			break
-		}
-	}
-	if !validOutcome {
-		return fmt.Errorf("invalid outcome for this event")
+// lmsrLiquidity returns the event's b parameter, falling back to the default
+// for rows written without one.
+func lmsrLiquidity(event *models.Event) float64 {
+	if event.Liquidity > 0 {
+		return event.Liquidity
 	}
+	return DefaultLiquidity
+}
 
-	// Check if user already has a position on a different outcome for this event
-	existingPositions, err := e.Store.Positions.GetByUserAndEvent(userID, eventID)
-	if err != nil {
+// transact runs fn with a copy of the engine whose store writes are
+// committed together, or not at all if fn fails.
+func (e *Engine) transact(fn func(e *Engine) error) error {
+	return e.Store.Transact(func(s *store.Store) error {
+		tx := *e
+		tx.Store = s
+		return fn(&tx)
+	})
+}
+
+// Buy spends amount points on outcomeID and returns the shares received.
+func (e *Engine) Buy(userID, eventID, outcomeID, amount int) (float64, error) {
+	var shares float64
+	err := e.transact(func(e *Engine) (err error) {
+		shares, err = e.buy(userID, eventID, outcomeID, amount)
 		return err
-	}
-	for _, p := range existingPositions {
-		if p.OutcomeID != outcomeID {
-			return fmt.Errorf("you already bet on a different outcome for this event")
-		}
-	}
+	})
+	return shares, err
+}
 
-	// Calculate current price for avg_price tracking
-	odds, err := e.GetOdds(eventID)
+func (e *Engine) buy(userID, eventID, outcomeID, amount int) (float64, error) {
+	quote, err := e.QuoteBuy(userID, eventID, outcomeID, amount)
 	if err != nil {
-		return err
-	}
-	var currentPrice float64
-	for _, o := range odds {
-		if o.OutcomeID == outcomeID {
-			currentPrice = o.Odds / 100
-			break
-		}
-	}
-	if currentPrice == 0 {
-		currentPrice = 1.0 / float64(len(outcomes))
+		return 0, err
 	}
 
-	shares := float64(amount) // 1 point = 1 share
-
 	// Update or create position
-	pos, err := e.Store.Positions.GetByUserEventOutcome(userID, eventID, outcomeID)
-	if err != nil {
-		return err
-	}
+	pos := quote.position
 	if pos != nil {
 		// Update existing: recalculate avg price
-		totalCost := pos.AvgPrice*pos.Shares + currentPrice*shares
-		pos.Shares += shares
+		totalCost := pos.AvgPrice*pos.Shares + quote.AvgPrice*quote.Shares
+		pos.Shares += quote.Shares
 		pos.AvgPrice = totalCost / pos.Shares
 		if err := e.Store.Positions.Update(pos); err != nil {
-			return err
+			return 0, err
 		}
 	} else {
 		pos = &models.Position{
 			UserID:    userID,
 			EventID:   eventID,
 			OutcomeID: outcomeID,
-			Shares:    shares,
-			AvgPrice:  currentPrice,
+			Shares:    quote.Shares,
+			AvgPrice:  quote.AvgPrice,
 		}
 		if err := e.Store.Positions.Create(pos); err != nil {
-			return err
+			return 0, err
 		}
 	}
 
-	// Deduct balance
-	user.Balance -= amount
-	if err := e.Store.Users.Update(user); err != nil {
-		return err
-	}
-
-	// Record transaction
-	tx := &models.Transaction{
+	if _, err := e.Store.Post(&models.Transaction{
 		UserID:    userID,
 		EventID:   eventID,
 		OutcomeID: outcomeID,
 		TxType:    "buy",
-		Shares:    shares,
+		Shares:    quote.Shares,
 		Points:    amount,
+	}); err != nil {
+		return 0, err
 	}
-	return e.Store.Transactions.Create(tx)
+	return quote.Shares, nil
 }
 
-func (e *Engine) Sell(userID, eventID, outcomeID int, sharesToSell float64) (int, error) {
-	if sharesToSell <= 0 {
-		return 0, fmt.Errorf("shares must be positive")
-	}
-	if sharesToSell != math.Floor(sharesToSell) {
-		return 0, fmt.Errorf("shares must be a whole number")
+// checkOutcomeConflict rejects buying outcomeID if the user already holds a
+// position on a different outcome of the same event, unless the event allows
+// hedging.
+func (e *Engine) checkOutcomeConflict(event *models.Event, userID, outcomeID int) error {
+	if event.AllowHedging {
+		return nil
 	}
-
-	event, err := e.Store.Events.GetByID(eventID)
+	existingPositions, err := e.Store.Positions.GetByUserAndEvent(userID, event.ID)
 	if err != nil {
-		return 0, fmt.Errorf("event not found")
+		return err
 	}
-	if event.Status != "open" {
-		return 0, fmt.Errorf("event is not open for trading")
+	for _, p := range existingPositions {
+		if p.OutcomeID != outcomeID {
+			return fmt.Errorf("you already bet on a different outcome for this event")
+		}
 	}
+	return nil
+}
+
+// Sell sells shares of the user's position and returns the points paid.
+func (e *Engine) Sell(userID, eventID, outcomeID int, sharesToSell float64) (int, error) {
+	var points int
+	err := e.transact(func(e *Engine) (err error) {
+		points, err = e.sell(userID, eventID, outcomeID, sharesToSell)
+		return err
+	})
+	return points, err
+}
 
-	pos, err := e.Store.Positions.GetByUserEventOutcome(userID, eventID, outcomeID)
+func (e *Engine) sell(userID, eventID, outcomeID int, sharesToSell float64) (int, error) {
+	quote, err := e.QuoteSell(userID, eventID, outcomeID, sharesToSell)
 	if err != nil {
 		return 0, err
 	}
-	if pos == nil || pos.Shares < sharesToSell {
-		return 0, fmt.Errorf("insufficient shares")
-	}
-
-	// Seller gets 50% of share value back; the rest stays in the prize pool
-	fullValue := int(math.Floor(sharesToSell))
-	pointsBack := fullValue / 2
-	if pointsBack < 1 && sharesToSell > 0 {
-		pointsBack = 1
-	}
 
 	// Remove shares from user's position but keep them in the pool
 	// by not deleting from total shares — leave orphan shares so pool stays large
+	pos := quote.position
 	pos.Shares -= sharesToSell
 	if pos.Shares < 0.001 {
 		if err := e.Store.Positions.Delete(pos.ID); err != nil {
@@ -224,33 +217,37 @@ func (e *Engine) Sell(userID, eventID, outcomeID int, sharesToSell float64) (int
 		}
 	}
 
-	// Credit user with 50%
-	user, err := e.Store.Users.GetByID(userID)
-	if err != nil {
-		return 0, err
-	}
-	user.Balance += pointsBack
-	if err := e.Store.Users.Update(user); err != nil {
-		return 0, err
-	}
-
-	// Record transaction
-	tx := &models.Transaction{
+	if _, err := e.Store.Post(&models.Transaction{
 		UserID:    userID,
 		EventID:   eventID,
 		OutcomeID: outcomeID,
 		TxType:    "sell",
 		Shares:    sharesToSell,
-		Points:    pointsBack,
-	}
-	if err := e.Store.Transactions.Create(tx); err != nil {
+		Points:    quote.Points,
+	}); err != nil {
 		return 0, err
 	}
 
-	return pointsBack, nil
+	return quote.Points, nil
 }
 
-func (e *Engine) Resolve(eventID, winningOutcomeID int) (*ResolveResult, error) {
+// Resolve settles the event. resolution lists the winning outcomes with the
+// share of the payout each one gets; weights are normalized to sum to 1, so
+// a tie can be passed as equal weights. Pool events split the pot between
+// the winning outcomes by weight, then between each outcome's holders by
+// shares. LMSR events pay every winning share its outcome's weight in points.
+// The bonus is paid on every winning position. Scalar events are paid
+// linearly instead; see ResolveScalar.
+func (e *Engine) Resolve(eventID int, resolution []models.ResolutionWeight) (*ResolveResult, error) {
+	var result *ResolveResult
+	err := e.transact(func(e *Engine) (err error) {
+		result, err = e.resolve(eventID, resolution)
+		return err
+	})
+	return result, err
+}
+
+func (e *Engine) resolve(eventID int, resolution []models.ResolutionWeight) (*ResolveResult, error) {
 	event, err := e.Store.Events.GetByID(eventID)
 	if err != nil {
 		return nil, fmt.Errorf("event not found")
@@ -258,6 +255,14 @@ func (e *Engine) Resolve(eventID, winningOutcomeID int) (*ResolveResult, error)
 	if event.Status == "resolved" {
 		return nil, fmt.Errorf("event already resolved")
 	}
+	resolution, err = e.normalizeResolution(eventID, resolution)
+	if err != nil {
+		return nil, err
+	}
+	weights := make(map[int]float64)
+	for _, r := range resolution {
+		weights[r.OutcomeID] = r.Weight
+	}
 
 	positions, err := e.Store.Positions.GetByEventID(eventID)
 	if err != nil {
@@ -266,113 +271,164 @@ func (e *Engine) Resolve(eventID, winningOutcomeID int) (*ResolveResult, error)
 
 	result := &ResolveResult{}
 
-	// Calculate total pool and winning shares
+	// Calculate total pool and winning shares per winning outcome
 	var totalPool float64
-	var winningShares float64
+	winningShares := make(map[int]float64)
 	for _, p := range positions {
 		totalPool += p.Shares
-		if p.OutcomeID == winningOutcomeID {
-			winningShares += p.Shares
+		if weights[p.OutcomeID] > 0 {
+			winningShares[p.OutcomeID] += p.Shares
 		}
 	}
 
-	// Track which users we've already recorded (a user may have multiple positions)
-	seen := make(map[int]bool)
+	// In pool mode the weight of a winning outcome nobody holds goes to the
+	// winning outcomes that are held
+	var heldWeight float64
+	for outcomeID, w := range weights {
+		if winningShares[outcomeID] > 0 {
+			heldWeight += w
+		}
+	}
+
+	// A user may have multiple positions; merge them into one outcome each
+	userIdx := make(map[int]int)
+	record := func(userID, payout int, won, refund bool) {
+		i, ok := userIdx[userID]
+		if !ok {
+			userIdx[userID] = len(result.UserOutcomes)
+			result.UserOutcomes = append(result.UserOutcomes, UserOutcome{UserID: userID})
+			i = len(result.UserOutcomes) - 1
+		}
+		uo := &result.UserOutcomes[i]
+		uo.Payout += payout
+		uo.Won = uo.Won || won
+		uo.Refund = uo.Refund || refund
+	}
+
+	// LMSR winners are paid by the market maker, so losers are never refunded
+	lmsr := event.PricingModel == "lmsr"
+	// Scalar sides are paid their weight of the pool whether or not the
+	// other side is held, so neither is refunded either
+	scalar := event.EventType == "scalar"
+	rules := e.RulesFor(event)
 
 	if totalPool > 0 {
-		if winningShares == 0 {
-			// No one bet on the winner - refund everyone proportionally
+		if heldWeight == 0 && !lmsr && !scalar {
+			// No one bet on a winner - refund everyone proportionally
 			for _, p := range positions {
-				user, err := e.Store.Users.GetByID(p.UserID)
-				if err != nil {
-					continue
-				}
 				refund := int(math.Round(p.Shares))
-				user.Balance += refund
-				e.Store.Users.Update(user)
-				e.Store.Transactions.Create(&models.Transaction{
+				if _, err := e.Store.Post(&models.Transaction{
 					UserID:    p.UserID,
 					EventID:   eventID,
 					OutcomeID: p.OutcomeID,
 					TxType:    "payout",
 					Shares:    p.Shares,
 					Points:    refund,
-				})
-				if !seen[p.UserID] {
-					seen[p.UserID] = true
-					result.UserOutcomes = append(result.UserOutcomes, UserOutcome{
-						UserID: p.UserID,
-						Won:    false,
-						Payout: refund,
-						Refund: true,
-					})
+				}); err != nil {
+					return nil, err
 				}
+				record(p.UserID, refund, false, true)
 			}
 		} else {
-			// Record losers
+			// Distribute pool to winners by weight and shares (LMSR: weight
+			// pts per share), plus the win bonus
 			for _, p := range positions {
-				if p.OutcomeID == winningOutcomeID {
+				w := weights[p.OutcomeID]
+				if w == 0 || (!lmsr && winningShares[p.OutcomeID] == 0) {
+					record(p.UserID, 0, false, false)
 					continue
 				}
-				if !seen[p.UserID] {
-					seen[p.UserID] = true
-					result.UserOutcomes = append(result.UserOutcomes, UserOutcome{
-						UserID: p.UserID,
-						Won:    false,
-						Payout: 0,
-						Refund: false,
-					})
+				var payout int
+				switch {
+				case lmsr:
+					payout = int(math.Round(p.Shares * w))
+				case scalar:
+					payout = int(math.Round(totalPool * w * (p.Shares / winningShares[p.OutcomeID])))
+				default:
+					payout = int(math.Round(totalPool * (w / heldWeight) * (p.Shares / winningShares[p.OutcomeID])))
 				}
-			}
-
-			// Distribute pool to winners proportionally + 25% of bet + 20pt bonus
-			for _, p := range positions {
-				if p.OutcomeID != winningOutcomeID {
-					continue
+				bonus := rules.WinBonus(p.Shares)
+				if scalar {
+					bonus = int(math.Round(float64(bonus) * w))
 				}
-				user, err := e.Store.Users.GetByID(p.UserID)
-				if err != nil {
-					continue
-				}
-				payout := int(math.Round(totalPool * (p.Shares / winningShares)))
-				bonus := int(math.Round(p.Shares*0.25)) + 20
-				user.Balance += payout + bonus
-				e.Store.Users.Update(user)
-				e.Store.Transactions.Create(&models.Transaction{
+				if _, err := e.Store.Post(&models.Transaction{
 					UserID:    p.UserID,
 					EventID:   eventID,
 					OutcomeID: p.OutcomeID,
 					TxType:    "payout",
 					Shares:    p.Shares,
 					Points:    payout,
-				})
-				e.Store.Transactions.Create(&models.Transaction{
+				}); err != nil {
+					return nil, err
+				}
+				if _, err := e.Store.Post(&models.Transaction{
 					UserID:    p.UserID,
 					EventID:   eventID,
 					OutcomeID: p.OutcomeID,
 					TxType:    "bonus",
 					Shares:    0,
 					Points:    bonus,
-				})
-				if !seen[p.UserID] {
-					seen[p.UserID] = true
-					result.UserOutcomes = append(result.UserOutcomes, UserOutcome{
-						UserID: p.UserID,
-						Won:    true,
-						Payout: payout + bonus,
-						Refund: false,
-					})
+				}); err != nil {
+					return nil, err
 				}
+				record(p.UserID, payout+bonus, true, false)
 			}
 		}
 	}
 
-	// Clean up positions
-	e.Store.Positions.DeleteByEventID(eventID)
+	// Archive positions so an unresolve can restore them, then clean up
+	// positions and any orders still resting on the book
+	if err := e.archivePositions(eventID, positions); err != nil {
+		return nil, err
+	}
+	if err := e.Store.Positions.DeleteByEventID(eventID); err != nil {
+		return nil, err
+	}
+	if _, err := e.CancelEventOrders(eventID); err != nil {
+		return nil, err
+	}
 
 	// Update event status
 	event.Status = "resolved"
-	event.WinningOutcomeID = winningOutcomeID
+	event.Resolution = resolution
 	event.ResolvedAt = time.Now().Format(time.RFC3339)
 	return result, e.Store.Events.Update(event)
 }
+
+// normalizeResolution checks that every outcome belongs to the event and
+// appears once with a positive weight, and scales the weights to sum to 1.
+func (e *Engine) normalizeResolution(eventID int, resolution []models.ResolutionWeight) ([]models.ResolutionWeight, error) {
+	if len(resolution) == 0 {
+		return nil, fmt.Errorf("at least one winning outcome is required")
+	}
+	outcomes, err := e.Store.Outcomes.GetByEventID(eventID)
+	if err != nil {
+		return nil, err
+	}
+	valid := make(map[int]bool)
+	for _, o := range outcomes {
+		valid[o.ID] = true
+	}
+
+	seen := make(map[int]bool)
+	var total float64
+	for _, r := range resolution {
+		if !valid[r.OutcomeID] {
+			return nil, fmt.Errorf("invalid outcome for this event")
+		}
+		if seen[r.OutcomeID] {
+			return nil, fmt.Errorf("outcome %d appears twice in the resolution", r.OutcomeID)
+		}
+		if r.Weight <= 0 {
+			return nil, fmt.Errorf("weights must be positive")
+		}
+		seen[r.OutcomeID] = true
+		total += r.Weight
+	}
+
+	normalized := make([]models.ResolutionWeight, len(resolution))
+	for i, r := range resolution {
+		normalized[i] = models.ResolutionWeight{OutcomeID: r.OutcomeID, Weight: r.Weight / total}
+	}
+	return normalized, nil
+}
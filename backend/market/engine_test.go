@@ -0,0 +1,235 @@
+package market
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"pauls-bach/models"
+	"pauls-bach/store"
+)
+
+// testRules pay no win bonus, so payouts can be checked on their own.
+var testRules = Rules{SellPayout: 0.5, BountyBettors: 1}
+
+func newTestEngine(t *testing.T) *Engine {
+	t.Helper()
+	s, err := store.Open("csv", t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return &Engine{Store: s, Rules: testRules}
+}
+
+// addUser creates a user with the starting balance and returns its ID.
+func addUser(t *testing.T, e *Engine, name string) int {
+	t.Helper()
+	u := &models.User{Username: name}
+	if err := e.Store.Users.Create(u); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Store.Post(&models.Transaction{UserID: u.ID, TxType: "grant", Points: models.StartingBalance}); err != nil {
+		t.Fatal(err)
+	}
+	return u.ID
+}
+
+// addEvent creates an open event with the given outcomes and returns their
+// IDs.
+func addEvent(t *testing.T, e *Engine, event *models.Event, labels ...string) []int {
+	t.Helper()
+	event.Status = "open"
+	if event.PricingModel == "" {
+		event.PricingModel = "pool"
+	}
+	if err := e.Store.Events.Create(event); err != nil {
+		t.Fatal(err)
+	}
+	var ids []int
+	for _, label := range labels {
+		o := &models.Outcome{EventID: event.ID, Label: label}
+		if err := e.Store.Outcomes.Create(o); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, o.ID)
+	}
+	return ids
+}
+
+func buy(t *testing.T, e *Engine, userID, eventID, outcomeID, amount int) float64 {
+	t.Helper()
+	shares, err := e.Buy(userID, eventID, outcomeID, amount)
+	if err != nil {
+		t.Fatalf("buy %d on outcome %d: %v", amount, outcomeID, err)
+	}
+	return shares
+}
+
+func balance(t *testing.T, e *Engine, userID int) int {
+	t.Helper()
+	u, err := e.Store.Users.GetByID(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Balance
+}
+
+// payouts returns what result paid each user.
+func payouts(result *ResolveResult) map[int]int {
+	paid := make(map[int]int)
+	for _, uo := range result.UserOutcomes {
+		paid[uo.UserID] = uo.Payout
+	}
+	return paid
+}
+
+func TestResolvePoolWeights(t *testing.T) {
+	// a, b and c stake 100, 50 and 50 on outcomes 0, 1 and 2; nobody holds 3
+	tests := []struct {
+		name       string
+		resolution map[int]float64 // outcome index -> weight
+		want       [3]int
+	}{
+		{"single winner", map[int]float64{0: 1}, [3]int{200, 0, 0}},
+		{"even tie", map[int]float64{0: 1, 1: 1}, [3]int{100, 100, 0}},
+		{"weighted", map[int]float64{0: 3, 1: 1}, [3]int{150, 50, 0}},
+		{"unheld winner's weight goes to held ones", map[int]float64{1: 1, 3: 1}, [3]int{0, 200, 0}},
+		{"no held winner refunds everyone", map[int]float64{3: 1}, [3]int{100, 50, 50}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestEngine(t)
+			event := &models.Event{Title: "E", EventType: "multi"}
+			outcomes := addEvent(t, e, event, "A", "B", "C", "D")
+			users := [3]int{addUser(t, e, "a"), addUser(t, e, "b"), addUser(t, e, "c")}
+			for i, amount := range []int{100, 50, 50} {
+				buy(t, e, users[i], event.ID, outcomes[i], amount)
+			}
+
+			var resolution []models.ResolutionWeight
+			for i, w := range tt.resolution {
+				resolution = append(resolution, models.ResolutionWeight{OutcomeID: outcomes[i], Weight: w})
+			}
+			result, err := e.Resolve(event.ID, resolution)
+			if err != nil {
+				t.Fatal(err)
+			}
+			paid := payouts(result)
+			for i, userID := range users {
+				if paid[userID] != tt.want[i] {
+					t.Errorf("user %d paid %d, want %d", i, paid[userID], tt.want[i])
+				}
+			}
+			if left, _ := e.Store.Positions.GetByEventID(event.ID); len(left) != 0 {
+				t.Errorf("%d positions left after resolving", len(left))
+			}
+		})
+	}
+}
+
+// Every winning position gets the win bonus, whatever its outcome's weight,
+// and the event keeps the whole resolution.
+func TestResolveBonusAndResolution(t *testing.T) {
+	e := newTestEngine(t)
+	e.Rules.WinBonusRate = 0.25
+	e.Rules.WinBonusFlat = 20
+	event := &models.Event{Title: "E", EventType: "multi"}
+	outcomes := addEvent(t, e, event, "A", "B", "C")
+	a, b, c := addUser(t, e, "a"), addUser(t, e, "b"), addUser(t, e, "c")
+	buy(t, e, a, event.ID, outcomes[0], 100)
+	buy(t, e, b, event.ID, outcomes[1], 50)
+	buy(t, e, c, event.ID, outcomes[2], 50)
+
+	result, err := e.Resolve(event.ID, []models.ResolutionWeight{
+		{OutcomeID: outcomes[0], Weight: 3},
+		{OutcomeID: outcomes[1], Weight: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Payout plus 0.25 a share and 20 flat
+	want := map[int]int{a: 150 + 25 + 20, b: 50 + 13 + 20, c: 0}
+	paid := payouts(result)
+	for userID, points := range want {
+		if paid[userID] != points {
+			t.Errorf("user %d paid %d, want %d", userID, paid[userID], points)
+		}
+	}
+	for _, uo := range result.UserOutcomes {
+		if uo.Won != (uo.UserID != c) {
+			t.Errorf("user %d won %v", uo.UserID, uo.Won)
+		}
+	}
+
+	resolved, err := e.Store.Events.GetByID(event.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantResolution := []models.ResolutionWeight{{OutcomeID: outcomes[0], Weight: 0.75}, {OutcomeID: outcomes[1], Weight: 0.25}}
+	if !reflect.DeepEqual(resolved.Resolution, wantResolution) {
+		t.Errorf("stored resolution %+v, want %+v", resolved.Resolution, wantResolution)
+	}
+}
+
+func TestResolveRejectsBadResolutions(t *testing.T) {
+	e := newTestEngine(t)
+	event := &models.Event{Title: "E", EventType: "binary"}
+	outcomes := addEvent(t, e, event, "Yes", "No")
+	other := addEvent(t, e, &models.Event{Title: "F", EventType: "binary"}, "Yes", "No")
+
+	for name, resolution := range map[string][]models.ResolutionWeight{
+		"empty":       nil,
+		"other event": {{OutcomeID: other[0], Weight: 1}},
+		"duplicate":   {{OutcomeID: outcomes[0], Weight: 1}, {OutcomeID: outcomes[0], Weight: 1}},
+		"zero weight": {{OutcomeID: outcomes[0], Weight: 0}},
+		"negative":    {{OutcomeID: outcomes[0], Weight: 2}, {OutcomeID: outcomes[1], Weight: -1}},
+		"unknown":     {{OutcomeID: 999, Weight: 1}},
+	} {
+		if _, err := e.Resolve(event.ID, resolution); err == nil {
+			t.Errorf("%s: resolved", name)
+		}
+	}
+}
+
+func TestResolveLMSR(t *testing.T) {
+	e := newTestEngine(t)
+	event := &models.Event{Title: "E", EventType: "binary", PricingModel: "lmsr", Liquidity: 100}
+	outcomes := addEvent(t, e, event, "Yes", "No")
+	a, b := addUser(t, e, "a"), addUser(t, e, "b")
+	aShares := buy(t, e, a, event.ID, outcomes[0], 100)
+	buy(t, e, b, event.ID, outcomes[1], 40)
+
+	result, err := e.Resolve(event.ID, []models.ResolutionWeight{{OutcomeID: outcomes[0], Weight: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	paid := payouts(result)
+	// A winning LMSR share pays 1 point; losers get nothing back
+	if want := int(math.Round(aShares)); paid[a] != want {
+		t.Errorf("winner paid %d, want %d", paid[a], want)
+	}
+	if paid[b] != 0 {
+		t.Errorf("loser paid %d, want 0", paid[b])
+	}
+	if got, want := balance(t, e, a), models.StartingBalance-100+int(math.Round(aShares)); got != want {
+		t.Errorf("winner's balance %d, want %d", got, want)
+	}
+}
+
+func TestCostBasis(t *testing.T) {
+	tests := []struct {
+		pricing string
+		p       models.Position
+		want    float64
+	}{
+		{"pool", models.Position{Shares: 40, AvgPrice: 0.25}, 40},
+		{"lmsr", models.Position{Shares: 40, AvgPrice: 0.6}, 24},
+		{"lmsr", models.Position{Shares: 0, AvgPrice: 0.6}, 0},
+	}
+	for _, tt := range tests {
+		if got := CostBasis(&models.Event{PricingModel: tt.pricing}, &tt.p); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s %+v: cost basis %v, want %v", tt.pricing, tt.p, got, tt.want)
+		}
+	}
+}
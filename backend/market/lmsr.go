@@ -0,0 +1,81 @@
+package market
+
+import "math"
+
+// Hanson's Logarithmic Market Scoring Rule. q holds the outstanding shares per
+// outcome and b is the liquidity parameter: the larger b, the more points it
+// takes to move the price. All functions use the softmax form so large share
+// counts don't overflow math.Exp.
+
+// DefaultLiquidity is used for LMSR events created without an explicit b.
+const DefaultLiquidity = 100.0
+
+// lmsrCost returns C(q) = b * ln(sum(exp(q_i / b))).
+func lmsrCost(q []float64, b float64) float64 {
+	m := maxShares(q)
+	var sum float64
+	for _, qi := range q {
+		sum += math.Exp((qi - m) / b)
+	}
+	return m + b*math.Log(sum)
+}
+
+// lmsrPrices returns the instantaneous price of each outcome. Prices are in
+// (0, 1) and sum to 1.
+func lmsrPrices(q []float64, b float64) []float64 {
+	m := maxShares(q)
+	prices := make([]float64, len(q))
+	var sum float64
+	for i, qi := range q {
+		prices[i] = math.Exp((qi - m) / b)
+		sum += prices[i]
+	}
+	for i := range prices {
+		prices[i] /= sum
+	}
+	return prices
+}
+
+// lmsrSharesForCost returns how many shares of outcome i can be bought for
+// cost points, i.e. the d solving C(q + d*e_i) - C(q) = cost.
+func lmsrSharesForCost(q []float64, b float64, i int, cost float64) float64 {
+	if cost <= 0 {
+		return 0
+	}
+	logP := lmsrLogPrice(q, b, i)
+	x := cost / b
+	// d = b * ln((exp(x) - 1) / p + 1), rewritten to stay finite for large x
+	// and for prices that underflow to zero
+	ex := math.Exp(-x)
+	return b * (x - logP + math.Log((1-ex)+ex*math.Exp(logP)))
+}
+
+// lmsrSellValue returns the points paid out for selling shares of outcome i,
+// i.e. C(q) - C(q - shares*e_i).
+func lmsrSellValue(q []float64, b float64, i int, shares float64) float64 {
+	if shares <= 0 {
+		return 0
+	}
+	p := lmsrPrices(q, b)[i]
+	return -b * math.Log1p(p*math.Expm1(-shares/b))
+}
+
+// lmsrLogPrice returns ln(p_i) without underflowing for very unlikely outcomes.
+func lmsrLogPrice(q []float64, b float64, i int) float64 {
+	m := maxShares(q)
+	var sum float64
+	for _, qj := range q {
+		sum += math.Exp((qj - m) / b)
+	}
+	return (q[i]-m)/b - math.Log(sum)
+}
+
+func maxShares(q []float64) float64 {
+	m := 0.0
+	for i, qi := range q {
+		if i == 0 || qi > m {
+			m = qi
+		}
+	}
+	return m
+}
@@ -0,0 +1,95 @@
+package market
+
+import (
+	"math"
+	"testing"
+)
+
+func TestLMSRCost(t *testing.T) {
+	tests := []struct {
+		name string
+		q    []float64
+		b    float64
+		want float64
+	}{
+		{"empty binary", []float64{0, 0}, 100, 100 * math.Log(2)},
+		{"empty three-way", []float64{0, 0, 0}, 50, 50 * math.Log(3)},
+		{"lopsided", []float64{100, 0}, 100, 100 * math.Log(math.E+1)},
+		// Naively exp(q/b) overflows here
+		{"huge", []float64{1e6, 0}, 10, 1e6 + 10*math.Log1p(math.Exp(-1e5))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lmsrCost(tt.q, tt.b); math.Abs(got-tt.want) > 1e-9*math.Max(1, tt.want) {
+				t.Errorf("lmsrCost(%v, %v) = %v, want %v", tt.q, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLMSRPrices(t *testing.T) {
+	tests := []struct {
+		name string
+		q    []float64
+		b    float64
+		want []float64
+	}{
+		{"empty", []float64{0, 0}, 100, []float64{0.5, 0.5}},
+		{"one b ahead", []float64{100, 0}, 100, []float64{math.E / (math.E + 1), 1 / (math.E + 1)}},
+		{"three-way", []float64{0, 0, 0}, 10, []float64{1.0 / 3, 1.0 / 3, 1.0 / 3}},
+		{"huge", []float64{1e6, 0}, 10, []float64{1, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := lmsrPrices(tt.q, tt.b)
+			var sum float64
+			for i := range got {
+				sum += got[i]
+				if math.Abs(got[i]-tt.want[i]) > 1e-9 {
+					t.Errorf("lmsrPrices(%v, %v) = %v, want %v", tt.q, tt.b, got, tt.want)
+					break
+				}
+			}
+			if math.Abs(sum-1) > 1e-9 {
+				t.Errorf("prices sum to %v, want 1", sum)
+			}
+		})
+	}
+}
+
+// Buying for cost points and selling what was bought moves the cost function
+// by exactly cost each way.
+func TestLMSRTradesFollowCostCurve(t *testing.T) {
+	tests := []struct {
+		q    []float64
+		b    float64
+		i    int
+		cost float64
+	}{
+		{[]float64{0, 0}, 100, 0, 10},
+		{[]float64{0, 0}, 100, 1, 500},
+		{[]float64{250, 10, 40}, 50, 1, 75},
+		{[]float64{2000, 0}, 100, 1, 5}, // price of outcome 1 is ~2e-9
+	}
+	for _, tt := range tests {
+		shares := lmsrSharesForCost(tt.q, tt.b, tt.i, tt.cost)
+		after := append([]float64(nil), tt.q...)
+		after[tt.i] += shares
+		if got := lmsrCost(after, tt.b) - lmsrCost(tt.q, tt.b); math.Abs(got-tt.cost) > 1e-6 {
+			t.Errorf("q=%v: buying %v shares of %d cost %v, want %v", tt.q, shares, tt.i, got, tt.cost)
+		}
+		if got := lmsrSellValue(after, tt.b, tt.i, shares); math.Abs(got-tt.cost) > 1e-6 {
+			t.Errorf("q=%v: selling them back returns %v, want %v", tt.q, got, tt.cost)
+		}
+		if shares < tt.cost {
+			t.Errorf("q=%v: %v points bought only %v shares; prices are below 1", tt.q, tt.cost, shares)
+		}
+	}
+
+	if got := lmsrSharesForCost([]float64{0, 0}, 100, 0, 0); got != 0 {
+		t.Errorf("lmsrSharesForCost with no cost = %v, want 0", got)
+	}
+	if got := lmsrSellValue([]float64{10, 0}, 100, 0, 0); got != 0 {
+		t.Errorf("lmsrSellValue of no shares = %v, want 0", got)
+	}
+}
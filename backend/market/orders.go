@@ -0,0 +1,379 @@
+package market
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"pauls-bach/models"
+)
+
+// PlaceOrder validates and stores a resting limit order. Its points (buy) or
+// shares (sell) stay reserved until it fills, is cancelled or expires.
+func (e *Engine) PlaceOrder(o *models.Order) error {
+	if o.Side != "buy" && o.Side != "sell" {
+		return fmt.Errorf("side must be 'buy' or 'sell'")
+	}
+	if o.LimitPrice <= 0 || o.LimitPrice >= 100 {
+		return fmt.Errorf("limit_price must be between 0 and 100")
+	}
+	if o.ExpiresAt != "" {
+		expires, err := time.Parse(time.RFC3339, o.ExpiresAt)
+		if err != nil {
+			return fmt.Errorf("expires_at must be an RFC3339 timestamp")
+		}
+		if !expires.After(time.Now()) {
+			return fmt.Errorf("expires_at must be in the future")
+		}
+	}
+
+	event, err := e.Store.Events.GetByID(o.EventID)
+	if err != nil {
+		return fmt.Errorf("event not found")
+	}
+	if err := checkTradable(event); err != nil {
+		return err
+	}
+
+	outcomes, err := e.Store.Outcomes.GetByEventID(o.EventID)
+	if err != nil {
+		return err
+	}
+	validOutcome := false
+	for _, oc := range outcomes {
+		if oc.ID == o.OutcomeID {
+			validOutcome = true
+			break
+		}
+	}
+	if !validOutcome {
+		return fmt.Errorf("invalid outcome for this event")
+	}
+
+	switch o.Side {
+	case "buy":
+		if o.Amount <= 0 {
+			return fmt.Errorf("amount must be positive")
+		}
+		o.Shares = 0
+		user, err := e.Store.Users.GetByID(o.UserID)
+		if err != nil {
+			return fmt.Errorf("user not found")
+		}
+		reserved, err := e.ReservedPoints(o.UserID)
+		if err != nil {
+			return err
+		}
+		if user.Balance-reserved < o.Amount {
+			return fmt.Errorf("insufficient balance")
+		}
+		if err := e.checkOutcomeConflict(event, o.UserID, o.OutcomeID); err != nil {
+			return err
+		}
+	case "sell":
+		if o.Shares <= 0 {
+			return fmt.Errorf("shares must be positive")
+		}
+		if event.PricingModel != "lmsr" && o.Shares != math.Floor(o.Shares) {
+			return fmt.Errorf("shares must be a whole number")
+		}
+		o.Amount = 0
+		pos, err := e.Store.Positions.GetByUserEventOutcome(o.UserID, o.EventID, o.OutcomeID)
+		if err != nil {
+			return err
+		}
+		reserved, err := e.reservedShares(o.UserID, o.EventID, o.OutcomeID)
+		if err != nil {
+			return err
+		}
+		if pos == nil || pos.Shares-reserved < o.Shares {
+			return fmt.Errorf("insufficient shares")
+		}
+	}
+
+	o.Status = "open"
+	o.FilledShares = 0
+	o.FilledPoints = 0
+	o.ClosedAt = ""
+	return e.Store.Orders.Create(o)
+}
+
+// CancelOrder cancels one of the user's open orders and releases its reservation.
+func (e *Engine) CancelOrder(userID, orderID int) (*models.Order, error) {
+	o, err := e.Store.Orders.GetByID(orderID)
+	if err != nil || o.UserID != userID {
+		return nil, fmt.Errorf("order not found")
+	}
+	if o.Status != "open" {
+		return nil, fmt.Errorf("order is not open")
+	}
+	return o, e.closeOrder(o, "cancelled")
+}
+
+// CancelEventOrders cancels every open order on the event, e.g. when it stops
+// trading. It returns the cancelled orders.
+func (e *Engine) CancelEventOrders(eventID int) ([]models.Order, error) {
+	orders, err := e.Store.Orders.GetOpenByEventID(eventID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range orders {
+		if err := e.closeOrder(&orders[i], "cancelled"); err != nil {
+			return nil, err
+		}
+	}
+	return orders, nil
+}
+
+// ExpireOrders closes every open order whose expiry is before now and returns them.
+func (e *Engine) ExpireOrders(now time.Time) ([]models.Order, error) {
+	orders, err := e.Store.Orders.GetOpen()
+	if err != nil {
+		return nil, err
+	}
+	var expired []models.Order
+	for _, o := range orders {
+		if !orderExpired(&o, now) {
+			continue
+		}
+		if err := e.closeOrder(&o, "expired"); err != nil {
+			return expired, err
+		}
+		expired = append(expired, o)
+	}
+	return expired, nil
+}
+
+// minFill is the smallest part of an order that's traded; sell orders with
+// less than this many shares left count as filled, as positions with less
+// count as empty.
+const minFill = 0.001
+
+// MatchOrders fills the event's open orders whose limit price has been
+// crossed by the current odds, oldest first. An order only fills as far as
+// it can without moving the odds past its limit, and rests with the rest
+// (see fillable). Every fill moves the odds, so the book is re-checked
+// after each one. Orders that can no longer be executed (e.g. the user's
+// balance was lowered by an admin) are cancelled. It returns every order
+// it filled, in part or in full, or closed.
+func (e *Engine) MatchOrders(eventID int) ([]models.Order, error) {
+	orders, err := e.Store.Orders.GetOpenByEventID(eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var changed []models.Order
+	var pending []models.Order
+	for _, o := range orders {
+		if orderExpired(&o, now) {
+			if err := e.closeOrder(&o, "expired"); err != nil {
+				return changed, err
+			}
+			changed = append(changed, o)
+			continue
+		}
+		pending = append(pending, o)
+	}
+
+	for len(pending) > 0 {
+		odds, err := e.GetOdds(eventID)
+		if err != nil {
+			return changed, err
+		}
+		idx := -1
+		var size float64
+		for i := range pending {
+			if !limitCrossed(&pending[i], odds) {
+				continue
+			}
+			if size, err = e.fillable(&pending[i]); err != nil {
+				return changed, err
+			}
+			if size > 0 {
+				idx = i
+				break
+			}
+		}
+		if idx < 0 {
+			break
+		}
+
+		// What's left of a partly filled order waits for the odds to move
+		// back, so it's done either way
+		o := pending[idx]
+		pending = append(pending[:idx], pending[idx+1:]...)
+		if err := e.fillOrder(&o, size); err != nil {
+			if err := e.closeOrder(&o, "cancelled"); err != nil {
+				return changed, err
+			}
+		}
+		changed = append(changed, o)
+	}
+	return changed, nil
+}
+
+// fillable returns how much of the order can trade now without moving its
+// outcome's odds past the limit: points for a buy, shares for a sell. Buys
+// fill in whole points, as do sells on pool events.
+func (e *Engine) fillable(o *models.Order) (float64, error) {
+	event, err := e.Store.Events.GetByID(o.EventID)
+	if err != nil {
+		return 0, err
+	}
+	outcomes, err := e.Store.Outcomes.GetByEventID(o.EventID)
+	if err != nil {
+		return 0, err
+	}
+	idx := outcomeIndex(outcomes, o.OutcomeID)
+	if idx < 0 {
+		return 0, fmt.Errorf("invalid outcome for this event")
+	}
+	q, err := e.outcomeShares(o.EventID, outcomes)
+	if err != nil {
+		return 0, err
+	}
+
+	lmsr := event.PricingModel == "lmsr"
+	within := func(size float64) bool {
+		after := append([]float64(nil), q...)
+		switch {
+		case o.Side == "sell":
+			after[idx] -= size
+		case lmsr:
+			after[idx] += lmsrSharesForCost(q, lmsrLiquidity(event), idx, size)
+		default:
+			after[idx] += size
+		}
+		return limitCrossed(o, oddsFor(event, outcomes, after))
+	}
+
+	remaining := o.Remaining()
+	if within(remaining) {
+		return remaining, nil
+	}
+	step := 1.0
+	if o.Side == "sell" && lmsr {
+		step = minFill
+	}
+	// The odds move monotonically with the size of the trade
+	lo, hi := 0, int(math.Floor(remaining/step))
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if within(float64(mid) * step) {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	return float64(lo) * step, nil
+}
+
+// fillOrder trades size of the order (see fillable). The trade and the
+// order's new state are written together; if the trade fails the order is
+// left as it was.
+func (e *Engine) fillOrder(o *models.Order, size float64) error {
+	filled := *o
+	err := e.transact(func(e *Engine) error {
+		return e.executeOrder(&filled, size)
+	})
+	if err == nil {
+		*o = filled
+	}
+	return err
+}
+
+func (e *Engine) executeOrder(o *models.Order, size float64) error {
+	// Close the order first so its own reservation doesn't block the trade
+	o.Status = "filled"
+	if err := e.Store.Orders.Update(o); err != nil {
+		return err
+	}
+
+	switch o.Side {
+	case "buy":
+		amount := int(size)
+		shares, err := e.buy(o.UserID, o.EventID, o.OutcomeID, amount)
+		if err != nil {
+			return err
+		}
+		o.FilledShares += shares
+		o.FilledPoints += amount
+	case "sell":
+		points, err := e.sell(o.UserID, o.EventID, o.OutcomeID, size)
+		if err != nil {
+			return err
+		}
+		o.FilledShares += size
+		o.FilledPoints += points
+	}
+
+	if o.Remaining() >= minFill {
+		o.Status = "open"
+	} else {
+		o.ClosedAt = time.Now().Format(time.RFC3339)
+	}
+	return e.Store.Orders.Update(o)
+}
+
+func (e *Engine) closeOrder(o *models.Order, status string) error {
+	o.Status = status
+	o.ClosedAt = time.Now().Format(time.RFC3339)
+	return e.Store.Orders.Update(o)
+}
+
+// ReservedPoints returns the points held back by the user's open buy orders.
+func (e *Engine) ReservedPoints(userID int) (int, error) {
+	orders, err := e.Store.Orders.GetOpenByUserID(userID)
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	reserved := 0
+	for _, o := range orders {
+		if o.Side == "buy" && !orderExpired(&o, now) {
+			reserved += o.Amount - o.FilledPoints
+		}
+	}
+	return reserved, nil
+}
+
+// reservedShares returns the shares of one outcome held back by the user's
+// open sell orders.
+func (e *Engine) reservedShares(userID, eventID, outcomeID int) (float64, error) {
+	orders, err := e.Store.Orders.GetOpenByUserID(userID)
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	var reserved float64
+	for _, o := range orders {
+		if o.Side == "sell" && o.EventID == eventID && o.OutcomeID == outcomeID && !orderExpired(&o, now) {
+			reserved += o.Remaining()
+		}
+	}
+	return reserved, nil
+}
+
+func orderExpired(o *models.Order, now time.Time) bool {
+	if o.ExpiresAt == "" {
+		return false
+	}
+	expires, err := time.Parse(time.RFC3339, o.ExpiresAt)
+	return err == nil && !expires.After(now)
+}
+
+// limitCrossed reports whether the order's outcome is trading at or better
+// than its limit: at or below it for buys, at or above it for sells.
+func limitCrossed(o *models.Order, odds []OutcomeOdds) bool {
+	for _, od := range odds {
+		if od.OutcomeID != o.OutcomeID {
+			continue
+		}
+		if o.Side == "buy" {
+			return od.Odds <= o.LimitPrice
+		}
+		return od.Odds >= o.LimitPrice
+	}
+	return false
+}
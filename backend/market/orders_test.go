@@ -0,0 +1,134 @@
+package market
+
+import (
+	"math"
+	"testing"
+
+	"pauls-bach/models"
+)
+
+func placeOrder(t *testing.T, e *Engine, o *models.Order) *models.Order {
+	t.Helper()
+	if err := e.PlaceOrder(o); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.MatchOrders(o.EventID); err != nil {
+		t.Fatal(err)
+	}
+	got, err := e.Store.Orders.GetByID(o.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
+
+func odds(t *testing.T, e *Engine, eventID, outcomeID int) float64 {
+	t.Helper()
+	all, err := e.GetOdds(eventID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, o := range all {
+		if o.OutcomeID == outcomeID {
+			return o.Odds
+		}
+	}
+	t.Fatalf("no odds for outcome %d", outcomeID)
+	return 0
+}
+
+func TestBuyOrderFillsUpToLimit(t *testing.T) {
+	tests := []struct {
+		name       string
+		event      models.Event
+		limit      float64
+		wantPoints int // -1: just check the odds stay within the limit
+	}{
+		// Yes is bought x for x/(100+x) <= 40%
+		{"pool", models.Event{PricingModel: "pool"}, 40, 66},
+		{"lmsr", models.Event{PricingModel: "lmsr", Liquidity: 100}, 60, -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestEngine(t)
+			event := tt.event
+			event.Title, event.EventType = "E", "binary"
+			outcomes := addEvent(t, e, &event, "Yes", "No")
+			a, b := addUser(t, e, "a"), addUser(t, e, "b")
+			if tt.event.PricingModel == "pool" {
+				buy(t, e, a, event.ID, outcomes[1], 100)
+			}
+
+			o := placeOrder(t, e, &models.Order{UserID: b, EventID: event.ID, OutcomeID: outcomes[0], Side: "buy", LimitPrice: tt.limit, Amount: 500})
+			if o.Status != "open" || o.FilledPoints <= 0 || o.FilledPoints >= 500 {
+				t.Fatalf("order %s with %d of 500 points filled, want partly filled", o.Status, o.FilledPoints)
+			}
+			if tt.wantPoints >= 0 && o.FilledPoints != tt.wantPoints {
+				t.Errorf("filled %d points, want %d", o.FilledPoints, tt.wantPoints)
+			}
+			if got := odds(t, e, event.ID, outcomes[0]); got > tt.limit {
+				t.Errorf("odds moved to %v, past the limit of %v", got, tt.limit)
+			}
+			// One more point would have crossed the limit
+			if q, err := e.QuoteBuy(b, event.ID, outcomes[0], 1); err != nil {
+				t.Fatal(err)
+			} else if q.Odds[0].Odds <= tt.limit {
+				t.Errorf("stopped with room to fill: one more point moves the odds only to %v", q.Odds[0].Odds)
+			}
+
+			// The unfilled rest stays reserved
+			if reserved, _ := e.ReservedPoints(b); reserved != 500-o.FilledPoints {
+				t.Errorf("reserved %d, want %d", reserved, 500-o.FilledPoints)
+			}
+			if got := balance(t, e, b); got != models.StartingBalance-o.FilledPoints {
+				t.Errorf("balance %d, want %d", got, models.StartingBalance-o.FilledPoints)
+			}
+
+			// Once the odds fall back, the rest fills
+			buy(t, e, a, event.ID, outcomes[1], 400)
+			filled, err := e.MatchOrders(event.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(filled) != 1 || filled[0].FilledPoints <= o.FilledPoints {
+				t.Errorf("rematch changed %v, want the order filled further", filled)
+			}
+		})
+	}
+}
+
+func TestSellOrderFillsDownToLimit(t *testing.T) {
+	e := newTestEngine(t)
+	event := &models.Event{Title: "E", EventType: "binary", PricingModel: "lmsr", Liquidity: 100}
+	outcomes := addEvent(t, e, event, "Yes", "No")
+	a := addUser(t, e, "a")
+	shares := buy(t, e, a, event.ID, outcomes[0], 300)
+	before := odds(t, e, event.ID, outcomes[0])
+
+	limit := math.Round(before) - 10
+	o := placeOrder(t, e, &models.Order{UserID: a, EventID: event.ID, OutcomeID: outcomes[0], Side: "sell", LimitPrice: limit, Shares: math.Floor(shares)})
+	if o.Status != "open" || o.FilledShares <= 0 || o.FilledShares >= o.Shares {
+		t.Fatalf("order %s with %v of %v shares filled, want partly filled", o.Status, o.FilledShares, o.Shares)
+	}
+	if got := odds(t, e, event.ID, outcomes[0]); got < limit {
+		t.Errorf("odds moved to %v, past the limit of %v", got, limit)
+	}
+	if reserved, _ := e.reservedShares(a, event.ID, outcomes[0]); math.Abs(reserved-(o.Shares-o.FilledShares)) > 1e-9 {
+		t.Errorf("reserved %v shares, want %v", reserved, o.Shares-o.FilledShares)
+	}
+}
+
+func TestOrderWithinLimitFillsWhole(t *testing.T) {
+	e := newTestEngine(t)
+	event := &models.Event{Title: "E", EventType: "binary", PricingModel: "lmsr", Liquidity: 100}
+	outcomes := addEvent(t, e, event, "Yes", "No")
+	b := addUser(t, e, "b")
+
+	o := placeOrder(t, e, &models.Order{UserID: b, EventID: event.ID, OutcomeID: outcomes[0], Side: "buy", LimitPrice: 90, Amount: 20})
+	if o.Status != "filled" || o.FilledPoints != 20 || o.ClosedAt == "" {
+		t.Errorf("order %s with %d points filled, closed %q; want filled", o.Status, o.FilledPoints, o.ClosedAt)
+	}
+	if reserved, _ := e.ReservedPoints(b); reserved != 0 {
+		t.Errorf("%d points still reserved", reserved)
+	}
+}
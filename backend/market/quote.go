@@ -0,0 +1,222 @@
+package market
+
+import (
+	"fmt"
+	"math"
+
+	"pauls-bach/models"
+)
+
+// Quote is a trade priced against the current market without being applied.
+// Buy and Sell execute exactly what QuoteBuy and QuoteSell return.
+type Quote struct {
+	EventID   int     `json:"event_id"`
+	OutcomeID int     `json:"outcome_id"`
+	Side      string  `json:"side"`
+	Amount    int     `json:"amount,omitempty"` // buy: points spent
+	Shares    float64 `json:"shares"`           // shares received (buy) or given up (sell)
+	Points    int     `json:"points,omitempty"` // sell: points returned
+	AvgPrice  float64 `json:"avg_price"`        // points per share
+	// Odds after the trade
+	Odds []OutcomeOdds `json:"odds"`
+	// Payout on the resulting position if the outcome wins, bonus included
+	PotentialPayout int `json:"potential_payout"`
+
+	position *models.Position // the user's position before the trade, nil if none
+}
+
+// QuoteBuy prices spending amount points on outcomeID, applying the same
+// checks as Buy.
+func (e *Engine) QuoteBuy(userID, eventID, outcomeID, amount int) (*Quote, error) {
+	if amount <= 0 {
+		return nil, fmt.Errorf("amount must be positive")
+	}
+
+	user, err := e.Store.Users.GetByID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("user not found")
+	}
+	// Points reserved by open limit orders can't be spent again
+	reserved, err := e.ReservedPoints(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Balance-reserved < amount {
+		return nil, fmt.Errorf("insufficient balance")
+	}
+
+	event, err := e.Store.Events.GetByID(eventID)
+	if err != nil {
+		return nil, fmt.Errorf("event not found")
+	}
+	if err := checkTradable(event); err != nil {
+		return nil, err
+	}
+
+	// Verify outcome belongs to event
+	outcomes, err := e.Store.Outcomes.GetByEventID(eventID)
+	if err != nil {
+		return nil, err
+	}
+	outcomeIdx := outcomeIndex(outcomes, outcomeID)
+	if outcomeIdx < 0 {
+		return nil, fmt.Errorf("invalid outcome for this event")
+	}
+
+	if err := e.checkOutcomeConflict(event, userID, outcomeID); err != nil {
+		return nil, err
+	}
+
+	q, err := e.outcomeShares(eventID, outcomes)
+	if err != nil {
+		return nil, err
+	}
+
+	// Pool buys are 1 point = 1 share at the current price; LMSR shares are
+	// priced along the cost curve and avg price is what was paid per share
+	price := oddsFor(event, outcomes, q)[outcomeIdx].Odds / 100
+	if price == 0 {
+		price = 1.0 / float64(len(outcomes))
+	}
+	shares := float64(amount)
+	if event.PricingModel == "lmsr" {
+		shares = lmsrSharesForCost(q, lmsrLiquidity(event), outcomeIdx, float64(amount))
+		price = float64(amount) / shares
+	}
+
+	pos, err := e.Store.Positions.GetByUserEventOutcome(userID, eventID, outcomeID)
+	if err != nil {
+		return nil, err
+	}
+	held := shares
+	if pos != nil {
+		held += pos.Shares
+	}
+
+	q[outcomeIdx] += shares
+	odds := oddsFor(event, outcomes, q)
+	return &Quote{
+		EventID:         eventID,
+		OutcomeID:       outcomeID,
+		Side:            "buy",
+		Amount:          amount,
+		Shares:          shares,
+		AvgPrice:        price,
+		Odds:            odds,
+		PotentialPayout: e.PotentialPayout(event, odds, outcomeID, held),
+		position:        pos,
+	}, nil
+}
+
+// QuoteSell prices selling shares of outcomeID, applying the same checks as
+// Sell.
+func (e *Engine) QuoteSell(userID, eventID, outcomeID int, shares float64) (*Quote, error) {
+	if shares <= 0 {
+		return nil, fmt.Errorf("shares must be positive")
+	}
+
+	event, err := e.Store.Events.GetByID(eventID)
+	if err != nil {
+		return nil, fmt.Errorf("event not found")
+	}
+	if err := checkTradable(event); err != nil {
+		return nil, err
+	}
+	// LMSR buys mint fractional shares, so only pool sells must be whole
+	if event.PricingModel != "lmsr" && shares != math.Floor(shares) {
+		return nil, fmt.Errorf("shares must be a whole number")
+	}
+
+	pos, err := e.Store.Positions.GetByUserEventOutcome(userID, eventID, outcomeID)
+	if err != nil {
+		return nil, err
+	}
+	// Shares reserved by open sell orders can't be sold again
+	reserved, err := e.reservedShares(userID, eventID, outcomeID)
+	if err != nil {
+		return nil, err
+	}
+	if pos == nil || pos.Shares-reserved < shares {
+		return nil, fmt.Errorf("insufficient shares")
+	}
+
+	outcomes, err := e.Store.Outcomes.GetByEventID(eventID)
+	if err != nil {
+		return nil, err
+	}
+	outcomeIdx := outcomeIndex(outcomes, outcomeID)
+	if outcomeIdx < 0 {
+		return nil, fmt.Errorf("invalid outcome for this event")
+	}
+	q, err := e.outcomeShares(eventID, outcomes)
+	if err != nil {
+		return nil, err
+	}
+
+	var points int
+	if event.PricingModel == "lmsr" {
+		// Seller gets the value of the shares along the cost curve
+		points = int(math.Floor(lmsrSellValue(q, lmsrLiquidity(event), outcomeIdx, shares)))
+	} else {
+		// Seller gets part of the share value back; the rest stays in the prize pool
+		points = e.RulesFor(event).PoolSellValue(shares)
+	}
+
+	q[outcomeIdx] -= shares
+	odds := oddsFor(event, outcomes, q)
+	remaining := pos.Shares - shares
+	potential := 0
+	if remaining >= 0.001 {
+		potential = e.PotentialPayout(event, odds, outcomeID, remaining)
+	}
+	return &Quote{
+		EventID:         eventID,
+		OutcomeID:       outcomeID,
+		Side:            "sell",
+		Shares:          shares,
+		Points:          points,
+		AvgPrice:        float64(points) / shares,
+		Odds:            odds,
+		PotentialPayout: potential,
+		position:        pos,
+	}, nil
+}
+
+// PotentialPayout returns what holding shares of outcomeID pays if that
+// outcome wins outright at the given odds, bonus included.
+func (e *Engine) PotentialPayout(event *models.Event, odds []OutcomeOdds, outcomeID int, shares float64) int {
+	var totalPool, outcomeShares float64
+	for _, o := range odds {
+		totalPool += o.Shares
+		if o.OutcomeID == outcomeID {
+			outcomeShares = o.Shares
+		}
+	}
+
+	payout := 0
+	if event.PricingModel == "lmsr" {
+		payout = int(math.Round(shares))
+	} else if outcomeShares > 0 {
+		payout = int(math.Round(totalPool * (shares / outcomeShares)))
+	}
+	return payout + e.RulesFor(event).WinBonus(shares)
+}
+
+// CostBasis returns the points paid for a position. LMSR shares were bought
+// along the cost curve at AvgPrice points each; pool shares cost a point
+// each, and their AvgPrice is the odds they were bought at.
+func CostBasis(event *models.Event, p *models.Position) float64 {
+	if event.PricingModel == "lmsr" {
+		return p.Shares * p.AvgPrice
+	}
+	return p.Shares
+}
+
+func outcomeIndex(outcomes []models.Outcome, outcomeID int) int {
+	for i, o := range outcomes {
+		if o.ID == outcomeID {
+			return i
+		}
+	}
+	return -1
+}
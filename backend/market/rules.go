@@ -0,0 +1,103 @@
+package market
+
+import (
+	"fmt"
+	"math"
+
+	"pauls-bach/models"
+)
+
+// Rules are the economics of a market: what sellers get back, what winners
+// earn on top of their payout and what an event's creator is paid once it
+// draws enough players.
+type Rules struct {
+	SellPayout    float64 `json:"sell_payout"`    // share of a pool sell's value paid back
+	WinBonusRate  float64 `json:"win_bonus_rate"` // bonus points per winning share
+	WinBonusFlat  int     `json:"win_bonus_flat"` // bonus points per winning position
+	BountyPoints  int     `json:"bounty_points"`  // paid to the event's creator...
+	BountyBettors int     `json:"bounty_bettors"` // ...once this many users hold positions
+}
+
+// DefaultRules are used when the server isn't configured otherwise.
+var DefaultRules = Rules{
+	SellPayout:    0.5,
+	WinBonusRate:  0.25,
+	WinBonusFlat:  20,
+	BountyPoints:  10,
+	BountyBettors: 5,
+}
+
+// With returns r with the overrides set in o applied.
+func (r Rules) With(o *models.EventRules) Rules {
+	if o == nil {
+		return r
+	}
+	if o.SellPayout != nil {
+		r.SellPayout = *o.SellPayout
+	}
+	if o.WinBonusRate != nil {
+		r.WinBonusRate = *o.WinBonusRate
+	}
+	if o.WinBonusFlat != nil {
+		r.WinBonusFlat = *o.WinBonusFlat
+	}
+	if o.BountyPoints != nil {
+		r.BountyPoints = *o.BountyPoints
+	}
+	if o.BountyBettors != nil {
+		r.BountyBettors = *o.BountyBettors
+	}
+	return r
+}
+
+// Validate rejects rules that would mint points out of thin air on a sell or
+// take them away from winners.
+func (r Rules) Validate() error {
+	if r.SellPayout < 0 || r.SellPayout > 1 {
+		return fmt.Errorf("sell_payout must be between 0 and 1")
+	}
+	if r.WinBonusRate < 0 || r.WinBonusFlat < 0 {
+		return fmt.Errorf("win bonus can't be negative")
+	}
+	if r.BountyPoints < 0 {
+		return fmt.Errorf("bounty_points can't be negative")
+	}
+	if r.BountyBettors < 1 {
+		return fmt.Errorf("bounty_bettors must be at least 1")
+	}
+	return nil
+}
+
+// Snapshot returns r as a full set of overrides, for storing with an event
+// so later changes to the server defaults don't affect it.
+func (r Rules) Snapshot() *models.EventRules {
+	return &models.EventRules{
+		SellPayout:    &r.SellPayout,
+		WinBonusRate:  &r.WinBonusRate,
+		WinBonusFlat:  &r.WinBonusFlat,
+		BountyPoints:  &r.BountyPoints,
+		BountyBettors: &r.BountyBettors,
+	}
+}
+
+// WinBonus returns the bonus paid on a winning position of shares.
+func (r Rules) WinBonus(shares float64) int {
+	return int(math.Round(shares*r.WinBonusRate)) + r.WinBonusFlat
+}
+
+// PoolSellValue returns the points paid back for selling shares of a pool
+// event. Whatever isn't paid back stays in the prize pool; a sale always
+// returns at least 1 point.
+func (r Rules) PoolSellValue(shares float64) int {
+	points := int(math.Floor(math.Floor(shares) * r.SellPayout))
+	if points < 1 {
+		points = 1
+	}
+	return points
+}
+
+// RulesFor returns the rules in effect for the event: the server's, with
+// the event's own overrides applied.
+func (e *Engine) RulesFor(event *models.Event) Rules {
+	return e.Rules.With(event.Rules)
+}
@@ -0,0 +1,95 @@
+package market
+
+import (
+	"fmt"
+	"math"
+
+	"pauls-bach/models"
+)
+
+// Scalar events have two outcomes, created in this order: Long pays out as the
+// resolved value approaches ScalarMax, Short as it approaches ScalarMin.
+const (
+	ScalarLong  = "Long"
+	ScalarShort = "Short"
+)
+
+// ResolveScalar settles a scalar event at value. Where value falls in the
+// event's range sets the split between Long and Short: at the midpoint each
+// side gets half the payout, and values outside the range are clamped.
+//
+// The payout is linear in that split. In a pool event Long's holders share
+// its fraction of the whole pool by shares, and Short's the rest; unlike
+// Resolve, a side nobody holds doesn't pass its fraction to the other, so
+// Long alone at 10 on a 0-100 range gets 10% of the pool. The unclaimed
+// fraction is the house's, like the part of a sale the seller doesn't get
+// back. In an LMSR event a Long share pays the fraction in points and a
+// Short share the rest. Each side's win bonus is scaled by its fraction.
+func (e *Engine) ResolveScalar(eventID int, value float64) (*ResolveResult, error) {
+	var result *ResolveResult
+	err := e.transact(func(e *Engine) (err error) {
+		result, err = e.resolveScalar(eventID, value)
+		return err
+	})
+	return result, err
+}
+
+func (e *Engine) resolveScalar(eventID int, value float64) (*ResolveResult, error) {
+	event, err := e.Store.Events.GetByID(eventID)
+	if err != nil {
+		return nil, fmt.Errorf("event not found")
+	}
+	if event.EventType != "scalar" {
+		return nil, fmt.Errorf("event is not a scalar event")
+	}
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return nil, fmt.Errorf("value must be a finite number")
+	}
+	outcomes, err := e.Store.Outcomes.GetByEventID(eventID)
+	if err != nil {
+		return nil, err
+	}
+	if len(outcomes) != 2 {
+		return nil, fmt.Errorf("scalar event must have exactly two outcomes")
+	}
+
+	long := scalarFraction(event, value)
+	var resolution []models.ResolutionWeight
+	if long > 0 {
+		resolution = append(resolution, models.ResolutionWeight{OutcomeID: outcomes[0].ID, Weight: long})
+	}
+	if long < 1 {
+		resolution = append(resolution, models.ResolutionWeight{OutcomeID: outcomes[1].ID, Weight: 1 - long})
+	}
+
+	result, err := e.resolve(eventID, resolution)
+	if err != nil {
+		return nil, err
+	}
+	event, err = e.Store.Events.GetByID(eventID)
+	if err != nil {
+		return nil, err
+	}
+	event.ResolvedValue = &value
+	return result, e.Store.Events.Update(event)
+}
+
+// ExpectedValue returns the value the market implies for a scalar event: its
+// range interpolated by the price of Long.
+func ExpectedValue(event *models.Event, odds []OutcomeOdds) float64 {
+	if len(odds) == 0 {
+		return event.ScalarMin
+	}
+	ev := event.ScalarMin + odds[0].Odds/100*(event.ScalarMax-event.ScalarMin)
+	return math.Round(ev*100) / 100
+}
+
+// scalarFraction returns where value falls in the event's range, from 0 at
+// ScalarMin to 1 at ScalarMax.
+func scalarFraction(event *models.Event, value float64) float64 {
+	if event.ScalarMax <= event.ScalarMin {
+		return 0.5
+	}
+	f := (value - event.ScalarMin) / (event.ScalarMax - event.ScalarMin)
+	return math.Max(0, math.Min(1, f))
+}
@@ -0,0 +1,110 @@
+package market
+
+import (
+	"math"
+	"testing"
+
+	"pauls-bach/models"
+)
+
+func TestResolveScalar(t *testing.T) {
+	// On a 0-100 range, long and short stake these amounts; 0 stays out
+	tests := []struct {
+		name            string
+		stakeL, stakeS  int
+		value           float64
+		wantLong, wantS int
+	}{
+		{"midpoint", 100, 100, 50, 100, 100},
+		{"three quarters", 100, 100, 75, 150, 50},
+		{"min", 100, 100, 0, 0, 200},
+		{"max", 100, 100, 100, 200, 0},
+		{"clamped above", 100, 100, 150, 200, 0},
+		{"clamped below", 100, 100, -20, 0, 200},
+		{"uneven midpoint", 150, 50, 50, 100, 100},
+		{"uneven", 150, 50, 10, 20, 180},
+		{"long alone", 100, 0, 10, 10, 0},
+		{"short alone", 0, 100, 10, 0, 90},
+		{"long alone at min", 100, 0, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestEngine(t)
+			event := &models.Event{Title: "S", EventType: "scalar", ScalarMin: 0, ScalarMax: 100}
+			outcomes := addEvent(t, e, event, ScalarLong, ScalarShort)
+			long, short := addUser(t, e, "long"), addUser(t, e, "short")
+			if tt.stakeL > 0 {
+				buy(t, e, long, event.ID, outcomes[0], tt.stakeL)
+			}
+			if tt.stakeS > 0 {
+				buy(t, e, short, event.ID, outcomes[1], tt.stakeS)
+			}
+
+			result, err := e.ResolveScalar(event.ID, tt.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			paid := payouts(result)
+			if paid[long] != tt.wantLong || paid[short] != tt.wantS {
+				t.Errorf("paid long %d, short %d; want %d, %d", paid[long], paid[short], tt.wantLong, tt.wantS)
+			}
+			resolved, _ := e.Store.Events.GetByID(event.ID)
+			if resolved.ResolvedValue == nil || *resolved.ResolvedValue != tt.value {
+				t.Errorf("resolved value %v", resolved.ResolvedValue)
+			}
+		})
+	}
+
+	e := newTestEngine(t)
+	event := &models.Event{Title: "S", EventType: "scalar", ScalarMin: 0, ScalarMax: 100}
+	addEvent(t, e, event, ScalarLong, ScalarShort)
+	if _, err := e.ResolveScalar(event.ID, math.NaN()); err == nil {
+		t.Error("resolved at NaN")
+	}
+}
+
+// The win bonus is scaled by each side's fraction, like the payout.
+func TestResolveScalarBonus(t *testing.T) {
+	e := newTestEngine(t)
+	e.Rules.WinBonusRate = 0.25
+	e.Rules.WinBonusFlat = 20
+	event := &models.Event{Title: "S", EventType: "scalar", ScalarMin: 0, ScalarMax: 100}
+	outcomes := addEvent(t, e, event, ScalarLong, ScalarShort)
+	long, short := addUser(t, e, "long"), addUser(t, e, "short")
+	buy(t, e, long, event.ID, outcomes[0], 100)
+	buy(t, e, short, event.ID, outcomes[1], 100)
+
+	result, err := e.ResolveScalar(event.ID, 75)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A 45 point bonus on 100 shares, at 75% and 25%
+	paid := payouts(result)
+	if want := 150 + 34; paid[long] != want {
+		t.Errorf("long paid %d, want %d", paid[long], want)
+	}
+	if want := 50 + 11; paid[short] != want {
+		t.Errorf("short paid %d, want %d", paid[short], want)
+	}
+}
+
+func TestResolveScalarLMSR(t *testing.T) {
+	e := newTestEngine(t)
+	event := &models.Event{Title: "S", EventType: "scalar", ScalarMin: 0, ScalarMax: 100, PricingModel: "lmsr", Liquidity: 100}
+	outcomes := addEvent(t, e, event, ScalarLong, ScalarShort)
+	long, short := addUser(t, e, "long"), addUser(t, e, "short")
+	longShares := buy(t, e, long, event.ID, outcomes[0], 100)
+	shortShares := buy(t, e, short, event.ID, outcomes[1], 40)
+
+	result, err := e.ResolveScalar(event.ID, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	paid := payouts(result)
+	if want := int(math.Round(longShares * 0.3)); paid[long] != want {
+		t.Errorf("long paid %d, want %d", paid[long], want)
+	}
+	if want := int(math.Round(shortShares * 0.7)); paid[short] != want {
+		t.Errorf("short paid %d, want %d", paid[short], want)
+	}
+}
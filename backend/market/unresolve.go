@@ -0,0 +1,183 @@
+package market
+
+import (
+	"fmt"
+	"time"
+
+	"pauls-bach/models"
+)
+
+// Unresolve reverses a resolution or a void. Payouts, bonuses and refunds it
+// credited are clawed back with compensating "reversal" transactions, the positions held at
+// resolution time are restored and the event goes back to trading (or to
+// "closed" if its closes_at has passed). It returns the points taken back
+// from each user; balances may go negative if winnings were already spent.
+func (e *Engine) Unresolve(eventID int) (map[int]int, error) {
+	var clawedBack map[int]int
+	err := e.transact(func(e *Engine) (err error) {
+		clawedBack, err = e.unresolve(eventID)
+		return err
+	})
+	return clawedBack, err
+}
+
+func (e *Engine) unresolve(eventID int) (map[int]int, error) {
+	event, err := e.Store.Events.GetByID(eventID)
+	if err != nil {
+		return nil, fmt.Errorf("event not found")
+	}
+	if event.Status != "resolved" {
+		return nil, fmt.Errorf("event is not resolved")
+	}
+
+	txs, err := e.Store.Transactions.GetByEventID(eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Net resolution credits still outstanding per user and outcome. Earlier
+	// reversals are negative, so repeated resolve/unresolve cycles net out.
+	type creditKey struct{ userID, outcomeID int }
+	credits := make(map[creditKey]int)
+	shares := make(map[creditKey]float64)
+	var order []creditKey
+	for _, tx := range txs {
+		if !isResolutionCredit(&tx) {
+			continue
+		}
+		k := creditKey{tx.UserID, tx.OutcomeID}
+		if _, ok := credits[k]; !ok {
+			order = append(order, k)
+		}
+		credits[k] += tx.Points
+		if tx.TxType == "payout" {
+			shares[k] += tx.Shares
+		}
+	}
+
+	clawedBack := make(map[int]int)
+	for _, k := range order {
+		owed := credits[k]
+		if owed <= 0 {
+			continue
+		}
+		if _, err := e.Store.Post(&models.Transaction{
+			UserID:    k.userID,
+			EventID:   eventID,
+			OutcomeID: k.outcomeID,
+			TxType:    "reversal",
+			Shares:    shares[k],
+			Points:    -owed,
+		}); err != nil {
+			return nil, err
+		}
+		clawedBack[k.userID] += owed
+	}
+
+	// Restore positions as they were right before resolution
+	positions, err := e.Store.ResolvedPositions.GetByEventID(eventID)
+	if err != nil {
+		return nil, err
+	}
+	if len(positions) == 0 {
+		positions, err = e.positionsFromTransactions(event, txs)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, p := range positions {
+		p.ID = 0
+		if err := e.Store.Positions.Create(&p); err != nil {
+			return nil, err
+		}
+	}
+	if err := e.Store.ResolvedPositions.DeleteByEventID(eventID); err != nil {
+		return nil, err
+	}
+
+	event.Status = "open"
+	if closeDue(event, time.Now()) {
+		event.Status = "closed"
+	}
+	event.Voided = false
+	event.Resolution = nil
+	event.ResolvedValue = nil
+	event.ResolvedAt = ""
+	return clawedBack, e.Store.Events.Update(event)
+}
+
+// isResolutionCredit reports whether tx was written by Resolve or Void (or
+// reverses such a transaction).
+func isResolutionCredit(tx *models.Transaction) bool {
+	switch tx.TxType {
+	case "payout", "bonus", "refund", "reversal":
+		return true
+	}
+	return false
+}
+
+func (e *Engine) archivePositions(eventID int, positions []models.Position) error {
+	// Drop anything left over from an earlier resolution of this event
+	if err := e.Store.ResolvedPositions.DeleteByEventID(eventID); err != nil {
+		return err
+	}
+	for _, p := range positions {
+		if err := e.Store.ResolvedPositions.Create(&p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// positionsFromTransactions rebuilds the positions of an event resolved
+// before positions were archived, from its buy and sell history. Pool events
+// didn't record purchase prices, so their avg price falls back to an even split.
+func (e *Engine) positionsFromTransactions(event *models.Event, txs []models.Transaction) ([]models.Position, error) {
+	outcomes, err := e.Store.Outcomes.GetByEventID(event.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	type posKey struct{ userID, outcomeID int }
+	held := make(map[posKey]float64)
+	bought := make(map[posKey]float64)
+	spent := make(map[posKey]int)
+	var order []posKey
+	for _, tx := range txs {
+		if tx.TxType != "buy" && tx.TxType != "sell" {
+			continue
+		}
+		k := posKey{tx.UserID, tx.OutcomeID}
+		if _, ok := held[k]; !ok {
+			order = append(order, k)
+		}
+		if tx.TxType == "buy" {
+			held[k] += tx.Shares
+			bought[k] += tx.Shares
+			spent[k] += tx.Points
+		} else {
+			held[k] -= tx.Shares
+		}
+	}
+
+	var positions []models.Position
+	for _, k := range order {
+		if held[k] < 0.001 {
+			continue
+		}
+		avgPrice := 0.0
+		if event.PricingModel == "lmsr" && bought[k] > 0 {
+			avgPrice = float64(spent[k]) / bought[k]
+		} else if len(outcomes) > 0 {
+			avgPrice = 1.0 / float64(len(outcomes))
+		}
+		positions = append(positions, models.Position{
+			UserID:    k.userID,
+			EventID:   event.ID,
+			OutcomeID: k.outcomeID,
+			Shares:    held[k],
+			AvgPrice:  avgPrice,
+		})
+	}
+	return positions, nil
+}
@@ -0,0 +1,112 @@
+package market
+
+import (
+	"testing"
+	"time"
+
+	"pauls-bach/models"
+)
+
+func TestUnresolveClawsBack(t *testing.T) {
+	e := newTestEngine(t)
+	event := &models.Event{Title: "E", EventType: "binary"}
+	outcomes := addEvent(t, e, event, "Yes", "No")
+	a, b := addUser(t, e, "a"), addUser(t, e, "b")
+	buy(t, e, a, event.ID, outcomes[0], 100)
+	buy(t, e, b, event.ID, outcomes[1], 50)
+	before := map[int]int{a: balance(t, e, a), b: balance(t, e, b)}
+
+	// Each cycle is resolved a different way and then undone; undoing must
+	// take back exactly what that resolution paid, however many came before
+	cycles := []func() (*ResolveResult, error){
+		func() (*ResolveResult, error) {
+			return e.Resolve(event.ID, []models.ResolutionWeight{{OutcomeID: outcomes[0], Weight: 1}})
+		},
+		func() (*ResolveResult, error) {
+			return e.Resolve(event.ID, []models.ResolutionWeight{{OutcomeID: outcomes[1], Weight: 1}})
+		},
+		func() (*ResolveResult, error) { return e.Void(event.ID) },
+		func() (*ResolveResult, error) {
+			return e.Resolve(event.ID, []models.ResolutionWeight{{OutcomeID: outcomes[0], Weight: 1}, {OutcomeID: outcomes[1], Weight: 1}})
+		},
+	}
+	for i, resolve := range cycles {
+		result, err := resolve()
+		if err != nil {
+			t.Fatalf("cycle %d: %v", i, err)
+		}
+		paid := payouts(result)
+
+		clawedBack, err := e.Unresolve(event.ID)
+		if err != nil {
+			t.Fatalf("cycle %d: unresolve: %v", i, err)
+		}
+		for _, userID := range []int{a, b} {
+			if clawedBack[userID] != paid[userID] {
+				t.Errorf("cycle %d: clawed back %d from user %d, paid %d", i, clawedBack[userID], userID, paid[userID])
+			}
+			if got := balance(t, e, userID); got != before[userID] {
+				t.Errorf("cycle %d: user %d balance %d, want %d", i, userID, got, before[userID])
+			}
+		}
+
+		positions, _ := e.Store.Positions.GetByEventID(event.ID)
+		if len(positions) != 2 {
+			t.Fatalf("cycle %d: %d positions restored, want 2", i, len(positions))
+		}
+		if reopened, _ := e.Store.Events.GetByID(event.ID); reopened.Status != "open" || reopened.Voided {
+			t.Errorf("cycle %d: event status %q, voided %v", i, reopened.Status, reopened.Voided)
+		}
+	}
+
+	if _, err := e.Unresolve(event.ID); err == nil {
+		t.Error("unresolved an open event")
+	}
+}
+
+// An event resolved before positions were archived gets them back from its
+// buys and sells.
+func TestUnresolveRebuildsPositions(t *testing.T) {
+	e := newTestEngine(t)
+	event := &models.Event{Title: "E", EventType: "binary"}
+	outcomes := addEvent(t, e, event, "Yes", "No")
+	a, b := addUser(t, e, "a"), addUser(t, e, "b")
+	aShares := buy(t, e, a, event.ID, outcomes[0], 100)
+	if _, err := e.Sell(a, event.ID, outcomes[0], 40); err != nil {
+		t.Fatal(err)
+	}
+	bShares := buy(t, e, b, event.ID, outcomes[1], 50)
+
+	if _, err := e.Resolve(event.ID, []models.ResolutionWeight{{OutcomeID: outcomes[0], Weight: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Store.ResolvedPositions.DeleteByEventID(event.ID); err != nil {
+		t.Fatal(err)
+	}
+	// The close time passed while the event was resolved
+	resolved, _ := e.Store.Events.GetByID(event.ID)
+	resolved.ClosesAt = time.Now().Add(-time.Hour).Format(time.RFC3339)
+	if err := e.Store.Events.Update(resolved); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := e.Unresolve(event.ID); err != nil {
+		t.Fatal(err)
+	}
+	positions, err := e.Store.Positions.GetByEventID(event.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[int]float64{a: aShares - 40, b: bShares}
+	if len(positions) != len(want) {
+		t.Fatalf("%d positions restored, want %d", len(positions), len(want))
+	}
+	for _, p := range positions {
+		if p.Shares != want[p.UserID] || p.AvgPrice != 0.5 {
+			t.Errorf("user %d restored with %v shares at %v, want %v at 0.5", p.UserID, p.Shares, p.AvgPrice, want[p.UserID])
+		}
+	}
+	if reopened, _ := e.Store.Events.GetByID(event.ID); reopened.Status != "closed" {
+		t.Errorf("event status %q after its close time, want closed", reopened.Status)
+	}
+}
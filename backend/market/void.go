@@ -0,0 +1,102 @@
+package market
+
+import (
+	"fmt"
+	"time"
+
+	"pauls-bach/models"
+)
+
+// Void resolves the event without a winner. Everyone who traded on it gets
+// back the points they put in, net of what sells already returned, as a
+// "refund" transaction. Transactions and odds history are kept, and the
+// positions are archived like a normal resolution so Unresolve can undo it.
+func (e *Engine) Void(eventID int) (*ResolveResult, error) {
+	var result *ResolveResult
+	err := e.transact(func(e *Engine) (err error) {
+		result, err = e.void(eventID)
+		return err
+	})
+	return result, err
+}
+
+func (e *Engine) void(eventID int) (*ResolveResult, error) {
+	event, err := e.Store.Events.GetByID(eventID)
+	if err != nil {
+		return nil, fmt.Errorf("event not found")
+	}
+	if event.Status == "resolved" {
+		return nil, fmt.Errorf("event already resolved")
+	}
+
+	txs, err := e.Store.Transactions.GetByEventID(eventID)
+	if err != nil {
+		return nil, err
+	}
+	netSpent, userIDs := NetStakes(txs)
+
+	result := &ResolveResult{}
+	for _, userID := range userIDs {
+		refund := netSpent[userID]
+		if refund > 0 {
+			if _, err := e.Store.Post(&models.Transaction{
+				UserID:  userID,
+				EventID: eventID,
+				TxType:  "refund",
+				Points:  refund,
+			}); err != nil {
+				return nil, err
+			}
+		} else {
+			refund = 0
+		}
+		result.UserOutcomes = append(result.UserOutcomes, UserOutcome{
+			UserID: userID,
+			Won:    false,
+			Payout: refund,
+			Refund: true,
+		})
+	}
+
+	positions, err := e.Store.Positions.GetByEventID(eventID)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.archivePositions(eventID, positions); err != nil {
+		return nil, err
+	}
+	if err := e.Store.Positions.DeleteByEventID(eventID); err != nil {
+		return nil, err
+	}
+	if _, err := e.CancelEventOrders(eventID); err != nil {
+		return nil, err
+	}
+
+	event.Status = "resolved"
+	event.Voided = true
+	event.Resolution = nil
+	event.ResolvedAt = time.Now().Format(time.RFC3339)
+	return result, e.Store.Events.Update(event)
+}
+
+// NetStakes adds up what each user put into an event, net of what sells
+// returned, from its transactions. userIDs lists the users who traded in
+// the order they first did. A stake can be negative: the user sold for
+// more than they paid.
+func NetStakes(txs []models.Transaction) (stakes map[int]int, userIDs []int) {
+	stakes = make(map[int]int)
+	for _, tx := range txs {
+		if tx.TxType != "buy" && tx.TxType != "sell" {
+			continue
+		}
+		if _, ok := stakes[tx.UserID]; !ok {
+			userIDs = append(userIDs, tx.UserID)
+		}
+		if tx.TxType == "buy" {
+			stakes[tx.UserID] += tx.Points
+		} else {
+			stakes[tx.UserID] -= tx.Points
+		}
+	}
+	return stakes, userIDs
+}
@@ -0,0 +1,77 @@
+package market
+
+import (
+	"math"
+	"testing"
+
+	"pauls-bach/models"
+)
+
+func TestVoidRefundsNetStake(t *testing.T) {
+	for _, pricing := range []string{"pool", "lmsr"} {
+		t.Run(pricing, func(t *testing.T) {
+			e := newTestEngine(t)
+			event := &models.Event{Title: "E", EventType: "binary", PricingModel: pricing, Liquidity: 100}
+			outcomes := addEvent(t, e, event, "Yes", "No")
+			a, b := addUser(t, e, "a"), addUser(t, e, "b")
+			shares := buy(t, e, a, event.ID, outcomes[0], 100)
+			buy(t, e, b, event.ID, outcomes[1], 30)
+			sold, err := e.Sell(a, event.ID, outcomes[0], math.Floor(shares/2))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := e.Void(event.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			paid := payouts(result)
+			if paid[a] != 100-sold || paid[b] != 30 {
+				t.Errorf("refunded a %d and b %d, want %d and 30", paid[a], paid[b], 100-sold)
+			}
+			// Everyone ends up where they started
+			for _, userID := range []int{a, b} {
+				if got := balance(t, e, userID); got != models.StartingBalance {
+					t.Errorf("user %d balance %d, want %d", userID, got, models.StartingBalance)
+				}
+			}
+			if voided, _ := e.Store.Events.GetByID(event.ID); !voided.Voided || voided.Status != "resolved" {
+				t.Errorf("event status %q, voided %v", voided.Status, voided.Voided)
+			}
+		})
+	}
+}
+
+// A user who sold for more than they paid keeps the profit and gets no
+// refund, rather than a negative one.
+func TestVoidSkipsProfitableSellers(t *testing.T) {
+	e := newTestEngine(t)
+	event := &models.Event{Title: "E", EventType: "binary", PricingModel: "lmsr", Liquidity: 100}
+	outcomes := addEvent(t, e, event, "Yes", "No")
+	a, b := addUser(t, e, "a"), addUser(t, e, "b")
+	shares := buy(t, e, a, event.ID, outcomes[0], 50)
+	buy(t, e, b, event.ID, outcomes[0], 200)
+	sold, err := e.Sell(a, event.ID, outcomes[0], shares)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sold <= 50 {
+		t.Fatalf("sold for %d, want a profit on 50", sold)
+	}
+
+	result, err := e.Void(event.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	paid := payouts(result)
+	if paid[a] != 0 || paid[b] != 200 {
+		t.Errorf("refunded a %d and b %d, want 0 and 200", paid[a], paid[b])
+	}
+	if got, want := balance(t, e, a), models.StartingBalance-50+sold; got != want {
+		t.Errorf("seller's balance %d, want %d", got, want)
+	}
+
+	if _, err := e.Void(event.ID); err == nil {
+		t.Error("voided a resolved event")
+	}
+}
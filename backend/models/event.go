@@ -1,14 +1,42 @@
 package models
 
 type Event struct {
-	ID               int    `json:"id"`
-	Title            string `json:"title"`
-	Description      string `json:"description"`
-	EventType        string `json:"event_type"` // "binary" or "multi"
-	Status           string `json:"status"`      // "open", "closed", "resolved"
-	WinningOutcomeID int    `json:"winning_outcome_id,omitempty"`
-	CreatedAt        string `json:"created_at"`
-	ResolvedAt       string `json:"resolved_at,omitempty"`
-	CreatorID        int    `json:"creator_id,omitempty"`
-	BountyPaid       bool   `json:"bounty_paid,omitempty"`
+	ID           int                `json:"id"`
+	Title        string             `json:"title"`
+	Description  string             `json:"description"`
+	EventType    string             `json:"event_type"`           // "binary", "multi" or "scalar"
+	Status       string             `json:"status"`               // "open", "closed", "resolved"
+	Resolution   []ResolutionWeight `json:"resolution,omitempty"` // winning outcomes and their payout shares
+	CreatedAt    string             `json:"created_at"`
+	ResolvedAt   string             `json:"resolved_at,omitempty"`
+	CreatorID    int                `json:"creator_id,omitempty"`
+	BountyPaid   bool               `json:"bounty_paid,omitempty"`
+	PricingModel string             `json:"pricing_model"`       // "pool" or "lmsr"
+	Liquidity    float64            `json:"liquidity,omitempty"` // LMSR b parameter
+	ClosesAt     string             `json:"closes_at,omitempty"` // trading locks at this time
+	Voided       bool               `json:"voided,omitempty"`    // resolved with stakes refunded
+	// Scalar events trade Long/Short on a value in [ScalarMin, ScalarMax]
+	ScalarMin     float64  `json:"scalar_min,omitempty"`
+	ScalarMax     float64  `json:"scalar_max,omitempty"`
+	ResolvedValue *float64 `json:"resolved_value,omitempty"`
+	// Lets a user hold positions on several outcomes at once
+	AllowHedging bool `json:"allow_hedging,omitempty"`
+	// Economic rules fixed when the event was created; nil uses the server's
+	Rules *EventRules `json:"rules,omitempty"`
+}
+
+// EventRules overrides the server-wide economic rules. Unset fields keep
+// the default.
+type EventRules struct {
+	SellPayout    *float64 `json:"sell_payout,omitempty"`    // share of a pool sell's value paid back
+	WinBonusRate  *float64 `json:"win_bonus_rate,omitempty"` // bonus points per winning share
+	WinBonusFlat  *int     `json:"win_bonus_flat,omitempty"` // bonus points per winning position
+	BountyPoints  *int     `json:"bounty_points,omitempty"`  // paid to the event's creator...
+	BountyBettors *int     `json:"bounty_bettors,omitempty"` // ...once this many users hold positions
+}
+
+// ResolutionWeight is one winning outcome's share of an event's payout.
+type ResolutionWeight struct {
+	OutcomeID int     `json:"outcome_id"`
+	Weight    float64 `json:"weight"` // weights of a resolution sum to 1
 }
@@ -6,4 +6,6 @@ type OddsSnapshot struct {
 	OutcomeID int     `json:"outcome_id"`
 	Odds      float64 `json:"odds"`
 	CreatedAt string  `json:"created_at"`
+	// Implied value of a scalar event at the time of the snapshot
+	ExpectedValue *float64 `json:"expected_value,omitempty"`
 }
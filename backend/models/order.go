@@ -0,0 +1,27 @@
+package models
+
+type Order struct {
+	ID           int     `json:"id"`
+	UserID       int     `json:"user_id"`
+	EventID      int     `json:"event_id"`
+	OutcomeID    int     `json:"outcome_id"`
+	Side         string  `json:"side"`             // "buy" or "sell"
+	LimitPrice   float64 `json:"limit_price"`      // 0-100 percentage, same scale as odds
+	Amount       int     `json:"amount,omitempty"` // points to spend (buy)
+	Shares       float64 `json:"shares,omitempty"` // shares to sell (sell)
+	Status       string  `json:"status"`           // "open", "filled", "cancelled", "expired"
+	FilledShares float64 `json:"filled_shares,omitempty"`
+	FilledPoints int     `json:"filled_points,omitempty"`
+	ExpiresAt    string  `json:"expires_at,omitempty"`
+	CreatedAt    string  `json:"created_at"`
+	ClosedAt     string  `json:"closed_at,omitempty"`
+}
+
+// Remaining returns what's left of the order to fill: points for a buy,
+// shares for a sell.
+func (o *Order) Remaining() float64 {
+	if o.Side == "buy" {
+		return float64(o.Amount - o.FilledPoints)
+	}
+	return o.Shares - o.FilledShares
+}
@@ -1,12 +1,29 @@
 package models
 
+// Transaction is an entry in the ledger. Every change to a user's balance is
+// one, and the balance is the sum of the user's entries; see store.Post.
+//
+// Types: "grant" (starting balance), "buy", "sell", "payout", "bonus" (win
+// bonus), "bounty" (creator bounty), "refund", "reversal" (undoes a
+// resolution's credits) and "admin_adjust".
 type Transaction struct {
 	ID        int     `json:"id"`
 	UserID    int     `json:"user_id"`
 	EventID   int     `json:"event_id"`
 	OutcomeID int     `json:"outcome_id"`
-	TxType    string  `json:"tx_type"` // "buy", "sell", "payout", "bonus"
+	TxType    string  `json:"tx_type"`
 	Shares    float64 `json:"shares"`
 	Points    int     `json:"points"`
+	Reason    string  `json:"reason,omitempty"`
 	CreatedAt string  `json:"created_at"`
 }
+
+// Delta is the change t makes to its user's balance. Buys are the only
+// debits and record what was spent; every other type is credited, and a
+// reversal's or negative adjustment's points are already negative.
+func (t *Transaction) Delta() int {
+	if t.TxType == "buy" {
+		return -t.Points
+	}
+	return t.Points
+}
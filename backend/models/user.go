@@ -1,5 +1,9 @@
 package models
 
+// StartingBalance is what a newly registered player gets. The admin
+// account starts with nothing.
+const StartingBalance = 1000
+
 type User struct {
 	ID        int    `json:"id"`
 	Username  string `json:"username"`
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+
+	"pauls-bach/config"
+	"pauls-bach/hub"
+)
+
+// relayCommand implements "pauls-bach relay [-listen ADDR]": it runs the
+// relay that server instances started with the same RELAY_ADDR share their
+// messages through, instead of the server.
+func relayCommand(cfg *config.Config, args []string) int {
+	flags := flag.NewFlagSet("relay", flag.ExitOnError)
+	addr := cfg.RelayAddr
+	if addr == "" {
+		addr = "127.0.0.1:7070"
+	}
+	listen := flags.String("listen", addr, "address to listen on; RELAY_ADDR if set")
+	flags.Parse(args)
+
+	ln, err := net.Listen("tcp", *listen)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "relay: %v\n", err)
+		return 1
+	}
+	log.Printf("relay: listening on %s", ln.Addr())
+	if err := hub.NewRelayServer().Serve(ln); err != nil {
+		fmt.Fprintf(os.Stderr, "relay: %v\n", err)
+		return 1
+	}
+	return 0
+}
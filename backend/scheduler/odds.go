@@ -0,0 +1,33 @@
+package scheduler
+
+import (
+	"log"
+	"time"
+
+	"pauls-bach/store"
+)
+
+// OddsCompactor thins out old odds snapshots according to Retention every
+// Interval; see store.CompactOddsSnapshots.
+type OddsCompactor struct {
+	Store     *store.Store
+	Retention store.OddsRetention
+	Interval  time.Duration
+}
+
+// Run compacts forever; call it in its own goroutine.
+func (c *OddsCompactor) Run() {
+	c.compact(time.Now())
+	for now := range time.Tick(c.Interval) {
+		c.compact(now)
+	}
+}
+
+func (c *OddsCompactor) compact(now time.Time) {
+	store.WriteLock()
+	defer store.WriteUnlock()
+
+	if _, err := c.Store.CompactOddsSnapshots(c.Retention, now); err != nil {
+		log.Printf("scheduler: failed to compact odds snapshots: %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+package scheduler
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"pauls-bach/hub"
+	"pauls-bach/market"
+	"pauls-bach/models"
+	"pauls-bach/store"
+)
+
+// Scheduler runs the time-based market jobs: closing events at their
+// closes_at and expiring limit orders.
+type Scheduler struct {
+	Store    *store.Store
+	Engine   *market.Engine
+	Hub      *hub.Hub
+	Interval time.Duration
+}
+
+// Run ticks forever; call it in its own goroutine.
+func (s *Scheduler) Run() {
+	s.tick(time.Now())
+	for now := range time.Tick(s.Interval) {
+		s.tick(now)
+	}
+}
+
+func (s *Scheduler) tick(now time.Time) {
+	store.WriteLock()
+	defer store.WriteUnlock()
+
+	closed, cancelled, err := s.Engine.CloseDueEvents(now)
+	if err != nil {
+		log.Printf("scheduler: failed to close events: %v", err)
+	}
+	for _, ev := range closed {
+		s.Hub.Publish(hub.EventEventClosed, map[string]interface{}{
+			"event_id":  ev.ID,
+			"title":     ev.Title,
+			"closes_at": ev.ClosesAt,
+		}, hub.TopicGlobal, hub.EventTopic(ev.ID))
+		entry := &models.ActivityEntry{
+			Type:    "event_closed",
+			Message: fmt.Sprintf("'%s' closed for trading", ev.Title),
+			EventID: ev.ID,
+		}
+		s.Store.Activity.Create(entry)
+		s.Hub.Broadcast(hub.EventActivityNew, entry)
+	}
+
+	expired, err := s.Engine.ExpireOrders(now)
+	if err != nil {
+		log.Printf("scheduler: failed to expire orders: %v", err)
+	}
+	for _, o := range append(cancelled, expired...) {
+		s.Hub.Send(o.UserID, hub.EventOrderUpdated, o)
+	}
+}
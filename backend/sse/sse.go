@@ -0,0 +1,97 @@
+// Package sse streams the hub's messages to clients as server-sent events.
+package sse
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"pauls-bach/hub"
+)
+
+type Handler struct {
+	Hub *hub.Hub
+	// A keepalive comment is sent on every stream this often, so proxies
+	// don't close the idle ones; 0 disables it
+	Heartbeat time.Duration
+}
+
+// ServeHTTP handles the SSE endpoint. The query takes the client's token
+// and the topics it wants, comma-separated (see package hub).
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	userID, isAdmin, _ := h.Hub.Authenticate(r.URL.Query().Get("token"))
+	topics := hub.SplitTopics(r.URL.Query().Get("topics"))
+	c, attached, err := h.Hub.Attach(userID, isAdmin, topics, parseLastEventID(r))
+	if err != nil {
+		status := hub.ErrorStatus(err)
+		if status == http.StatusServiceUnavailable {
+			w.Header().Set("Retry-After", "30")
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	defer h.Hub.Detach(c)
+
+	for _, d := range attached.First() {
+		writeMessage(w, d)
+	}
+	flusher.Flush()
+
+	var heartbeat <-chan time.Time
+	if h.Heartbeat > 0 {
+		ticker := time.NewTicker(h.Heartbeat)
+		defer ticker.Stop()
+		heartbeat = ticker.C
+	}
+
+	ctx := r.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.Lagged():
+			fmt.Fprintf(w, "data: {\"type\":\"%s\"}\n\n", hub.EventLagged)
+			flusher.Flush()
+			return
+		case d := <-c.Messages():
+			writeMessage(w, d)
+			flusher.Flush()
+		case <-heartbeat:
+			// A comment, which clients ignore
+			fmt.Fprintf(w, ": keepalive\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+func writeMessage(w http.ResponseWriter, d hub.Delivery) {
+	fmt.Fprintf(w, "id: %d\ndata: %s\n\n", d.ID, d.Data)
+}
+
+// parseLastEventID returns the ID of the last message a reconnecting client
+// saw, or nil. Browsers send it in the Last-Event-ID header when they
+// reconnect by themselves; clients that open a new stream pass it as
+// last_event_id.
+func parseLastEventID(r *http.Request) *uint64 {
+	v := r.Header.Get("Last-Event-ID")
+	if v == "" {
+		v = r.URL.Query().Get("last_event_id")
+	}
+	id, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		return nil
+	}
+	return &id
+}
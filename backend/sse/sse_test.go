@@ -0,0 +1,202 @@
+package sse
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"pauls-bach/hub"
+)
+
+type event struct {
+	id   uint64
+	Type string `json:"type"`
+	Data int    `json:"data"`
+}
+
+// stream opens the SSE endpoint, resuming from lastID if it isn't 0, and
+// returns a function reading the next event from it.
+func stream(t *testing.T, ctx context.Context, url string, lastID uint64) func() event {
+	t.Helper()
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastID != 0 {
+		req.Header.Set("Last-Event-ID", strconv.FormatUint(lastID, 10))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+	r := bufio.NewReader(resp.Body)
+	return func() event {
+		t.Helper()
+		var e event
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatalf("read stream: %v", err)
+			}
+			line = strings.TrimSuffix(line, "\n")
+			switch {
+			case line == "":
+				return e
+			case strings.HasPrefix(line, "id: "):
+				e.id, _ = strconv.ParseUint(strings.TrimPrefix(line, "id: "), 10, 64)
+			case strings.HasPrefix(line, "data: "):
+				if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &e); err != nil {
+					t.Fatalf("data %q: %v", line, err)
+				}
+			}
+		}
+	}
+}
+
+// A client that reconnects with Last-Event-ID gets the messages it missed,
+// then the stream carries on.
+func TestReplayOnReconnect(t *testing.T) {
+	h := hub.New("secret", hub.NewLocal())
+	srv := httptest.NewServer(&Handler{Hub: h})
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	first, stop := context.WithCancel(ctx)
+	next := stream(t, first, srv.URL, 0)
+	connected := next()
+	if connected.Type != hub.EventConnected {
+		t.Fatalf("first event %q, want connected", connected.Type)
+	}
+	h.Broadcast("seen", 0)
+	seen := next()
+	if seen.Type != "seen" || seen.id == 0 {
+		t.Fatalf("got %+v, want seen", seen)
+	}
+	stop()
+
+	// Missed while disconnected, along with an event it doesn't follow
+	for i := 1; i <= 3; i++ {
+		h.Broadcast("missed", i)
+	}
+	h.Publish("other", 0, hub.EventTopic(1))
+
+	next = stream(t, ctx, srv.URL+"?topics=global", seen.id)
+	for i := 1; i <= 3; i++ {
+		e := next()
+		if e.Type != "missed" || e.Data != i || e.id != seen.id+uint64(i) {
+			t.Fatalf("replayed %+v, want missed %d with ID %d", e, i, seen.id+uint64(i))
+		}
+	}
+	h.Broadcast("live", 0)
+	if e := next(); e.Type != "live" || e.id != seen.id+5 {
+		t.Errorf("got %+v after the replay, want live with ID %d", e, seen.id+5)
+	}
+
+	// Too far back to replay
+	next = stream(t, ctx, srv.URL, 1)
+	if e := next(); e.Type != hub.EventResync {
+		t.Errorf("resuming from ID 1 got %q, want resync", e.Type)
+	}
+}
+
+// blockedWriter is a stream whose writes after the first wait for release,
+// like a client that stops reading.
+type blockedWriter struct {
+	header  http.Header
+	release chan struct{}
+
+	mu     sync.Mutex
+	writes int
+	body   strings.Builder
+}
+
+func (w *blockedWriter) Header() http.Header { return w.header }
+func (w *blockedWriter) WriteHeader(int)     {}
+func (w *blockedWriter) Flush()              {}
+
+func (w *blockedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	w.writes++
+	first := w.writes == 1
+	w.mu.Unlock()
+	if !first {
+		<-w.release
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.body.WriteString(string(p))
+}
+
+// A client that falls behind is sent what it has queued, then told it
+// lagged, and disconnected.
+func TestLaggedNotice(t *testing.T) {
+	h := hub.New("secret", hub.NewLocal())
+	w := &blockedWriter{header: make(http.Header), release: make(chan struct{})}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req := httptest.NewRequest("GET", "/", nil).WithContext(ctx)
+	done := make(chan struct{})
+	go func() {
+		(&Handler{Hub: h}).ServeHTTP(w, req)
+		close(done)
+	}()
+	for h.Stats().Clients == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// More than a client's buffer, while its writes are stuck
+	for i := 0; i < 100; i++ {
+		h.Broadcast("a", i)
+	}
+	if stats := h.Stats(); stats.Lagged != 1 || stats.Clients != 0 {
+		t.Fatalf("stats %+v, want the client lagged and detached", stats)
+	}
+	close(w.release)
+	select {
+	case <-done:
+	case <-ctx.Done():
+		t.Fatal("stream still open after lagging")
+	}
+
+	body := w.body.String()
+	if want := "data: {\"type\":\"" + hub.EventLagged + "\"}\n\n"; !strings.HasSuffix(body, want) {
+		t.Errorf("stream ends %q, want the lagged notice", body[max(0, len(body)-80):])
+	}
+}
+
+func TestHeartbeat(t *testing.T) {
+	h := hub.New("secret", hub.NewLocal())
+	srv := httptest.NewServer(&Handler{Hub: h, Heartbeat: 10 * time.Millisecond})
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, _ := http.NewRequestWithContext(ctx, "GET", srv.URL, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	r := bufio.NewReader(resp.Body)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("no keepalive: %v", err)
+		}
+		if line == ": keepalive\n" {
+			return
+		}
+	}
+}
@@ -6,11 +6,13 @@ import (
 	"time"
 )
 
-type ActivityStore struct {
-	filePath string
+var activityHeader = []string{"id", "type", "message", "user_id", "event_id", "created_at"}
+
+type csvActivityStore struct {
+	file csvFile
 }
 
-func (s *ActivityStore) toRow(e *models.ActivityEntry) []string {
+func (s *csvActivityStore) toRow(e *models.ActivityEntry) []string {
 	return []string{
 		strconv.Itoa(e.ID),
 		e.Type,
@@ -21,7 +23,7 @@ func (s *ActivityStore) toRow(e *models.ActivityEntry) []string {
 	}
 }
 
-func (s *ActivityStore) fromRow(row []string) *models.ActivityEntry {
+func (s *csvActivityStore) fromRow(row []string) *models.ActivityEntry {
 	id, _ := strconv.Atoi(row[0])
 	userID, _ := strconv.Atoi(row[3])
 	eventID, _ := strconv.Atoi(row[4])
@@ -35,18 +37,22 @@ func (s *ActivityStore) fromRow(row []string) *models.ActivityEntry {
 	}
 }
 
-func (s *ActivityStore) Create(e *models.ActivityEntry) error {
-	id, err := nextID(s.filePath)
+func (s *csvActivityStore) all() ([]models.ActivityEntry, error) {
+	return readAllAs(s.file, s.fromRow)
+}
+
+func (s *csvActivityStore) Create(e *models.ActivityEntry) error {
+	id, err := s.file.nextID()
 	if err != nil {
 		return err
 	}
 	e.ID = id
 	e.CreatedAt = time.Now().Format(time.RFC3339)
-	return appendRow(s.filePath, s.toRow(e))
+	return s.file.append(s.toRow(e))
 }
 
-func (s *ActivityStore) GetRecent(limit int) ([]models.ActivityEntry, error) {
-	rows, err := readAllRows(s.filePath)
+func (s *csvActivityStore) GetRecent(limit int) ([]models.ActivityEntry, error) {
+	rows, err := s.file.readAll()
 	if err != nil {
 		return nil, err
 	}
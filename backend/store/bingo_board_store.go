@@ -8,13 +8,13 @@ import (
 	"time"
 )
 
-type BingoBoardStore struct {
-	filePath string
+type csvBingoBoardStore struct {
+	file csvFile
 }
 
 var bingoBoardHeader = []string{"id", "user_id", "squares", "created_at"}
 
-func (s *BingoBoardStore) toRow(b *models.BingoBoard) []string {
+func (s *csvBingoBoardStore) toRow(b *models.BingoBoard) []string {
 	sq, _ := json.Marshal(b.Squares)
 	return []string{
 		strconv.Itoa(b.ID),
@@ -24,7 +24,7 @@ func (s *BingoBoardStore) toRow(b *models.BingoBoard) []string {
 	}
 }
 
-func (s *BingoBoardStore) fromRow(row []string) (*models.BingoBoard, error) {
+func (s *csvBingoBoardStore) fromRow(row []string) (*models.BingoBoard, error) {
 	id, _ := strconv.Atoi(row[0])
 	userID, _ := strconv.Atoi(row[1])
 	var squares []models.BingoSquare
@@ -39,8 +39,8 @@ func (s *BingoBoardStore) fromRow(row []string) (*models.BingoBoard, error) {
 	}, nil
 }
 
-func (s *BingoBoardStore) GetAll() ([]models.BingoBoard, error) {
-	rows, err := readAllRows(s.filePath)
+func (s *csvBingoBoardStore) GetAll() ([]models.BingoBoard, error) {
+	rows, err := s.file.readAll()
 	if err != nil {
 		return nil, err
 	}
@@ -55,8 +55,8 @@ func (s *BingoBoardStore) GetAll() ([]models.BingoBoard, error) {
 	return boards, nil
 }
 
-func (s *BingoBoardStore) GetByID(id int) (*models.BingoBoard, error) {
-	rows, err := readAllRows(s.filePath)
+func (s *csvBingoBoardStore) GetByID(id int) (*models.BingoBoard, error) {
+	rows, err := s.file.readAll()
 	if err != nil {
 		return nil, err
 	}
@@ -69,8 +69,8 @@ func (s *BingoBoardStore) GetByID(id int) (*models.BingoBoard, error) {
 	return nil, fmt.Errorf("bingo board not found")
 }
 
-func (s *BingoBoardStore) GetByUserID(userID int) (*models.BingoBoard, error) {
-	rows, err := readAllRows(s.filePath)
+func (s *csvBingoBoardStore) GetByUserID(userID int) (*models.BingoBoard, error) {
+	rows, err := s.file.readAll()
 	if err != nil {
 		return nil, err
 	}
@@ -83,18 +83,18 @@ func (s *BingoBoardStore) GetByUserID(userID int) (*models.BingoBoard, error) {
 	return nil, nil // no board yet
 }
 
-func (s *BingoBoardStore) Create(b *models.BingoBoard) error {
-	id, err := nextID(s.filePath)
+func (s *csvBingoBoardStore) Create(b *models.BingoBoard) error {
+	id, err := s.file.nextID()
 	if err != nil {
 		return err
 	}
 	b.ID = id
 	b.CreatedAt = time.Now().Format(time.RFC3339)
-	return appendRow(s.filePath, s.toRow(b))
+	return s.file.append(s.toRow(b))
 }
 
-func (s *BingoBoardStore) Update(b *models.BingoBoard) error {
-	rows, err := readAllRows(s.filePath)
+func (s *csvBingoBoardStore) Update(b *models.BingoBoard) error {
+	rows, err := s.file.readAll()
 	if err != nil {
 		return err
 	}
@@ -102,14 +102,14 @@ func (s *BingoBoardStore) Update(b *models.BingoBoard) error {
 		rowID, _ := strconv.Atoi(row[0])
 		if rowID == b.ID {
 			rows[i] = s.toRow(b)
-			return writeAllRows(s.filePath, bingoBoardHeader, rows)
+			return s.file.writeAll(bingoBoardHeader, rows)
 		}
 	}
 	return fmt.Errorf("bingo board not found")
 }
 
-func (s *BingoBoardStore) DeleteByUserID(userID int) error {
-	rows, err := readAllRows(s.filePath)
+func (s *csvBingoBoardStore) DeleteByUserID(userID int) error {
+	rows, err := s.file.readAll()
 	if err != nil {
 		return err
 	}
@@ -120,5 +120,5 @@ func (s *BingoBoardStore) DeleteByUserID(userID int) error {
 			kept = append(kept, row)
 		}
 	}
-	return writeAllRows(s.filePath, bingoBoardHeader, kept)
+	return s.file.writeAll(bingoBoardHeader, kept)
 }
@@ -7,13 +7,13 @@ import (
 	"time"
 )
 
-type BingoEventStore struct {
-	filePath string
+type csvBingoEventStore struct {
+	file csvFile
 }
 
 var bingoEventHeader = []string{"id", "title", "rarity", "resolved", "created_at"}
 
-func (s *BingoEventStore) toRow(e *models.BingoEvent) []string {
+func (s *csvBingoEventStore) toRow(e *models.BingoEvent) []string {
 	return []string{
 		strconv.Itoa(e.ID),
 		e.Title,
@@ -23,18 +23,8 @@ func (s *BingoEventStore) toRow(e *models.BingoEvent) []string {
 	}
 }
 
-func (s *BingoEventStore) fromRow(row []string) (*models.BingoEvent, error) {
+func (s *csvBingoEventStore) fromRow(row []string) (*models.BingoEvent, error) {
 	id, _ := strconv.Atoi(row[0])
-	// Backward compat: old rows without rarity column
-	if len(row) == 4 {
-		return &models.BingoEvent{
-			ID:        id,
-			Title:     row[1],
-			Rarity:    "common",
-			Resolved:  row[2] == "true",
-			CreatedAt: row[3],
-		}, nil
-	}
 	return &models.BingoEvent{
 		ID:        id,
 		Title:     row[1],
@@ -44,8 +34,8 @@ func (s *BingoEventStore) fromRow(row []string) (*models.BingoEvent, error) {
 	}, nil
 }
 
-func (s *BingoEventStore) GetAll() ([]models.BingoEvent, error) {
-	rows, err := readAllRows(s.filePath)
+func (s *csvBingoEventStore) GetAll() ([]models.BingoEvent, error) {
+	rows, err := s.file.readAll()
 	if err != nil {
 		return nil, err
 	}
@@ -60,8 +50,8 @@ func (s *BingoEventStore) GetAll() ([]models.BingoEvent, error) {
 	return events, nil
 }
 
-func (s *BingoEventStore) GetByID(id int) (*models.BingoEvent, error) {
-	rows, err := readAllRows(s.filePath)
+func (s *csvBingoEventStore) GetByID(id int) (*models.BingoEvent, error) {
+	rows, err := s.file.readAll()
 	if err != nil {
 		return nil, err
 	}
@@ -74,18 +64,18 @@ func (s *BingoEventStore) GetByID(id int) (*models.BingoEvent, error) {
 	return nil, fmt.Errorf("bingo event not found")
 }
 
-func (s *BingoEventStore) Create(e *models.BingoEvent) error {
-	id, err := nextID(s.filePath)
+func (s *csvBingoEventStore) Create(e *models.BingoEvent) error {
+	id, err := s.file.nextID()
 	if err != nil {
 		return err
 	}
 	e.ID = id
 	e.CreatedAt = time.Now().Format(time.RFC3339)
-	return appendRow(s.filePath, s.toRow(e))
+	return s.file.append(s.toRow(e))
 }
 
-func (s *BingoEventStore) Update(e *models.BingoEvent) error {
-	rows, err := readAllRows(s.filePath)
+func (s *csvBingoEventStore) Update(e *models.BingoEvent) error {
+	rows, err := s.file.readAll()
 	if err != nil {
 		return err
 	}
@@ -93,7 +83,7 @@ func (s *BingoEventStore) Update(e *models.BingoEvent) error {
 		rowID, _ := strconv.Atoi(row[0])
 		if rowID == e.ID {
 			rows[i] = s.toRow(e)
-			return writeAllRows(s.filePath, bingoEventHeader, rows)
+			return s.file.writeAll(bingoEventHeader, rows)
 		}
 	}
 	return fmt.Errorf("bingo event not found")
@@ -6,13 +6,13 @@ import (
 	"time"
 )
 
-type BingoWinnerStore struct {
-	filePath string
+type csvBingoWinnerStore struct {
+	file csvFile
 }
 
 var bingoWinnerHeader = []string{"id", "user_id", "username", "board_id", "line", "created_at"}
 
-func (s *BingoWinnerStore) toRow(w *models.BingoWinner) []string {
+func (s *csvBingoWinnerStore) toRow(w *models.BingoWinner) []string {
 	return []string{
 		strconv.Itoa(w.ID),
 		strconv.Itoa(w.UserID),
@@ -23,7 +23,7 @@ func (s *BingoWinnerStore) toRow(w *models.BingoWinner) []string {
 	}
 }
 
-func (s *BingoWinnerStore) fromRow(row []string) (*models.BingoWinner, error) {
+func (s *csvBingoWinnerStore) fromRow(row []string) (*models.BingoWinner, error) {
 	id, _ := strconv.Atoi(row[0])
 	userID, _ := strconv.Atoi(row[1])
 	boardID, _ := strconv.Atoi(row[3])
@@ -37,8 +37,8 @@ func (s *BingoWinnerStore) fromRow(row []string) (*models.BingoWinner, error) {
 	}, nil
 }
 
-func (s *BingoWinnerStore) GetAll() ([]models.BingoWinner, error) {
-	rows, err := readAllRows(s.filePath)
+func (s *csvBingoWinnerStore) GetAll() ([]models.BingoWinner, error) {
+	rows, err := s.file.readAll()
 	if err != nil {
 		return nil, err
 	}
@@ -53,8 +53,8 @@ func (s *BingoWinnerStore) GetAll() ([]models.BingoWinner, error) {
 	return winners, nil
 }
 
-func (s *BingoWinnerStore) GetByBoardID(boardID int) ([]models.BingoWinner, error) {
-	rows, err := readAllRows(s.filePath)
+func (s *csvBingoWinnerStore) GetByBoardID(boardID int) ([]models.BingoWinner, error) {
+	rows, err := s.file.readAll()
 	if err != nil {
 		return nil, err
 	}
@@ -72,8 +72,8 @@ func (s *BingoWinnerStore) GetByBoardID(boardID int) ([]models.BingoWinner, erro
 	return winners, nil
 }
 
-func (s *BingoWinnerStore) DeleteByUserID(userID int) error {
-	rows, err := readAllRows(s.filePath)
+func (s *csvBingoWinnerStore) DeleteByUserID(userID int) error {
+	rows, err := s.file.readAll()
 	if err != nil {
 		return err
 	}
@@ -84,11 +84,11 @@ func (s *BingoWinnerStore) DeleteByUserID(userID int) error {
 			kept = append(kept, row)
 		}
 	}
-	return writeAllRows(s.filePath, bingoWinnerHeader, kept)
+	return s.file.writeAll(bingoWinnerHeader, kept)
 }
 
-func (s *BingoWinnerStore) DeleteByBoardIDAndLine(boardID int, line string) error {
-	rows, err := readAllRows(s.filePath)
+func (s *csvBingoWinnerStore) DeleteByBoardIDAndLine(boardID int, line string) error {
+	rows, err := s.file.readAll()
 	if err != nil {
 		return err
 	}
@@ -100,15 +100,15 @@ func (s *BingoWinnerStore) DeleteByBoardIDAndLine(boardID int, line string) erro
 		}
 		kept = append(kept, row)
 	}
-	return writeAllRows(s.filePath, bingoWinnerHeader, kept)
+	return s.file.writeAll(bingoWinnerHeader, kept)
 }
 
-func (s *BingoWinnerStore) Create(w *models.BingoWinner) error {
-	id, err := nextID(s.filePath)
+func (s *csvBingoWinnerStore) Create(w *models.BingoWinner) error {
+	id, err := s.file.nextID()
 	if err != nil {
 		return err
 	}
 	w.ID = id
 	w.CreatedAt = time.Now().Format(time.RFC3339)
-	return appendRow(s.filePath, s.toRow(w))
+	return s.file.append(s.toRow(w))
 }
@@ -0,0 +1,509 @@
+package store
+
+import (
+	"fmt"
+	"sort"
+
+	"pauls-bach/models"
+)
+
+// cache holds every table in memory, with the secondary indexes the stores
+// look records up by. It is only changed by writers, which hold the write
+// lock, so readers holding the read lock can use it freely.
+type cache struct {
+	users           *table[models.User]
+	usersByName     *tableIndex[models.User, string]
+	events          *table[models.Event]
+	outcomes        *table[models.Outcome]
+	outcomesByEvent *tableIndex[models.Outcome, int]
+
+	positions        *table[models.Position]
+	positionsByEvent *tableIndex[models.Position, int]
+	positionsByUser  *tableIndex[models.Position, int]
+	// Archived positions keep their original IDs, which needn't be unique
+	resolvedByEvent map[int][]models.Position
+
+	transactions     *table[models.Transaction]
+	txByUser         *tableIndex[models.Transaction, int]
+	txByEvent        *tableIndex[models.Transaction, int]
+	snapshots        *table[models.OddsSnapshot]
+	snapshotsByEvent *tableIndex[models.OddsSnapshot, int]
+	lastSnapshot     map[int]string // event ID -> latest snapshot time
+
+	bingoEvents    *table[models.BingoEvent]
+	bingoBoards    *table[models.BingoBoard]
+	boardsByUser   *tableIndex[models.BingoBoard, int]
+	bingoWinners   *table[models.BingoWinner]
+	winnersByBoard *tableIndex[models.BingoWinner, int]
+	winnersByUser  *tableIndex[models.BingoWinner, int]
+
+	activity       *table[models.ActivityEntry]
+	orders         *table[models.Order]
+	ordersByEvent  *tableIndex[models.Order, int]
+	ordersByUser   *tableIndex[models.Order, int]
+	ordersByStatus *tableIndex[models.Order, string]
+
+	// Set when a commit fails: the backend may have applied some of the
+	// transaction, or may yet (see csvTx.commit), so the cache has to be
+	// read back from it before the next transaction
+	stale bool
+}
+
+// Cached loads every table of next into memory and returns a store that
+// answers reads from there and writes through to next. Nothing else may
+// write to next afterwards.
+func Cached(next *Store) (*Store, error) {
+	c := newCache()
+	if err := c.load(next); err != nil {
+		return nil, err
+	}
+
+	s := newCachedStore(next, c, nil)
+	s.checkpoint, s.close = next.checkpoint, next.close
+	s.begin = func() (*txn, error) {
+		inner, err := next.begin()
+		if err != nil {
+			return nil, err
+		}
+		if c.stale {
+			if err := c.reload(next); err != nil {
+				inner.rollback()
+				return nil, err
+			}
+		}
+		tx := &cacheTx{written: make(map[string]bool)}
+		return &txn{
+			store: newCachedStore(inner.store, c, tx),
+			commit: func() error {
+				if err := inner.commit(); err != nil {
+					c.stale = true
+					return err
+				}
+				for _, apply := range tx.pending {
+					apply()
+				}
+				return nil
+			},
+			rollback: inner.rollback,
+		}, nil
+	}
+	return s, nil
+}
+
+// newCache returns an empty cache.
+func newCache() *cache {
+	c := &cache{
+		users:        newTable(func(u *models.User) int { return u.ID }, nil),
+		events:       newTable(func(e *models.Event) int { return e.ID }, cloneEvent),
+		outcomes:     newTable(func(o *models.Outcome) int { return o.ID }, nil),
+		positions:    newTable(func(p *models.Position) int { return p.ID }, nil),
+		transactions: newTable(func(t *models.Transaction) int { return t.ID }, nil),
+		snapshots:    newTable(func(o *models.OddsSnapshot) int { return o.ID }, nil),
+		bingoEvents:  newTable(func(e *models.BingoEvent) int { return e.ID }, nil),
+		bingoBoards:  newTable(func(b *models.BingoBoard) int { return b.ID }, cloneBingoBoard),
+		bingoWinners: newTable(func(w *models.BingoWinner) int { return w.ID }, nil),
+		activity:     newTable(func(e *models.ActivityEntry) int { return e.ID }, nil),
+		orders:       newTable(func(o *models.Order) int { return o.ID }, nil),
+
+		resolvedByEvent: make(map[int][]models.Position),
+		lastSnapshot:    make(map[int]string),
+	}
+	c.usersByName = addIndex(c.users, func(u *models.User) string { return u.Username })
+	c.outcomesByEvent = addIndex(c.outcomes, func(o *models.Outcome) int { return o.EventID })
+	c.positionsByEvent = addIndex(c.positions, func(p *models.Position) int { return p.EventID })
+	c.positionsByUser = addIndex(c.positions, func(p *models.Position) int { return p.UserID })
+	c.txByUser = addIndex(c.transactions, func(t *models.Transaction) int { return t.UserID })
+	c.txByEvent = addIndex(c.transactions, func(t *models.Transaction) int { return t.EventID })
+	c.snapshotsByEvent = addIndex(c.snapshots, func(o *models.OddsSnapshot) int { return o.EventID })
+	c.boardsByUser = addIndex(c.bingoBoards, func(b *models.BingoBoard) int { return b.UserID })
+	c.winnersByBoard = addIndex(c.bingoWinners, func(w *models.BingoWinner) int { return w.BoardID })
+	c.winnersByUser = addIndex(c.bingoWinners, func(w *models.BingoWinner) int { return w.UserID })
+	c.ordersByEvent = addIndex(c.orders, func(o *models.Order) int { return o.EventID })
+	c.ordersByUser = addIndex(c.orders, func(o *models.Order) int { return o.UserID })
+	c.ordersByStatus = addIndex(c.orders, func(o *models.Order) string { return o.Status })
+	return c
+}
+
+// reload replaces the cache's contents with next's.
+func (c *cache) reload(next *Store) error {
+	fresh := newCache()
+	if err := fresh.load(next); err != nil {
+		return fmt.Errorf("reload cache: %w", err)
+	}
+	*c = *fresh
+	return nil
+}
+
+// loader is implemented by the backend stores whose interface has no way
+// to read the whole table.
+type loader[T any] interface {
+	all() ([]T, error)
+}
+
+func loadAll[T any](name string, store any) ([]T, error) {
+	l, ok := store.(loader[T])
+	if !ok {
+		return nil, fmt.Errorf("cache: %s store can't be loaded", name)
+	}
+	return l.all()
+}
+
+func (c *cache) load(next *Store) error {
+	users, err := next.Users.GetAll()
+	if err != nil {
+		return fmt.Errorf("load users: %w", err)
+	}
+	c.users.load(users)
+
+	events, err := next.Events.GetAll()
+	if err != nil {
+		return fmt.Errorf("load events: %w", err)
+	}
+	c.events.load(events)
+
+	outcomes, err := next.Outcomes.GetAll()
+	if err != nil {
+		return fmt.Errorf("load outcomes: %w", err)
+	}
+	c.outcomes.load(outcomes)
+
+	positions, err := next.Positions.GetAll()
+	if err != nil {
+		return fmt.Errorf("load positions: %w", err)
+	}
+	c.positions.load(positions)
+
+	resolved, err := next.ResolvedPositions.GetAll()
+	if err != nil {
+		return fmt.Errorf("load resolved positions: %w", err)
+	}
+	for _, p := range resolved {
+		c.resolvedByEvent[p.EventID] = append(c.resolvedByEvent[p.EventID], p)
+	}
+
+	txs, err := next.Transactions.GetAll()
+	if err != nil {
+		return fmt.Errorf("load transactions: %w", err)
+	}
+	c.transactions.load(txs)
+
+	snapshots, err := next.OddsSnapshots.GetAll()
+	if err != nil {
+		return fmt.Errorf("load odds snapshots: %w", err)
+	}
+	c.snapshots.load(snapshots)
+	for _, o := range snapshots {
+		c.noteSnapshot(&o)
+	}
+
+	bingoEvents, err := next.BingoEvents.GetAll()
+	if err != nil {
+		return fmt.Errorf("load bingo events: %w", err)
+	}
+	c.bingoEvents.load(bingoEvents)
+
+	boards, err := next.BingoBoards.GetAll()
+	if err != nil {
+		return fmt.Errorf("load bingo boards: %w", err)
+	}
+	c.bingoBoards.load(boards)
+
+	winners, err := next.BingoWinners.GetAll()
+	if err != nil {
+		return fmt.Errorf("load bingo winners: %w", err)
+	}
+	c.bingoWinners.load(winners)
+
+	activity, err := loadAll[models.ActivityEntry]("activity", next.Activity)
+	if err != nil {
+		return fmt.Errorf("load activity: %w", err)
+	}
+	c.activity.load(activity)
+
+	orders, err := next.Orders.GetAll()
+	if err != nil {
+		return fmt.Errorf("load orders: %w", err)
+	}
+	c.orders.load(orders)
+	return nil
+}
+
+func (c *cache) noteSnapshot(o *models.OddsSnapshot) {
+	if last, ok := c.lastSnapshot[o.EventID]; !ok || o.CreatedAt > last {
+		c.lastSnapshot[o.EventID] = o.CreatedAt
+	}
+}
+
+// canonicalizer is implemented by backend stores that don't keep records
+// exactly as given, so the cache can hold what a read would return.
+type canonicalizer[T any] interface {
+	canonical(v T) T
+}
+
+func canonical[T any](store any, v T) T {
+	if c, ok := store.(canonicalizer[T]); ok {
+		return c.canonical(v)
+	}
+	return v
+}
+
+// cacheTx holds back a transaction's changes to the cache until it commits.
+// Until then, tables the transaction has written are read from the backend
+// store, which sees the uncommitted changes.
+type cacheTx struct {
+	written map[string]bool
+	pending []func()
+}
+
+// cacheView is what every cached store shares: the cache, and the
+// transaction the store belongs to, if any.
+type cacheView struct {
+	c     *cache
+	tx    *cacheTx
+	table string
+}
+
+// bypass reports whether reads must go to the backend store because the
+// transaction has changed the table.
+func (v cacheView) bypass() bool {
+	return v.tx != nil && v.tx.written[v.table]
+}
+
+// written marks the table as changed by the transaction. Call it before
+// writing to the backend store.
+func (v cacheView) written() {
+	if v.tx != nil {
+		v.tx.written[v.table] = true
+	}
+}
+
+// apply updates the cache after a successful write: now, or once the
+// transaction commits.
+func (v cacheView) apply(fn func()) {
+	if v.tx != nil {
+		v.tx.pending = append(v.tx.pending, fn)
+		return
+	}
+	fn()
+}
+
+func cloneEvent(e models.Event) models.Event {
+	e.Resolution = append([]models.ResolutionWeight(nil), e.Resolution...)
+	if e.ResolvedValue != nil {
+		v := *e.ResolvedValue
+		e.ResolvedValue = &v
+	}
+	if e.Rules != nil {
+		r := *e.Rules
+		e.Rules = &r
+	}
+	return e
+}
+
+func cloneBingoBoard(b models.BingoBoard) models.BingoBoard {
+	b.Squares = append([]models.BingoSquare(nil), b.Squares...)
+	return b
+}
+
+// table is one cached table: its records by ID, their IDs in ascending
+// order (the order the backends return them in) and its indexes. Records go
+// in and come out as copies, so callers can't change the cache behind its
+// back.
+type table[T any] struct {
+	id      func(*T) int
+	clone   func(T) T // for records that hold slices or pointers
+	rows    map[int]*T
+	ids     []int
+	indexes []indexer[T]
+}
+
+type indexer[T any] interface {
+	add(id int, v *T)
+	remove(id int, v *T)
+	reset()
+}
+
+func newTable[T any](id func(*T) int, clone func(T) T) *table[T] {
+	return &table[T]{id: id, clone: clone, rows: make(map[int]*T)}
+}
+
+func (t *table[T]) load(records []T) {
+	for _, r := range records {
+		t.put(r)
+	}
+}
+
+func (t *table[T]) copyOf(p *T) T {
+	if t.clone != nil {
+		return t.clone(*p)
+	}
+	return *p
+}
+
+// get returns a copy of the record, or nil.
+func (t *table[T]) get(id int) *T {
+	p, ok := t.rows[id]
+	if !ok {
+		return nil
+	}
+	v := t.copyOf(p)
+	return &v
+}
+
+func (t *table[T]) all() []T {
+	records := make([]T, 0, len(t.ids))
+	for _, id := range t.ids {
+		records = append(records, t.copyOf(t.rows[id]))
+	}
+	return records
+}
+
+// filter returns copies of the records with the given IDs that keep
+// accepts (all of them if keep is nil), or nil if there are none.
+func (t *table[T]) filter(ids []int, keep func(*T) bool) []T {
+	var records []T
+	for _, id := range ids {
+		p := t.rows[id]
+		if keep == nil || keep(p) {
+			records = append(records, t.copyOf(p))
+		}
+	}
+	return records
+}
+
+// first returns a copy of the first of the records with the given IDs that
+// keep accepts, or nil.
+func (t *table[T]) first(ids []int, keep func(*T) bool) *T {
+	for _, id := range ids {
+		if p := t.rows[id]; keep == nil || keep(p) {
+			v := t.copyOf(p)
+			return &v
+		}
+	}
+	return nil
+}
+
+// put inserts the record, or replaces the one with its ID.
+func (t *table[T]) put(v T) {
+	v = t.copyOf(&v)
+	id := t.id(&v)
+	if old, ok := t.rows[id]; ok {
+		for _, ix := range t.indexes {
+			ix.remove(id, old)
+		}
+	} else {
+		t.ids = insertID(t.ids, id)
+	}
+	t.rows[id] = &v
+	for _, ix := range t.indexes {
+		ix.add(id, &v)
+	}
+}
+
+func (t *table[T]) remove(id int) {
+	old, ok := t.rows[id]
+	if !ok {
+		return
+	}
+	for _, ix := range t.indexes {
+		ix.remove(id, old)
+	}
+	delete(t.rows, id)
+	t.ids = removeID(t.ids, id)
+}
+
+// removeWhere removes the records with the given IDs that match accepts
+// (all of them if match is nil).
+func (t *table[T]) removeWhere(ids []int, match func(*T) bool) {
+	for _, id := range append([]int(nil), ids...) {
+		if match == nil || match(t.rows[id]) {
+			t.remove(id)
+		}
+	}
+}
+
+// removeAll removes the records with the given IDs. Removing many records
+// one at a time is quadratic, so it rebuilds the ID list and indexes once
+// instead.
+func (t *table[T]) removeAll(ids []int) {
+	for _, id := range ids {
+		delete(t.rows, id)
+	}
+	kept := make([]int, 0, len(t.rows))
+	for _, id := range t.ids {
+		if _, ok := t.rows[id]; ok {
+			kept = append(kept, id)
+		}
+	}
+	t.ids = kept
+	for _, ix := range t.indexes {
+		ix.reset()
+		for _, id := range t.ids {
+			ix.add(id, t.rows[id])
+		}
+	}
+}
+
+// tableIndex maps a key to the IDs of the records that have it, ascending.
+type tableIndex[T any, K comparable] struct {
+	key func(*T) K
+	ids map[K][]int
+}
+
+func addIndex[T any, K comparable](t *table[T], key func(*T) K) *tableIndex[T, K] {
+	ix := &tableIndex[T, K]{key: key, ids: make(map[K][]int)}
+	t.indexes = append(t.indexes, ix)
+	return ix
+}
+
+// lookup returns the IDs of the records with key k. The slice belongs to
+// the index.
+func (ix *tableIndex[T, K]) lookup(k K) []int {
+	return ix.ids[k]
+}
+
+func (ix *tableIndex[T, K]) add(id int, v *T) {
+	k := ix.key(v)
+	ix.ids[k] = insertID(ix.ids[k], id)
+}
+
+func (ix *tableIndex[T, K]) remove(id int, v *T) {
+	k := ix.key(v)
+	if ids := removeID(ix.ids[k], id); len(ids) > 0 {
+		ix.ids[k] = ids
+	} else {
+		delete(ix.ids, k)
+	}
+}
+
+// reset empties the index. Slices already handed out by lookup are left
+// alone.
+func (ix *tableIndex[T, K]) reset() {
+	ix.ids = make(map[K][]int)
+}
+
+// insertID adds id to the sorted ids. New records have the highest ID, so
+// this is usually an append.
+func insertID(ids []int, id int) []int {
+	if n := len(ids); n == 0 || ids[n-1] < id {
+		return append(ids, id)
+	}
+	i := sort.SearchInts(ids, id)
+	if i < len(ids) && ids[i] == id {
+		return ids
+	}
+	ids = append(ids, 0)
+	copy(ids[i+1:], ids[i:])
+	ids[i] = id
+	return ids
+}
+
+func removeID(ids []int, id int) []int {
+	i := sort.SearchInts(ids, id)
+	if i == len(ids) || ids[i] != id {
+		return ids
+	}
+	// Copy rather than shift in place: lookup may have handed the old
+	// slice to a caller
+	return append(append(make([]int, 0, len(ids)-1), ids[:i]...), ids[i+1:]...)
+}
@@ -0,0 +1,677 @@
+package store
+
+import (
+	"fmt"
+	"sort"
+
+	"pauls-bach/models"
+)
+
+// The cached stores answer reads from the cache and write through to the
+// backend store, updating the cache once the write has succeeded.
+
+func newCachedStore(next *Store, c *cache, tx *cacheTx) *Store {
+	view := func(table string) cacheView {
+		return cacheView{c: c, tx: tx, table: table}
+	}
+	return &Store{
+		Users:             &cachedUserStore{view("users"), next.Users},
+		Events:            &cachedEventStore{view("events"), next.Events},
+		Outcomes:          &cachedOutcomeStore{view("outcomes"), next.Outcomes},
+		Positions:         &cachedPositionStore{view("positions"), next.Positions},
+		Transactions:      &cachedTransactionStore{view("transactions"), next.Transactions},
+		OddsSnapshots:     &cachedOddsSnapshotStore{view("odds_snapshots"), next.OddsSnapshots},
+		BingoEvents:       &cachedBingoEventStore{view("bingo_events"), next.BingoEvents},
+		BingoBoards:       &cachedBingoBoardStore{view("bingo_boards"), next.BingoBoards},
+		BingoWinners:      &cachedBingoWinnerStore{view("bingo_winners"), next.BingoWinners},
+		Activity:          &cachedActivityStore{view("activity"), next.Activity},
+		Orders:            &cachedOrderStore{view("orders"), next.Orders},
+		ResolvedPositions: &cachedResolvedPositionStore{view("resolved_positions"), next.ResolvedPositions},
+	}
+}
+
+type cachedUserStore struct {
+	cacheView
+	next UserStore
+}
+
+func (s *cachedUserStore) GetAll() ([]models.User, error) {
+	if s.bypass() {
+		return s.next.GetAll()
+	}
+	return s.c.users.all(), nil
+}
+
+func (s *cachedUserStore) GetByID(id int) (*models.User, error) {
+	if s.bypass() {
+		return s.next.GetByID(id)
+	}
+	if u := s.c.users.get(id); u != nil {
+		return u, nil
+	}
+	return nil, fmt.Errorf("user not found")
+}
+
+func (s *cachedUserStore) GetByUsername(username string) (*models.User, error) {
+	if s.bypass() {
+		return s.next.GetByUsername(username)
+	}
+	if u := s.c.users.first(s.c.usersByName.lookup(username), nil); u != nil {
+		return u, nil
+	}
+	return nil, fmt.Errorf("user not found")
+}
+
+func (s *cachedUserStore) Create(u *models.User) error {
+	s.written()
+	if err := s.next.Create(u); err != nil {
+		return err
+	}
+	v := canonical(s.next, *u)
+	s.apply(func() { s.c.users.put(v) })
+	return nil
+}
+
+func (s *cachedUserStore) Update(u *models.User) error {
+	s.written()
+	if err := s.next.Update(u); err != nil {
+		return err
+	}
+	v := canonical(s.next, *u)
+	s.apply(func() { s.c.users.put(v) })
+	return nil
+}
+
+type cachedEventStore struct {
+	cacheView
+	next EventStore
+}
+
+func (s *cachedEventStore) GetAll() ([]models.Event, error) {
+	if s.bypass() {
+		return s.next.GetAll()
+	}
+	return s.c.events.all(), nil
+}
+
+func (s *cachedEventStore) GetByID(id int) (*models.Event, error) {
+	if s.bypass() {
+		return s.next.GetByID(id)
+	}
+	if e := s.c.events.get(id); e != nil {
+		return e, nil
+	}
+	return nil, fmt.Errorf("event not found")
+}
+
+func (s *cachedEventStore) Create(e *models.Event) error {
+	s.written()
+	if err := s.next.Create(e); err != nil {
+		return err
+	}
+	v := canonical(s.next, cloneEvent(*e))
+	s.apply(func() { s.c.events.put(v) })
+	return nil
+}
+
+func (s *cachedEventStore) Update(e *models.Event) error {
+	s.written()
+	if err := s.next.Update(e); err != nil {
+		return err
+	}
+	v := canonical(s.next, cloneEvent(*e))
+	s.apply(func() { s.c.events.put(v) })
+	return nil
+}
+
+func (s *cachedEventStore) Delete(id int) error {
+	s.written()
+	if err := s.next.Delete(id); err != nil {
+		return err
+	}
+	s.apply(func() { s.c.events.remove(id) })
+	return nil
+}
+
+type cachedOutcomeStore struct {
+	cacheView
+	next OutcomeStore
+}
+
+func (s *cachedOutcomeStore) GetAll() ([]models.Outcome, error) {
+	if s.bypass() {
+		return s.next.GetAll()
+	}
+	return s.c.outcomes.all(), nil
+}
+
+func (s *cachedOutcomeStore) GetByEventID(eventID int) ([]models.Outcome, error) {
+	if s.bypass() {
+		return s.next.GetByEventID(eventID)
+	}
+	return s.c.outcomes.filter(s.c.outcomesByEvent.lookup(eventID), nil), nil
+}
+
+func (s *cachedOutcomeStore) GetByID(id int) (*models.Outcome, error) {
+	if s.bypass() {
+		return s.next.GetByID(id)
+	}
+	return s.c.outcomes.get(id), nil
+}
+
+func (s *cachedOutcomeStore) Create(o *models.Outcome) error {
+	s.written()
+	if err := s.next.Create(o); err != nil {
+		return err
+	}
+	v := canonical(s.next, *o)
+	s.apply(func() { s.c.outcomes.put(v) })
+	return nil
+}
+
+func (s *cachedOutcomeStore) Update(o *models.Outcome) error {
+	s.written()
+	if err := s.next.Update(o); err != nil {
+		return err
+	}
+	v := canonical(s.next, *o)
+	s.apply(func() { s.c.outcomes.put(v) })
+	return nil
+}
+
+func (s *cachedOutcomeStore) DeleteByEventID(eventID int) error {
+	s.written()
+	if err := s.next.DeleteByEventID(eventID); err != nil {
+		return err
+	}
+	s.apply(func() { s.c.outcomes.removeWhere(s.c.outcomesByEvent.lookup(eventID), nil) })
+	return nil
+}
+
+type cachedPositionStore struct {
+	cacheView
+	next PositionStore
+}
+
+func (s *cachedPositionStore) GetAll() ([]models.Position, error) {
+	if s.bypass() {
+		return s.next.GetAll()
+	}
+	return s.c.positions.all(), nil
+}
+
+func (s *cachedPositionStore) GetByUserID(userID int) ([]models.Position, error) {
+	if s.bypass() {
+		return s.next.GetByUserID(userID)
+	}
+	return s.c.positions.filter(s.c.positionsByUser.lookup(userID), nil), nil
+}
+
+func (s *cachedPositionStore) GetByEventID(eventID int) ([]models.Position, error) {
+	if s.bypass() {
+		return s.next.GetByEventID(eventID)
+	}
+	return s.c.positions.filter(s.c.positionsByEvent.lookup(eventID), nil), nil
+}
+
+func (s *cachedPositionStore) GetByUserAndEvent(userID, eventID int) ([]models.Position, error) {
+	if s.bypass() {
+		return s.next.GetByUserAndEvent(userID, eventID)
+	}
+	return s.c.positions.filter(s.c.positionsByUser.lookup(userID), func(p *models.Position) bool {
+		return p.EventID == eventID
+	}), nil
+}
+
+func (s *cachedPositionStore) GetByUserEventOutcome(userID, eventID, outcomeID int) (*models.Position, error) {
+	if s.bypass() {
+		return s.next.GetByUserEventOutcome(userID, eventID, outcomeID)
+	}
+	return s.c.positions.first(s.c.positionsByUser.lookup(userID), func(p *models.Position) bool {
+		return p.EventID == eventID && p.OutcomeID == outcomeID
+	}), nil
+}
+
+func (s *cachedPositionStore) Create(p *models.Position) error {
+	s.written()
+	if err := s.next.Create(p); err != nil {
+		return err
+	}
+	v := canonical(s.next, *p)
+	s.apply(func() { s.c.positions.put(v) })
+	return nil
+}
+
+func (s *cachedPositionStore) Update(p *models.Position) error {
+	s.written()
+	if err := s.next.Update(p); err != nil {
+		return err
+	}
+	v := canonical(s.next, *p)
+	s.apply(func() { s.c.positions.put(v) })
+	return nil
+}
+
+func (s *cachedPositionStore) Delete(id int) error {
+	s.written()
+	if err := s.next.Delete(id); err != nil {
+		return err
+	}
+	s.apply(func() { s.c.positions.remove(id) })
+	return nil
+}
+
+func (s *cachedPositionStore) DeleteByEventID(eventID int) error {
+	s.written()
+	if err := s.next.DeleteByEventID(eventID); err != nil {
+		return err
+	}
+	s.apply(func() { s.c.positions.removeWhere(s.c.positionsByEvent.lookup(eventID), nil) })
+	return nil
+}
+
+type cachedResolvedPositionStore struct {
+	cacheView
+	next ResolvedPositionStore
+}
+
+func (s *cachedResolvedPositionStore) GetAll() ([]models.Position, error) {
+	if s.bypass() {
+		return s.next.GetAll()
+	}
+	var positions []models.Position
+	for _, eventPositions := range s.c.resolvedByEvent {
+		positions = append(positions, eventPositions...)
+	}
+	sort.Slice(positions, func(i, j int) bool { return positions[i].ID < positions[j].ID })
+	return positions, nil
+}
+
+func (s *cachedResolvedPositionStore) GetByEventID(eventID int) ([]models.Position, error) {
+	if s.bypass() {
+		return s.next.GetByEventID(eventID)
+	}
+	return append([]models.Position(nil), s.c.resolvedByEvent[eventID]...), nil
+}
+
+func (s *cachedResolvedPositionStore) Create(p *models.Position) error {
+	s.written()
+	if err := s.next.Create(p); err != nil {
+		return err
+	}
+	v := canonical(s.next, *p)
+	s.apply(func() { s.c.resolvedByEvent[v.EventID] = append(s.c.resolvedByEvent[v.EventID], v) })
+	return nil
+}
+
+func (s *cachedResolvedPositionStore) DeleteByEventID(eventID int) error {
+	s.written()
+	if err := s.next.DeleteByEventID(eventID); err != nil {
+		return err
+	}
+	s.apply(func() { delete(s.c.resolvedByEvent, eventID) })
+	return nil
+}
+
+type cachedTransactionStore struct {
+	cacheView
+	next TransactionStore
+}
+
+func (s *cachedTransactionStore) GetAll() ([]models.Transaction, error) {
+	if s.bypass() {
+		return s.next.GetAll()
+	}
+	return s.c.transactions.all(), nil
+}
+
+func (s *cachedTransactionStore) GetByUserID(userID int) ([]models.Transaction, error) {
+	if s.bypass() {
+		return s.next.GetByUserID(userID)
+	}
+	return s.c.transactions.filter(s.c.txByUser.lookup(userID), nil), nil
+}
+
+func (s *cachedTransactionStore) GetByEventID(eventID int) ([]models.Transaction, error) {
+	if s.bypass() {
+		return s.next.GetByEventID(eventID)
+	}
+	return s.c.transactions.filter(s.c.txByEvent.lookup(eventID), nil), nil
+}
+
+func (s *cachedTransactionStore) Create(t *models.Transaction) error {
+	s.written()
+	if err := s.next.Create(t); err != nil {
+		return err
+	}
+	v := canonical(s.next, *t)
+	s.apply(func() { s.c.transactions.put(v) })
+	return nil
+}
+
+type cachedOddsSnapshotStore struct {
+	cacheView
+	next OddsSnapshotStore
+}
+
+func (s *cachedOddsSnapshotStore) GetAll() ([]models.OddsSnapshot, error) {
+	if s.bypass() {
+		return s.next.GetAll()
+	}
+	return s.c.snapshots.all(), nil
+}
+
+func (s *cachedOddsSnapshotStore) GetByEventID(eventID int) ([]*models.OddsSnapshot, error) {
+	if s.bypass() {
+		return s.next.GetByEventID(eventID)
+	}
+	var results []*models.OddsSnapshot
+	for _, o := range s.c.snapshots.filter(s.c.snapshotsByEvent.lookup(eventID), nil) {
+		results = append(results, &o)
+	}
+	return results, nil
+}
+
+func (s *cachedOddsSnapshotStore) LastSnapshotTimeByEvent() (map[int]string, error) {
+	if s.bypass() {
+		return s.next.LastSnapshotTimeByEvent()
+	}
+	result := make(map[int]string, len(s.c.lastSnapshot))
+	for eventID, t := range s.c.lastSnapshot {
+		result[eventID] = t
+	}
+	return result, nil
+}
+
+func (s *cachedOddsSnapshotStore) Create(o *models.OddsSnapshot) error {
+	s.written()
+	if err := s.next.Create(o); err != nil {
+		return err
+	}
+	v := canonical(s.next, *o)
+	s.apply(func() {
+		s.c.snapshots.put(v)
+		s.c.noteSnapshot(&v)
+	})
+	return nil
+}
+
+func (s *cachedOddsSnapshotStore) DeleteByEventID(eventID int) error {
+	s.written()
+	if err := s.next.DeleteByEventID(eventID); err != nil {
+		return err
+	}
+	s.apply(func() {
+		s.c.snapshots.removeWhere(s.c.snapshotsByEvent.lookup(eventID), nil)
+		delete(s.c.lastSnapshot, eventID)
+	})
+	return nil
+}
+
+func (s *cachedOddsSnapshotStore) DeleteByIDs(ids []int) error {
+	s.written()
+	if err := s.next.DeleteByIDs(ids); err != nil {
+		return err
+	}
+	s.apply(func() { s.c.snapshots.removeAll(ids) })
+	return nil
+}
+
+type cachedBingoEventStore struct {
+	cacheView
+	next BingoEventStore
+}
+
+func (s *cachedBingoEventStore) GetAll() ([]models.BingoEvent, error) {
+	if s.bypass() {
+		return s.next.GetAll()
+	}
+	return s.c.bingoEvents.all(), nil
+}
+
+func (s *cachedBingoEventStore) GetByID(id int) (*models.BingoEvent, error) {
+	if s.bypass() {
+		return s.next.GetByID(id)
+	}
+	if e := s.c.bingoEvents.get(id); e != nil {
+		return e, nil
+	}
+	return nil, fmt.Errorf("bingo event not found")
+}
+
+func (s *cachedBingoEventStore) Create(e *models.BingoEvent) error {
+	s.written()
+	if err := s.next.Create(e); err != nil {
+		return err
+	}
+	v := canonical(s.next, *e)
+	s.apply(func() { s.c.bingoEvents.put(v) })
+	return nil
+}
+
+func (s *cachedBingoEventStore) Update(e *models.BingoEvent) error {
+	s.written()
+	if err := s.next.Update(e); err != nil {
+		return err
+	}
+	v := canonical(s.next, *e)
+	s.apply(func() { s.c.bingoEvents.put(v) })
+	return nil
+}
+
+type cachedBingoBoardStore struct {
+	cacheView
+	next BingoBoardStore
+}
+
+func (s *cachedBingoBoardStore) GetAll() ([]models.BingoBoard, error) {
+	if s.bypass() {
+		return s.next.GetAll()
+	}
+	return s.c.bingoBoards.all(), nil
+}
+
+func (s *cachedBingoBoardStore) GetByID(id int) (*models.BingoBoard, error) {
+	if s.bypass() {
+		return s.next.GetByID(id)
+	}
+	if b := s.c.bingoBoards.get(id); b != nil {
+		return b, nil
+	}
+	return nil, fmt.Errorf("bingo board not found")
+}
+
+func (s *cachedBingoBoardStore) GetByUserID(userID int) (*models.BingoBoard, error) {
+	if s.bypass() {
+		return s.next.GetByUserID(userID)
+	}
+	return s.c.bingoBoards.first(s.c.boardsByUser.lookup(userID), nil), nil
+}
+
+func (s *cachedBingoBoardStore) Create(b *models.BingoBoard) error {
+	s.written()
+	if err := s.next.Create(b); err != nil {
+		return err
+	}
+	v := canonical(s.next, cloneBingoBoard(*b))
+	s.apply(func() { s.c.bingoBoards.put(v) })
+	return nil
+}
+
+func (s *cachedBingoBoardStore) Update(b *models.BingoBoard) error {
+	s.written()
+	if err := s.next.Update(b); err != nil {
+		return err
+	}
+	v := canonical(s.next, cloneBingoBoard(*b))
+	s.apply(func() { s.c.bingoBoards.put(v) })
+	return nil
+}
+
+func (s *cachedBingoBoardStore) DeleteByUserID(userID int) error {
+	s.written()
+	if err := s.next.DeleteByUserID(userID); err != nil {
+		return err
+	}
+	s.apply(func() { s.c.bingoBoards.removeWhere(s.c.boardsByUser.lookup(userID), nil) })
+	return nil
+}
+
+type cachedBingoWinnerStore struct {
+	cacheView
+	next BingoWinnerStore
+}
+
+func (s *cachedBingoWinnerStore) GetAll() ([]models.BingoWinner, error) {
+	if s.bypass() {
+		return s.next.GetAll()
+	}
+	return s.c.bingoWinners.all(), nil
+}
+
+func (s *cachedBingoWinnerStore) GetByBoardID(boardID int) ([]models.BingoWinner, error) {
+	if s.bypass() {
+		return s.next.GetByBoardID(boardID)
+	}
+	return s.c.bingoWinners.filter(s.c.winnersByBoard.lookup(boardID), nil), nil
+}
+
+func (s *cachedBingoWinnerStore) Create(w *models.BingoWinner) error {
+	s.written()
+	if err := s.next.Create(w); err != nil {
+		return err
+	}
+	v := canonical(s.next, *w)
+	s.apply(func() { s.c.bingoWinners.put(v) })
+	return nil
+}
+
+func (s *cachedBingoWinnerStore) DeleteByUserID(userID int) error {
+	s.written()
+	if err := s.next.DeleteByUserID(userID); err != nil {
+		return err
+	}
+	s.apply(func() { s.c.bingoWinners.removeWhere(s.c.winnersByUser.lookup(userID), nil) })
+	return nil
+}
+
+func (s *cachedBingoWinnerStore) DeleteByBoardIDAndLine(boardID int, line string) error {
+	s.written()
+	if err := s.next.DeleteByBoardIDAndLine(boardID, line); err != nil {
+		return err
+	}
+	s.apply(func() {
+		s.c.bingoWinners.removeWhere(s.c.winnersByBoard.lookup(boardID), func(w *models.BingoWinner) bool {
+			return w.Line == line
+		})
+	})
+	return nil
+}
+
+type cachedActivityStore struct {
+	cacheView
+	next ActivityStore
+}
+
+func (s *cachedActivityStore) GetRecent(limit int) ([]models.ActivityEntry, error) {
+	if s.bypass() {
+		return s.next.GetRecent(limit)
+	}
+	ids := s.c.activity.ids
+	var entries []models.ActivityEntry
+	for i := len(ids) - 1; i >= 0 && len(entries) < limit; i-- {
+		entries = append(entries, *s.c.activity.rows[ids[i]])
+	}
+	return entries, nil
+}
+
+func (s *cachedActivityStore) Create(e *models.ActivityEntry) error {
+	s.written()
+	if err := s.next.Create(e); err != nil {
+		return err
+	}
+	v := canonical(s.next, *e)
+	s.apply(func() { s.c.activity.put(v) })
+	return nil
+}
+
+type cachedOrderStore struct {
+	cacheView
+	next OrderStore
+}
+
+func isOpen(o *models.Order) bool { return o.Status == "open" }
+
+func (s *cachedOrderStore) GetAll() ([]models.Order, error) {
+	if s.bypass() {
+		return s.next.GetAll()
+	}
+	return s.c.orders.all(), nil
+}
+
+func (s *cachedOrderStore) GetByID(id int) (*models.Order, error) {
+	if s.bypass() {
+		return s.next.GetByID(id)
+	}
+	if o := s.c.orders.get(id); o != nil {
+		return o, nil
+	}
+	return nil, fmt.Errorf("order not found")
+}
+
+func (s *cachedOrderStore) GetByUserID(userID int) ([]models.Order, error) {
+	if s.bypass() {
+		return s.next.GetByUserID(userID)
+	}
+	return s.c.orders.filter(s.c.ordersByUser.lookup(userID), nil), nil
+}
+
+func (s *cachedOrderStore) GetOpen() ([]models.Order, error) {
+	if s.bypass() {
+		return s.next.GetOpen()
+	}
+	return s.c.orders.filter(s.c.ordersByStatus.lookup("open"), nil), nil
+}
+
+func (s *cachedOrderStore) GetOpenByEventID(eventID int) ([]models.Order, error) {
+	if s.bypass() {
+		return s.next.GetOpenByEventID(eventID)
+	}
+	return s.c.orders.filter(s.c.ordersByEvent.lookup(eventID), isOpen), nil
+}
+
+func (s *cachedOrderStore) GetOpenByUserID(userID int) ([]models.Order, error) {
+	if s.bypass() {
+		return s.next.GetOpenByUserID(userID)
+	}
+	return s.c.orders.filter(s.c.ordersByUser.lookup(userID), isOpen), nil
+}
+
+func (s *cachedOrderStore) Create(o *models.Order) error {
+	s.written()
+	if err := s.next.Create(o); err != nil {
+		return err
+	}
+	v := canonical(s.next, *o)
+	s.apply(func() { s.c.orders.put(v) })
+	return nil
+}
+
+func (s *cachedOrderStore) Update(o *models.Order) error {
+	s.written()
+	if err := s.next.Update(o); err != nil {
+		return err
+	}
+	v := canonical(s.next, *o)
+	s.apply(func() { s.c.orders.put(v) })
+	return nil
+}
+
+func (s *cachedOrderStore) DeleteByEventID(eventID int) error {
+	s.written()
+	if err := s.next.DeleteByEventID(eventID); err != nil {
+		return err
+	}
+	s.apply(func() { s.c.orders.removeWhere(s.c.ordersByEvent.lookup(eventID), nil) })
+	return nil
+}
@@ -1,8 +1,11 @@
 package store
 
 import (
+	"bytes"
 	"encoding/csv"
+	"io"
 	"os"
+	"path/filepath"
 	"strconv"
 )
 
@@ -14,6 +17,9 @@ func readAllRows(filePath string) ([][]string, error) {
 	defer f.Close()
 
 	r := csv.NewReader(f)
+	// Rows written after a column was added are longer than older rows and
+	// the header; fromRow handles both shapes.
+	r.FieldsPerRecord = -1
 	rows, err := r.ReadAll()
 	if err != nil {
 		return nil, err
@@ -25,27 +31,57 @@ func readAllRows(filePath string) ([][]string, error) {
 	return nil, nil
 }
 
+// writeAllRows replaces the file with header and rows.
 func writeAllRows(filePath string, header []string, rows [][]string) error {
-	f, err := os.Create(filePath)
-	if err != nil {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write(header); err != nil {
 		return err
 	}
-	defer f.Close()
-
-	w := csv.NewWriter(f)
-	defer w.Flush()
+	if err := w.WriteAll(rows); err != nil {
+		return err
+	}
+	return writeFileAtomic(filePath, buf.Bytes())
+}
 
-	if err := w.Write(header); err != nil {
+// writeFileAtomic replaces the file with data. The new contents are written
+// to a temp file in the same directory, synced and renamed over the
+// original, so a crash leaves either the old file or the new one.
+func writeFileAtomic(filePath string, data []byte) error {
+	dir, base := filepath.Split(filePath)
+	f, err := os.CreateTemp(dir, base+tempSuffix+"*")
+	if err != nil {
 		return err
 	}
-	for _, row := range rows {
-		if err := w.Write(row); err != nil {
-			return err
+	tmpPath := f.Name()
+	committed := false
+	defer func() {
+		if !committed {
+			f.Close()
+			os.Remove(tmpPath)
 		}
+	}()
+
+	if _, err := f.Write(data); err != nil {
+		return err
 	}
-	return nil
+	if err := f.Chmod(0644); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, filePath); err != nil {
+		return err
+	}
+	committed = true
+	return syncDir(dir)
 }
 
+// appendRow adds a row to the end of the file and syncs it to disk.
 func appendRow(filePath string, row []string) error {
 	f, err := os.OpenFile(filePath, os.O_APPEND|os.O_WRONLY, 0644)
 	if err != nil {
@@ -54,21 +90,116 @@ func appendRow(filePath string, row []string) error {
 	defer f.Close()
 
 	w := csv.NewWriter(f)
-	defer w.Flush()
-	return w.Write(row)
+	if err := w.Write(row); err != nil {
+		return err
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return f.Sync()
 }
 
-func nextID(filePath string) (int, error) {
-	rows, err := readAllRows(filePath)
+// tempSuffix marks the temp files writeFileAtomic renames into place. Any
+// left behind by a crash are removed by New.
+const tempSuffix = ".tmp-"
+
+// syncDir makes a rename in dir durable.
+func syncDir(dir string) error {
+	if dir == "" {
+		dir = "."
+	}
+	d, err := os.Open(dir)
 	if err != nil {
-		return 1, nil
+		return err
 	}
-	if len(rows) == 0 {
-		return 1, nil
+	defer d.Close()
+	// Not every platform can sync a directory; the rename itself has
+	// already happened, so that isn't worth failing the write over
+	d.Sync()
+	return nil
+}
+
+// repairTornTail drops a trailing row left incomplete by a crash in the
+// middle of an append: one that isn't terminated by a newline, or that ends
+// inside a quoted field. It returns the bytes dropped. A torn header is
+// rewritten from header.
+func repairTornTail(filePath, header string) (string, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return "", err
+	}
+	if len(data) == 0 {
+		// Truncated before the header was written
+		return "", os.WriteFile(filePath, []byte(header+"\n"), 0644)
+	}
+
+	lastStart, err := tornTail(data)
+	if err != nil || lastStart < 0 {
+		return "", err
+	}
+	tail := data[lastStart:]
+	if lastStart == 0 {
+		return string(tail), os.WriteFile(filePath, []byte(header+"\n"), 0644)
+	}
+
+	f, err := os.OpenFile(filePath, os.O_WRONLY, 0644)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if err := f.Truncate(lastStart); err != nil {
+		return "", err
 	}
-	lastID, err := strconv.Atoi(rows[len(rows)-1][0])
+	return string(tail), f.Sync()
+}
+
+// tornTail returns where the torn last row of a non-empty file starts, or
+// -1 if the file ends with a complete row.
+func tornTail(data []byte) (int64, error) {
+	// Find where the last record starts
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	r.ReuseRecord = true
+	var lastStart int64
+	for {
+		start := r.InputOffset()
+		if _, err := r.Read(); err == io.EOF {
+			break
+		} else if err != nil {
+			// A quoted field left open by the crash runs to the end of
+			// the file; anything else is real corruption
+			if bytes.Count(data[start:], []byte(`"`))%2 == 0 {
+				return 0, err
+			}
+			return start, nil
+		}
+		lastStart = start
+	}
+	if bytes.HasSuffix(data, []byte("\n")) {
+		return -1, nil
+	}
+	return lastStart, nil
+}
+
+// readAllAs reads every row of the file as a record.
+func readAllAs[T any](f csvFile, fromRow func([]string) *T) ([]T, error) {
+	rows, err := f.readAll()
 	if err != nil {
-		return 1, nil
+		return nil, err
+	}
+	records := make([]T, 0, len(rows))
+	for _, row := range rows {
+		records = append(records, *fromRow(row))
+	}
+	return records, nil
+}
+
+// lastID returns the ID in the first column of the last row, or 0.
+func lastID(rows [][]string) int {
+	if len(rows) == 0 {
+		return 0
 	}
-	return lastID + 1, nil
+	id, _ := strconv.Atoi(rows[len(rows)-1][0])
+	return id
 }
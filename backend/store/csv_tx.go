@@ -0,0 +1,338 @@
+package store
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// journalFile is the write-ahead journal a CSV transaction writes before
+// touching any of the data files. It only ever exists in full: it's written
+// to a temp file and renamed into place.
+const journalFile = "journal.json"
+
+// csvFile is one of the CSV store's files. Inside a transaction its reads
+// and writes go to the transaction's staged copy instead of the disk.
+type csvFile struct {
+	path     string
+	tx       *csvTx
+	seq      *sequence
+	readOnly bool
+}
+
+func (f csvFile) readAll() ([][]string, error) {
+	if f.tx == nil {
+		return readAllRows(f.path)
+	}
+	sf, err := f.tx.stage(f.path)
+	if err != nil {
+		return nil, err
+	}
+	if err := sf.load(f.path); err != nil {
+		return nil, err
+	}
+	// Callers edit the slice in place before writing it back
+	return append([][]string(nil), sf.rows...), nil
+}
+
+func (f csvFile) writeAll(header []string, rows [][]string) error {
+	if f.readOnly {
+		return ErrReadOnly
+	}
+	if f.tx == nil {
+		if err := replayJournal(filepath.Dir(f.path)); err != nil {
+			return err
+		}
+		return writeAllRows(f.path, header, rows)
+	}
+	sf, err := f.tx.stage(f.path)
+	if err != nil {
+		return err
+	}
+	sf.header = header
+	sf.rows = rows
+	sf.loaded, sf.rewritten = true, true
+	return nil
+}
+
+func (f csvFile) append(row []string) error {
+	if f.readOnly {
+		return ErrReadOnly
+	}
+	if f.tx == nil {
+		if err := replayJournal(filepath.Dir(f.path)); err != nil {
+			return err
+		}
+		return appendRow(f.path, row)
+	}
+	sf, err := f.tx.stage(f.path)
+	if err != nil {
+		return err
+	}
+	sf.rows = append(sf.rows, row)
+	return nil
+}
+
+// nextID returns the ID for a new row.
+func (f csvFile) nextID() (int, error) {
+	if f.readOnly {
+		return 0, ErrReadOnly
+	}
+	if f.tx != nil {
+		return f.tx.nextID(f.seq)
+	}
+	last, err := f.seq.current()
+	if err != nil {
+		return 0, err
+	}
+	f.seq.last = last + 1
+	return f.seq.last, nil
+}
+
+// csvTx holds the files a transaction has touched, as they will be once
+// it commits.
+type csvTx struct {
+	dataDir string
+	files   map[string]*stagedFile
+	order   []string // paths in the order they were first touched
+	// The last ID the transaction has handed out from each sequence
+	ids map[*sequence]int
+}
+
+type stagedFile struct {
+	header []string
+	rows   [][]string
+	// The file as it was on disk when the transaction first touched it.
+	// Unless it has been rewritten since, only rows past baseRows are new
+	// and committing appends them at baseSize. A file that has only been
+	// appended to is never read: until it's loaded, rows holds just the
+	// new ones.
+	baseSize  int64
+	baseRows  int
+	loaded    bool
+	rewritten bool
+}
+
+// beginCSV starts a transaction, first finishing any earlier one whose
+// commit failed part way. Until that succeeds no new transaction can start:
+// its journal would replace the one still waiting to be applied.
+func beginCSV(dataDir string, seqs map[string]*sequence) (*txn, error) {
+	if err := replayJournal(dataDir); err != nil {
+		return nil, err
+	}
+	tx := &csvTx{dataDir: dataDir, files: make(map[string]*stagedFile), ids: make(map[*sequence]int)}
+	return &txn{
+		store:    newCSVStore(dataDir, tx, seqs, false),
+		commit:   tx.commit,
+		rollback: func() {}, // nothing staged has reached the disk
+	}, nil
+}
+
+// stage returns the staged copy of the file.
+func (tx *csvTx) stage(path string) (*stagedFile, error) {
+	if sf, ok := tx.files[path]; ok {
+		return sf, nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	sf := &stagedFile{baseSize: info.Size()}
+	tx.files[path] = sf
+	tx.order = append(tx.order, path)
+	return sf, nil
+}
+
+// load reads the file's rows in ahead of any appended so far, on first
+// use.
+func (sf *stagedFile) load(path string) error {
+	if sf.loaded {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := csv.NewReader(io.LimitReader(f, sf.baseSize))
+	r.FieldsPerRecord = -1
+	rows, err := r.ReadAll()
+	if err != nil {
+		return err
+	}
+	var base [][]string
+	if len(rows) > 0 {
+		sf.header, base = rows[0], rows[1:]
+	}
+	sf.rows = append(base, sf.rows...)
+	sf.baseRows = len(base)
+	sf.loaded = true
+	return nil
+}
+
+// nextID hands out the next ID of seq without touching it, so a rollback
+// doesn't use any up.
+func (tx *csvTx) nextID(seq *sequence) (int, error) {
+	last, ok := tx.ids[seq]
+	if !ok {
+		var err error
+		if last, err = seq.current(); err != nil {
+			return 0, err
+		}
+	}
+	tx.ids[seq] = last + 1
+	return last + 1, nil
+}
+
+// journalEntry is the change a transaction makes to one file: either its
+// new contents, or rows appended at a given offset. Both can be applied any
+// number of times with the same result.
+type journalEntry struct {
+	File    string     `json:"file"` // relative to the data directory
+	Rewrite bool       `json:"rewrite,omitempty"`
+	Header  []string   `json:"header,omitempty"` // rewrites only
+	Offset  int64      `json:"offset,omitempty"` // appends only: file size before them
+	Rows    [][]string `json:"rows"`
+}
+
+// commit makes the transaction durable by writing the journal, then
+// applies it to the files and removes it. If applying fails part way the
+// journal stays behind, and commit returns the error even though the
+// transaction will still take effect: the journal is replayed before the
+// store's next write, or at the next startup.
+func (tx *csvTx) commit() error {
+	var entries []journalEntry
+	for _, path := range tx.order {
+		sf := tx.files[path]
+		e := journalEntry{File: filepath.Base(path)}
+		switch {
+		case sf.rewritten:
+			e.Rewrite, e.Header, e.Rows = true, sf.header, sf.rows
+		case len(sf.rows) > sf.baseRows:
+			e.Offset, e.Rows = sf.baseSize, sf.rows[sf.baseRows:]
+		default:
+			continue // only read
+		}
+		entries = append(entries, e)
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	if err := tx.write(entries); err != nil {
+		// The files may or may not have the transaction's rows; count
+		// from what they have
+		for seq := range tx.ids {
+			seq.seeded = false
+		}
+		return err
+	}
+	for seq, last := range tx.ids {
+		seq.last = last
+	}
+	return nil
+}
+
+// write commits the entries through the journal.
+func (tx *csvTx) write(entries []journalEntry) error {
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	journalPath := filepath.Join(tx.dataDir, journalFile)
+	if err := writeFileAtomic(journalPath, data); err != nil {
+		return fmt.Errorf("write journal: %w", err)
+	}
+	if err := applyJournal(tx.dataDir, entries); err != nil {
+		return fmt.Errorf("apply journal: %w", err)
+	}
+	if err := os.Remove(journalPath); err != nil {
+		return err
+	}
+	return syncDir(tx.dataDir)
+}
+
+func applyJournal(dataDir string, entries []journalEntry) error {
+	for _, e := range entries {
+		path := filepath.Join(dataDir, e.File)
+		if e.Rewrite {
+			if err := writeAllRows(path, e.Header, e.Rows); err != nil {
+				return fmt.Errorf("%s: %w", e.File, err)
+			}
+			continue
+		}
+		if err := appendRowsAt(path, e.Offset, e.Rows); err != nil {
+			return fmt.Errorf("%s: %w", e.File, err)
+		}
+	}
+	return nil
+}
+
+// appendRowsAt cuts the file back to offset, dropping anything a previous
+// attempt wrote past it, and appends rows there.
+func appendRowsAt(path string, offset int64, rows [][]string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() < offset {
+		return fmt.Errorf("file is shorter than the journal expects (%d < %d bytes)", info.Size(), offset)
+	}
+	if err := f.Truncate(offset); err != nil {
+		return err
+	}
+	if _, err := f.Seek(offset, 0); err != nil {
+		return err
+	}
+	w := csv.NewWriter(f)
+	if err := w.WriteAll(rows); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// recoverJournal finishes a transaction whose journal was written before a
+// crash, and discards one whose journal wasn't, leaving the files as they
+// were before it began.
+func recoverJournal(dataDir string) error {
+	partial, _ := filepath.Glob(filepath.Join(dataDir, journalFile+tempSuffix+"*"))
+	for _, p := range partial {
+		log.Printf("store: rolling back unfinished transaction")
+		os.Remove(p)
+	}
+
+	return replayJournal(dataDir)
+}
+
+// replayJournal applies and removes the journal of a committed transaction
+// that hasn't been applied in full, if there is one.
+func replayJournal(dataDir string) error {
+	journalPath := filepath.Join(dataDir, journalFile)
+	data, err := os.ReadFile(journalPath)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("replay journal: %w", err)
+	}
+	var entries []journalEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("replay journal: %w", err)
+	}
+	log.Printf("store: replaying committed transaction (%d files)", len(entries))
+	if err := applyJournal(dataDir, entries); err != nil {
+		return fmt.Errorf("replay journal: %w", err)
+	}
+	if err := os.Remove(journalPath); err != nil {
+		return err
+	}
+	return syncDir(dataDir)
+}
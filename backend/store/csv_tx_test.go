@@ -0,0 +1,205 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"pauls-bach/models"
+)
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func usernames(t *testing.T, s *Store) []string {
+	t.Helper()
+	users, err := s.Users.GetAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, u := range users {
+		names = append(names, u.Username)
+	}
+	return names
+}
+
+// A journal left by a crash is replayed at startup, over whatever part of
+// it had reached the files; an unfinished one is discarded.
+func TestRecoverJournal(t *testing.T) {
+	dir := t.TempDir()
+	s, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Users.Create(&models.User{Username: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	users := filepath.Join(dir, "users.csv")
+	info, err := os.Stat(users)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// bob's transaction committed and was half applied when the server
+	// died; carol's never got as far as committing
+	err = writeFileAtomic(filepath.Join(dir, journalFile), []byte(`[{"file":"users.csv","offset":`+
+		strconv.FormatInt(info.Size(), 10)+`,"rows":[["2","bob","","0","false","false","2024-01-01T00:00:00Z"]]}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(users, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("2,bo")
+	f.Close()
+	if err := os.WriteFile(filepath.Join(dir, journalFile+tempSuffix+"1"), []byte(`[{"file":"users.csv"`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := usernames(t, s); len(got) != 2 || got[0] != "alice" || got[1] != "bob" {
+		t.Errorf("users %v, want [alice bob]", got)
+	}
+	if left, _ := filepath.Glob(filepath.Join(dir, journalFile+"*")); len(left) != 0 {
+		t.Errorf("journal files left behind: %v", left)
+	}
+}
+
+// A commit that fails while applying its journal leaves it to be finished
+// before the next write, and the cache is read back once it has been.
+func TestCommitFailsDuringApply(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open("csv", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ledger := filepath.Join(dir, "transactions.csv")
+
+	err = s.Transact(func(s *Store) error {
+		bob := &models.User{Username: "bob"}
+		if err := s.Users.Create(bob); err != nil {
+			return err
+		}
+		if _, err := s.Post(&models.Transaction{UserID: bob.ID, TxType: "grant", Points: 100}); err != nil {
+			return err
+		}
+		// users.csv applies, then the ledger can't be opened
+		if err := os.Rename(ledger, ledger+".bak"); err != nil {
+			return err
+		}
+		return os.Mkdir(ledger, 0755)
+	})
+	if err == nil {
+		t.Fatal("commit succeeded with the ledger unwritable")
+	}
+	if _, err := os.Stat(filepath.Join(dir, journalFile)); err != nil {
+		t.Fatalf("journal gone after a failed apply: %v", err)
+	}
+	if _, err := s.Users.GetByUsername("bob"); err == nil {
+		t.Error("cache has bob before his transaction is applied")
+	}
+
+	// Still failing: no new transaction may replace the journal
+	err = s.Transact(func(s *Store) error {
+		return s.Users.Create(&models.User{Username: "carol"})
+	})
+	if err == nil {
+		t.Fatal("transaction started with the journal unapplied")
+	}
+
+	if err := os.Remove(ledger); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(ledger+".bak", ledger); err != nil {
+		t.Fatal(err)
+	}
+	err = s.Transact(func(s *Store) error {
+		return s.Users.Create(&models.User{Username: "carol"})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(s *Store) {
+		t.Helper()
+		bob, err := s.Users.GetByUsername("bob")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bob.Balance != 100 {
+			t.Errorf("bob's balance %d, want 100", bob.Balance)
+		}
+		if txs, _ := s.Transactions.GetByUserID(bob.ID); len(txs) != 1 {
+			t.Errorf("bob has %d ledger entries, want 1", len(txs))
+		}
+		carol, err := s.Users.GetByUsername("carol")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if carol.ID != bob.ID+1 {
+			t.Errorf("carol got ID %d, want %d", carol.ID, bob.ID+1)
+		}
+	}
+	check(s)
+	reopened, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(reopened)
+}
+
+func TestRepairTornTail(t *testing.T) {
+	const header = "id,name"
+	tests := []struct {
+		name     string
+		data     string
+		want     string
+		wantTorn string
+	}{
+		{"intact", "id,name\n1,a\n2,b\n", "id,name\n1,a\n2,b\n", ""},
+		{"header only", "id,name\n", "id,name\n", ""},
+		{"unterminated row", "id,name\n1,a\n2,b", "id,name\n1,a\n", "2,b"},
+		{"open quote", "id,name\n1,a\n2,\"b\nc", "id,name\n1,a\n", "2,\"b\nc"},
+		{"quoted newline", "id,name\n1,\"a\nb\"\n", "id,name\n1,\"a\nb\"\n", ""},
+		{"empty", "", "id,name\n", ""},
+		{"torn header", "id,na", "id,name\n", "id,na"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "f.csv")
+			if err := os.WriteFile(path, []byte(tt.data), 0644); err != nil {
+				t.Fatal(err)
+			}
+			torn, err := repairTornTail(path, header)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if torn != tt.wantTorn {
+				t.Errorf("dropped %q, want %q", torn, tt.wantTorn)
+			}
+			if got := readFile(t, path); got != tt.want {
+				t.Errorf("file is %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// A closed quote with an even count of quotes is corruption, not a
+	// torn row
+	path := filepath.Join(t.TempDir(), "f.csv")
+	os.WriteFile(path, []byte("id,name\n1,a\"b\"\n"), 0644)
+	if _, err := repairTornTail(path, header); err == nil {
+		t.Error("repaired a malformed row")
+	}
+}
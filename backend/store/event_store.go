@@ -1,22 +1,24 @@
 package store
 
 import (
+	"encoding/json"
 	"fmt"
 	"pauls-bach/models"
 	"strconv"
 	"time"
 )
 
-type EventStore struct {
-	filePath string
+type csvEventStore struct {
+	file csvFile
 }
 
-var eventHeader = []string{"id", "title", "description", "event_type", "status", "winning_outcome_id", "created_at", "resolved_at", "creator_id", "bounty_paid"}
+var eventHeader = []string{"id", "title", "description", "event_type", "status", "resolution", "created_at", "resolved_at", "creator_id", "bounty_paid", "pricing_model", "liquidity", "closes_at", "voided", "scalar_min", "scalar_max", "resolved_value", "allow_hedging", "rules"}
 
-func (s *EventStore) toRow(e *models.Event) []string {
-	winID := ""
-	if e.WinningOutcomeID != 0 {
-		winID = strconv.Itoa(e.WinningOutcomeID)
+func (s *csvEventStore) toRow(e *models.Event) []string {
+	resolution := ""
+	if len(e.Resolution) > 0 {
+		b, _ := json.Marshal(e.Resolution)
+		resolution = string(b)
 	}
 	creatorID := ""
 	if e.CreatorID != 0 {
@@ -26,45 +28,104 @@ func (s *EventStore) toRow(e *models.Event) []string {
 	if e.BountyPaid {
 		bounty = "1"
 	}
+	voided := "0"
+	if e.Voided {
+		voided = "1"
+	}
+	rules := ""
+	if e.Rules != nil {
+		b, _ := json.Marshal(e.Rules)
+		rules = string(b)
+	}
+	allowHedging := "0"
+	if e.AllowHedging {
+		allowHedging = "1"
+	}
+	scalarMin, scalarMax := "", ""
+	if e.EventType == "scalar" {
+		scalarMin = strconv.FormatFloat(e.ScalarMin, 'f', -1, 64)
+		scalarMax = strconv.FormatFloat(e.ScalarMax, 'f', -1, 64)
+	}
+	resolvedValue := ""
+	if e.ResolvedValue != nil {
+		resolvedValue = strconv.FormatFloat(*e.ResolvedValue, 'f', -1, 64)
+	}
+	liquidity := ""
+	if e.Liquidity != 0 {
+		liquidity = strconv.FormatFloat(e.Liquidity, 'f', -1, 64)
+	}
 	return []string{
 		strconv.Itoa(e.ID),
 		e.Title,
 		e.Description,
 		e.EventType,
 		e.Status,
-		winID,
+		resolution,
 		e.CreatedAt,
 		e.ResolvedAt,
 		creatorID,
 		bounty,
+		e.PricingModel,
+		liquidity,
+		e.ClosesAt,
+		voided,
+		scalarMin,
+		scalarMax,
+		resolvedValue,
+		allowHedging,
+		rules,
 	}
 }
 
-func (s *EventStore) fromRow(row []string) (*models.Event, error) {
+func (s *csvEventStore) fromRow(row []string) (*models.Event, error) {
 	id, _ := strconv.Atoi(row[0])
-	winID, _ := strconv.Atoi(row[5])
 	e := &models.Event{
-		ID:               id,
-		Title:            row[1],
-		Description:      row[2],
-		EventType:        row[3],
-		Status:           row[4],
-		WinningOutcomeID: winID,
-		CreatedAt:        row[6],
-		ResolvedAt:       row[7],
-	}
-	// Handle new fields (backwards-compatible with old CSVs)
-	if len(row) > 8 {
-		e.CreatorID, _ = strconv.Atoi(row[8])
-	}
-	if len(row) > 9 && row[9] == "1" {
-		e.BountyPaid = true
+		ID:           id,
+		Title:        row[1],
+		Description:  row[2],
+		EventType:    row[3],
+		Status:       row[4],
+		CreatedAt:    row[6],
+		ResolvedAt:   row[7],
+		BountyPaid:   row[9] == "1",
+		PricingModel: row[10],
+		ClosesAt:     row[12],
+		Voided:       row[13] == "1",
+		AllowHedging: row[17] == "1",
+	}
+	if row[5] != "" {
+		if err := json.Unmarshal([]byte(row[5]), &e.Resolution); err != nil {
+			return nil, err
+		}
+	}
+	e.CreatorID, _ = strconv.Atoi(row[8])
+	e.Liquidity, _ = strconv.ParseFloat(row[11], 64)
+	e.ScalarMin, _ = strconv.ParseFloat(row[14], 64)
+	e.ScalarMax, _ = strconv.ParseFloat(row[15], 64)
+	if row[16] != "" {
+		if v, err := strconv.ParseFloat(row[16], 64); err == nil {
+			e.ResolvedValue = &v
+		}
+	}
+	if row[18] != "" {
+		var rules models.EventRules
+		if err := json.Unmarshal([]byte(row[18]), &rules); err == nil {
+			e.Rules = &rules
+		}
 	}
 	return e, nil
 }
 
-func (s *EventStore) GetAll() ([]models.Event, error) {
-	rows, err := readAllRows(s.filePath)
+// canonical returns e as it reads back from the file.
+func (s *csvEventStore) canonical(e models.Event) models.Event {
+	if v, err := s.fromRow(s.toRow(&e)); err == nil {
+		return *v
+	}
+	return e
+}
+
+func (s *csvEventStore) GetAll() ([]models.Event, error) {
+	rows, err := s.file.readAll()
 	if err != nil {
 		return nil, err
 	}
@@ -79,8 +140,8 @@ func (s *EventStore) GetAll() ([]models.Event, error) {
 	return events, nil
 }
 
-func (s *EventStore) GetByID(id int) (*models.Event, error) {
-	rows, err := readAllRows(s.filePath)
+func (s *csvEventStore) GetByID(id int) (*models.Event, error) {
+	rows, err := s.file.readAll()
 	if err != nil {
 		return nil, err
 	}
@@ -93,18 +154,18 @@ func (s *EventStore) GetByID(id int) (*models.Event, error) {
 	return nil, fmt.Errorf("event not found")
 }
 
-func (s *EventStore) Create(e *models.Event) error {
-	id, err := nextID(s.filePath)
+func (s *csvEventStore) Create(e *models.Event) error {
+	id, err := s.file.nextID()
 	if err != nil {
 		return err
 	}
 	e.ID = id
 	e.CreatedAt = time.Now().Format(time.RFC3339)
-	return appendRow(s.filePath, s.toRow(e))
+	return s.file.append(s.toRow(e))
 }
 
-func (s *EventStore) Update(e *models.Event) error {
-	rows, err := readAllRows(s.filePath)
+func (s *csvEventStore) Update(e *models.Event) error {
+	rows, err := s.file.readAll()
 	if err != nil {
 		return err
 	}
@@ -112,14 +173,14 @@ func (s *EventStore) Update(e *models.Event) error {
 		rowID, _ := strconv.Atoi(row[0])
 		if rowID == e.ID {
 			rows[i] = s.toRow(e)
-			return writeAllRows(s.filePath, eventHeader, rows)
+			return s.file.writeAll(eventHeader, rows)
 		}
 	}
 	return fmt.Errorf("event not found")
 }
 
-func (s *EventStore) Delete(id int) error {
-	rows, err := readAllRows(s.filePath)
+func (s *csvEventStore) Delete(id int) error {
+	rows, err := s.file.readAll()
 	if err != nil {
 		return err
 	}
@@ -130,5 +191,5 @@ func (s *EventStore) Delete(id int) error {
 			kept = append(kept, row)
 		}
 	}
-	return writeAllRows(s.filePath, eventHeader, kept)
+	return s.file.writeAll(eventHeader, kept)
 }
@@ -0,0 +1,124 @@
+package store
+
+import "pauls-bach/models"
+
+// The per-entity stores. Each backend (CSV files, SQLite) implements all of
+// them; see New and NewSQLite. Create assigns the new record's ID and, unless
+// noted otherwise, its CreatedAt. Lookups of a single record by ID return an
+// error when it doesn't exist, except where noted.
+
+type UserStore interface {
+	GetAll() ([]models.User, error)
+	GetByID(id int) (*models.User, error)
+	GetByUsername(username string) (*models.User, error)
+	Create(u *models.User) error
+	// Update writes u as is. Balance changes go through Store.Post instead
+	Update(u *models.User) error
+}
+
+type EventStore interface {
+	GetAll() ([]models.Event, error)
+	GetByID(id int) (*models.Event, error)
+	Create(e *models.Event) error
+	Update(e *models.Event) error
+	Delete(id int) error
+}
+
+type OutcomeStore interface {
+	GetAll() ([]models.Outcome, error)
+	GetByEventID(eventID int) ([]models.Outcome, error)
+	// GetByID returns nil, nil if the outcome doesn't exist
+	GetByID(id int) (*models.Outcome, error)
+	Create(o *models.Outcome) error
+	Update(o *models.Outcome) error
+	DeleteByEventID(eventID int) error
+}
+
+type PositionStore interface {
+	GetAll() ([]models.Position, error)
+	GetByUserID(userID int) ([]models.Position, error)
+	GetByEventID(eventID int) ([]models.Position, error)
+	GetByUserAndEvent(userID, eventID int) ([]models.Position, error)
+	// GetByUserEventOutcome returns nil, nil if the user holds no position
+	GetByUserEventOutcome(userID, eventID, outcomeID int) (*models.Position, error)
+	// Create keeps a CreatedAt that is already set
+	Create(p *models.Position) error
+	Update(p *models.Position) error
+	Delete(id int) error
+	DeleteByEventID(eventID int) error
+}
+
+// ResolvedPositionStore keeps the positions an event held when it was
+// resolved, so unresolving can put them back.
+type ResolvedPositionStore interface {
+	GetAll() ([]models.Position, error)
+	GetByEventID(eventID int) ([]models.Position, error)
+	// Create stores p as is, keeping its ID and CreatedAt
+	Create(p *models.Position) error
+	DeleteByEventID(eventID int) error
+}
+
+// TransactionStore is the ledger, which is never rewritten; see Post.
+type TransactionStore interface {
+	GetAll() ([]models.Transaction, error)
+	GetByUserID(userID int) ([]models.Transaction, error)
+	GetByEventID(eventID int) ([]models.Transaction, error)
+	// Create appends to the ledger; use Store.Post, which also updates the
+	// user's balance
+	Create(t *models.Transaction) error
+}
+
+type OddsSnapshotStore interface {
+	GetAll() ([]models.OddsSnapshot, error)
+	GetByEventID(eventID int) ([]*models.OddsSnapshot, error)
+	// LastSnapshotTimeByEvent returns the time of each event's latest snapshot
+	LastSnapshotTimeByEvent() (map[int]string, error)
+	// Create keeps a CreatedAt that is already set
+	Create(o *models.OddsSnapshot) error
+	DeleteByEventID(eventID int) error
+	// DeleteByIDs deletes the snapshots with the given IDs, for compaction
+	DeleteByIDs(ids []int) error
+}
+
+type BingoEventStore interface {
+	GetAll() ([]models.BingoEvent, error)
+	GetByID(id int) (*models.BingoEvent, error)
+	Create(e *models.BingoEvent) error
+	Update(e *models.BingoEvent) error
+}
+
+type BingoBoardStore interface {
+	GetAll() ([]models.BingoBoard, error)
+	GetByID(id int) (*models.BingoBoard, error)
+	// GetByUserID returns nil, nil if the user has no board yet
+	GetByUserID(userID int) (*models.BingoBoard, error)
+	Create(b *models.BingoBoard) error
+	Update(b *models.BingoBoard) error
+	DeleteByUserID(userID int) error
+}
+
+type BingoWinnerStore interface {
+	GetAll() ([]models.BingoWinner, error)
+	GetByBoardID(boardID int) ([]models.BingoWinner, error)
+	Create(w *models.BingoWinner) error
+	DeleteByUserID(userID int) error
+	DeleteByBoardIDAndLine(boardID int, line string) error
+}
+
+type ActivityStore interface {
+	// GetRecent returns the latest limit entries, newest first
+	GetRecent(limit int) ([]models.ActivityEntry, error)
+	Create(e *models.ActivityEntry) error
+}
+
+type OrderStore interface {
+	GetAll() ([]models.Order, error)
+	GetByID(id int) (*models.Order, error)
+	GetByUserID(userID int) ([]models.Order, error)
+	GetOpen() ([]models.Order, error)
+	GetOpenByEventID(eventID int) ([]models.Order, error)
+	GetOpenByUserID(userID int) ([]models.Order, error)
+	Create(o *models.Order) error
+	Update(o *models.Order) error
+	DeleteByEventID(eventID int) error
+}
@@ -0,0 +1,77 @@
+package store
+
+import (
+	"log"
+
+	"pauls-bach/models"
+)
+
+// The transactions table is the ledger. Every change to a user's balance is
+// posted to it as an entry, and User.Balance is a projection of the ledger
+// kept so reads don't have to add it up. The ledger is only ever appended
+// to; RebuildBalances recomputes the projection from it.
+
+// Post appends entry to the ledger and applies it to its user's balance,
+// both or neither. It returns the user with the new balance.
+func (s *Store) Post(entry *models.Transaction) (*models.User, error) {
+	var user *models.User
+	err := s.Transact(func(s *Store) error {
+		var err error
+		if user, err = s.Users.GetByID(entry.UserID); err != nil {
+			return err
+		}
+		if err := s.Transactions.Create(entry); err != nil {
+			return err
+		}
+		user.Balance += entry.Delta()
+		return s.Users.Update(user)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// LedgerBalances adds up every user's ledger entries. Users without any
+// are missing from the map; their balance should be 0.
+func (s *Store) LedgerBalances() (map[int]int, error) {
+	txs, err := s.Transactions.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	balances := make(map[int]int)
+	for i := range txs {
+		balances[txs[i].UserID] += txs[i].Delta()
+	}
+	return balances, nil
+}
+
+// RebuildBalances sets every balance that disagrees with the ledger to the
+// ledger's total and returns how many it changed.
+func (s *Store) RebuildBalances() (int, error) {
+	fixed := 0
+	err := s.Transact(func(s *Store) error {
+		balances, err := s.LedgerBalances()
+		if err != nil {
+			return err
+		}
+		users, err := s.Users.GetAll()
+		if err != nil {
+			return err
+		}
+		for i := range users {
+			u := &users[i]
+			if u.Balance == balances[u.ID] {
+				continue
+			}
+			log.Printf("store: balance of user %d (%s) rebuilt from the ledger: %d -> %d", u.ID, u.Username, u.Balance, balances[u.ID])
+			u.Balance = balances[u.ID]
+			if err := s.Users.Update(u); err != nil {
+				return err
+			}
+			fixed++
+		}
+		return nil
+	})
+	return fixed, err
+}
@@ -0,0 +1,260 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"pauls-bach/models"
+)
+
+// schemaVersionFile records the last migration the CSV files in a data
+// directory have had. A directory without one is at version 0: anything
+// written before migrations existed.
+const schemaVersionFile = "schema_version"
+
+// A migration brings every CSV file in a data directory from the previous
+// version's layout to its own. Migrations run in order at startup, each one
+// at most once per directory. A crash part way through one means it runs
+// again, so it has to cope with files it has already converted.
+type migration struct {
+	version int
+	name    string
+	up      func(dataDir string) error
+}
+
+// To change a file's layout, add a migration at the end and update the
+// store's header, toRow and fromRow to the new layout.
+var migrations = []migration{
+	{1, "add rarity to bingo events", migrateBingoEventRarity},
+	{2, "add bingo flag to users", migrateUserBingo},
+	{3, "give every event row all columns and a JSON resolution", migrateEventColumns},
+	{4, "add expected value to odds snapshots", migrateOddsSnapshotExpectedValue},
+	{5, "record balances in the transaction ledger", migrateLedger},
+}
+
+// SchemaVersion is the layout of the data files this build reads and writes.
+var SchemaVersion = migrations[len(migrations)-1].version
+
+// migrate runs the migrations dataDir hasn't had yet. It refuses to touch a
+// directory written by a newer build.
+func migrate(dataDir string) error {
+	version, err := ReadSchemaVersion(dataDir)
+	if err != nil {
+		return err
+	}
+	if version == 0 {
+		// A new data directory starts out at the current layout
+		if _, err := os.Stat(filepath.Join(dataDir, "users.csv")); os.IsNotExist(err) {
+			return writeSchemaVersion(dataDir, SchemaVersion)
+		}
+	}
+	for _, m := range migrations {
+		if m.version <= version {
+			continue
+		}
+		log.Printf("store: migrating data to schema version %d: %s", m.version, m.name)
+		if err := m.up(dataDir); err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+		}
+		if err := writeSchemaVersion(dataDir, m.version); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkSchemaVersion fails if dataDir was written by a newer build, whose
+// files this one would misread.
+func checkSchemaVersion(dataDir string) error {
+	version, err := ReadSchemaVersion(dataDir)
+	if err != nil {
+		return err
+	}
+	if version > SchemaVersion {
+		return fmt.Errorf("data in %s has schema version %d but this build only knows up to %d; run a newer build", dataDir, version, SchemaVersion)
+	}
+	return nil
+}
+
+// ReadSchemaVersion returns the schema version of the data files in
+// dataDir.
+func ReadSchemaVersion(dataDir string) (int, error) {
+	data, err := os.ReadFile(filepath.Join(dataDir, schemaVersionFile))
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	version, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", schemaVersionFile, err)
+	}
+	return version, nil
+}
+
+func writeSchemaVersion(dataDir string, version int) error {
+	return writeFileAtomic(filepath.Join(dataDir, schemaVersionFile), []byte(strconv.Itoa(version)+"\n"))
+}
+
+// rewriteRows passes every row of the file through fix and writes the
+// result back under header. A missing file is left alone.
+func rewriteRows(dataDir, file string, header []string, fix func(row []string) ([]string, error)) error {
+	path := filepath.Join(dataDir, file)
+	rows, err := readAllRows(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for i, row := range rows {
+		if rows[i], err = fix(row); err != nil {
+			return fmt.Errorf("%s row %s: %w", file, row[0], err)
+		}
+	}
+	return writeAllRows(path, header, rows)
+}
+
+// padRow extends row with empty fields to n columns.
+func padRow(row []string, n int) []string {
+	for len(row) < n {
+		row = append(row, "")
+	}
+	return row
+}
+
+func migrateBingoEventRarity(dataDir string) error {
+	return rewriteRows(dataDir, "bingo_events.csv", bingoEventHeader, func(row []string) ([]string, error) {
+		// id,title,resolved,created_at -> id,title,rarity,resolved,created_at
+		if len(row) == 4 {
+			row = []string{row[0], row[1], "common", row[2], row[3]}
+		}
+		return row, nil
+	})
+}
+
+func migrateUserBingo(dataDir string) error {
+	return rewriteRows(dataDir, "users.csv", userHeader, func(row []string) ([]string, error) {
+		// ...,is_admin,created_at -> ...,is_admin,bingo,created_at
+		if len(row) == 6 {
+			row = []string{row[0], row[1], row[2], row[3], row[4], "false", row[5]}
+		}
+		return row, nil
+	})
+}
+
+func migrateEventColumns(dataDir string) error {
+	return rewriteRows(dataDir, "events.csv", eventHeader, func(row []string) ([]string, error) {
+		row = padRow(row, 19)
+		// The resolution used to be the winning outcome's ID
+		if winID, err := strconv.Atoi(row[5]); err == nil {
+			row[5] = ""
+			if winID != 0 {
+				b, _ := json.Marshal([]models.ResolutionWeight{{OutcomeID: winID, Weight: 1}})
+				row[5] = string(b)
+			}
+		}
+		if row[9] == "" {
+			row[9] = "0" // bounty_paid
+		}
+		if row[10] == "" {
+			row[10] = "pool"
+		}
+		if row[13] == "" {
+			row[13] = "0" // voided
+		}
+		if row[17] == "" {
+			row[17] = "0" // allow_hedging
+		}
+		return row, nil
+	})
+}
+
+func migrateOddsSnapshotExpectedValue(dataDir string) error {
+	return rewriteRows(dataDir, "odds_snapshots.csv", oddsSnapshotHeader, func(row []string) ([]string, error) {
+		return padRow(row, 6), nil
+	})
+}
+
+// migrateLedger turns transactions.csv into the ledger the balances are
+// derived from. It adds the reason column, gives creator bounties their own
+// type, and appends the entries that account for each user's balance as it
+// stands; see ledgerOpeningEntries.
+func migrateLedger(dataDir string) error {
+	userRows, err := readAllRows(filepath.Join(dataDir, "users.csv"))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var users []models.User
+	for _, row := range userRows {
+		id, _ := strconv.Atoi(row[0])
+		balance, _ := strconv.Atoi(row[3])
+		users = append(users, models.User{ID: id, Username: row[1], Balance: balance, IsAdmin: row[4] == "true", CreatedAt: row[6]})
+	}
+
+	path := filepath.Join(dataDir, "transactions.csv")
+	rows, err := readAllRows(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	var txs []models.Transaction
+	for i, row := range rows {
+		row = padRow(row, 9)
+		switch {
+		case row[4] == "adjustment":
+			row[4] = "admin_adjust"
+		case row[4] == "bonus" && row[3] == "0":
+			row[4] = "bounty"
+		}
+		rows[i] = row
+		userID, _ := strconv.Atoi(row[1])
+		points, _ := strconv.Atoi(row[6])
+		txs = append(txs, models.Transaction{UserID: userID, TxType: row[4], Points: points})
+	}
+
+	id := lastID(rows)
+	for _, t := range ledgerOpeningEntries(users, txs, time.Now().Format(time.RFC3339)) {
+		id++
+		rows = append(rows, []string{strconv.Itoa(id), strconv.Itoa(t.UserID), "0", "0", t.TxType, "0.000000", strconv.Itoa(t.Points), t.CreatedAt, t.Reason})
+	}
+	return writeAllRows(path, transactionHeader, rows)
+}
+
+// ledgerOpeningEntries returns what the ledger needs so it adds up to the
+// balances users had before it existed: a grant of the starting balance for
+// each player, and an adjustment for whatever the old transactions don't
+// account for, such as admin edits and deleted events' refunds. Users that
+// already have a grant are left alone, so running it twice adds nothing.
+func ledgerOpeningEntries(users []models.User, txs []models.Transaction, now string) []models.Transaction {
+	sums := make(map[int]int)
+	granted := make(map[int]bool)
+	for i := range txs {
+		sums[txs[i].UserID] += txs[i].Delta()
+		if txs[i].TxType == "grant" {
+			granted[txs[i].UserID] = true
+		}
+	}
+
+	var entries []models.Transaction
+	for _, u := range users {
+		if granted[u.ID] {
+			continue
+		}
+		sum := sums[u.ID]
+		if !u.IsAdmin {
+			entries = append(entries, models.Transaction{UserID: u.ID, TxType: "grant", Points: models.StartingBalance, Reason: "starting balance", CreatedAt: u.CreatedAt})
+			sum += models.StartingBalance
+		}
+		if u.Balance != sum {
+			entries = append(entries, models.Transaction{UserID: u.ID, TxType: "admin_adjust", Points: u.Balance - sum, Reason: "balance before the ledger", CreatedAt: now})
+		}
+	}
+	return entries
+}
@@ -0,0 +1,98 @@
+package store
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestMigrateLedger opens a data directory written before the ledger
+// (schema version 4) and checks its balances come through migration 5 as
+// they were.
+func TestMigrateLedger(t *testing.T) {
+	dir := t.TempDir()
+	users := [][]string{
+		{"1", "admin", "", "0", "true", "false", "2024-01-01T00:00:00Z"},
+		// 1000 - 100 bought + 30 adjusted + 10 bounty + 5 bonus + 55 unaccounted for
+		{"2", "bob", "", "1000", "false", "false", "2024-01-01T00:00:00Z"},
+		// 1000 - 150 bought, all accounted for
+		{"3", "carol", "", "850", "false", "false", "2024-01-01T00:00:00Z"},
+	}
+	if err := writeAllRows(filepath.Join(dir, "users.csv"), userHeader, users); err != nil {
+		t.Fatal(err)
+	}
+	// Version 4 transactions had no reason
+	txs := [][]string{
+		{"1", "2", "1", "1", "buy", "100.000000", "100", "2024-01-02T00:00:00Z"},
+		{"2", "2", "0", "0", "adjustment", "0.000000", "30", "2024-01-02T00:00:00Z"},
+		{"3", "2", "1", "0", "bonus", "0.000000", "10", "2024-01-02T00:00:00Z"},
+		{"4", "2", "1", "1", "bonus", "0.000000", "5", "2024-01-03T00:00:00Z"},
+		{"5", "3", "1", "2", "buy", "150.000000", "150", "2024-01-03T00:00:00Z"},
+	}
+	if err := writeAllRows(filepath.Join(dir, "transactions.csv"), transactionHeader[:8], txs); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeSchemaVersion(dir, 4); err != nil {
+		t.Fatal(err)
+	}
+	before := map[int]int{1: 0, 2: 1000, 3: 850}
+
+	s, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version, err := ReadSchemaVersion(dir); err != nil || version != SchemaVersion {
+		t.Errorf("schema version %d (%v), want %d", version, err, SchemaVersion)
+	}
+	bob, err := s.Transactions.GetByUserID(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	types := make(map[string]int)
+	for _, tx := range bob {
+		types[tx.TxType]++
+	}
+	want := map[string]int{"buy": 1, "admin_adjust": 2, "bounty": 1, "bonus": 1, "grant": 1}
+	for typ, n := range want {
+		if types[typ] != n {
+			t.Errorf("%d %q transactions, want %d (all: %v)", types[typ], typ, n, types)
+		}
+	}
+
+	// The ledger adds up to the old balances, so rebuilding changes nothing
+	fixed, err := s.RebuildBalances()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fixed != 0 {
+		t.Errorf("rebuilt %d balances, want 0", fixed)
+	}
+	balances, err := s.LedgerBalances()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for userID, balance := range before {
+		if balances[userID] != balance {
+			t.Errorf("user %d's ledger adds up to %d, want %d", userID, balances[userID], balance)
+		}
+		if u, _ := s.Users.GetByID(userID); u.Balance != balance {
+			t.Errorf("user %d's balance %d, want %d", userID, u.Balance, balance)
+		}
+	}
+
+	// Reopening doesn't migrate again, and neither does rerunning the
+	// migration after a crash
+	ledger := readFile(t, filepath.Join(dir, "transactions.csv"))
+	if _, err := New(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := migrateLedger(dir); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(dir, "transactions.csv")); got != ledger {
+		t.Errorf("ledger changed from\n%s\nto\n%s", ledger, got)
+	}
+	if n := strings.Count(ledger, "\n") - 1; n != len(txs)+3 {
+		t.Errorf("%d ledger rows, want %d: the old ones, a grant each for bob and carol and bob's adjustment", n, len(txs)+3)
+	}
+}
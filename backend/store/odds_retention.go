@@ -0,0 +1,120 @@
+package store
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"pauls-bach/models"
+)
+
+// A snapshot is taken of every outcome's odds on each trade, so busy events
+// pile up thousands of them. Old ones are only ever drawn on a chart, where
+// one point a minute (or an hour) looks the same, so CompactOddsSnapshots
+// thins them out.
+
+// OddsRetention is how long odds snapshots are kept at full detail.
+// Snapshots older than MinuteAfter are thinned to one per outcome per
+// minute, and older than HourAfter to one per outcome per hour.
+type OddsRetention struct {
+	MinuteAfter time.Duration
+	HourAfter   time.Duration
+}
+
+// DefaultOddsRetention keeps a day at full detail and a week per minute.
+var DefaultOddsRetention = OddsRetention{MinuteAfter: 24 * time.Hour, HourAfter: 7 * 24 * time.Hour}
+
+func (r OddsRetention) Validate() error {
+	if r.MinuteAfter <= 0 || r.HourAfter <= 0 {
+		return fmt.Errorf("odds retention thresholds must be positive")
+	}
+	if r.HourAfter < r.MinuteAfter {
+		return fmt.Errorf("odds are kept per minute for %s but per hour after %s; the hourly threshold must come later", r.MinuteAfter, r.HourAfter)
+	}
+	return nil
+}
+
+// bucket returns the start of the period the snapshot taken at t is merged
+// into, or false if it's recent enough to keep as is.
+func (r OddsRetention) bucket(t, now time.Time) (time.Time, bool) {
+	switch age := now.Sub(t); {
+	case age >= r.HourAfter:
+		return t.Truncate(time.Hour), true
+	case age >= r.MinuteAfter:
+		return t.Truncate(time.Minute), true
+	}
+	return time.Time{}, false
+}
+
+// CompactOddsSnapshots applies the retention policy and returns how many
+// snapshots it deleted. Of the snapshots of an outcome in the same bucket it
+// keeps the latest, which is the odds as they stood at the end of it. The
+// first and last snapshot of every outcome are always kept, so an event's
+// chart still starts and ends where it did.
+func (s *Store) CompactOddsSnapshots(r OddsRetention, now time.Time) (int, error) {
+	snapshots, err := s.OddsSnapshots.GetAll()
+	if err != nil {
+		return 0, err
+	}
+	drop := compactOdds(snapshots, r, now)
+	if len(drop) == 0 {
+		return 0, nil
+	}
+	if err := s.OddsSnapshots.DeleteByIDs(drop); err != nil {
+		return 0, err
+	}
+	log.Printf("store: compacted %d of %d odds snapshots", len(drop), len(snapshots))
+	return len(drop), nil
+}
+
+// compactOdds returns the IDs of the snapshots the policy deletes, sorted.
+func compactOdds(snapshots []models.OddsSnapshot, r OddsRetention, now time.Time) []int {
+	type series struct{ eventID, outcomeID int }
+	type bucketKey struct {
+		series
+		start int64
+	}
+	// Snapshot times are RFC 3339, whose offsets can differ, so they're
+	// compared as times rather than strings. One that doesn't parse sorts
+	// first and is kept.
+	type point struct {
+		id int
+		t  time.Time
+	}
+	bySeries := make(map[series][]point)
+	for _, o := range snapshots {
+		k := series{o.EventID, o.OutcomeID}
+		t, _ := time.Parse(time.RFC3339, o.CreatedAt)
+		bySeries[k] = append(bySeries[k], point{o.ID, t})
+	}
+
+	var drop []int
+	for k, points := range bySeries {
+		sort.Slice(points, func(i, j int) bool {
+			if !points[i].t.Equal(points[j].t) {
+				return points[i].t.Before(points[j].t)
+			}
+			return points[i].id < points[j].id
+		})
+		// The latest snapshot seen in each bucket so far; the ones it
+		// replaces are dropped
+		latest := make(map[bucketKey]int)
+		for i, p := range points {
+			if i == 0 || i == len(points)-1 || p.t.IsZero() {
+				continue
+			}
+			start, ok := r.bucket(p.t, now)
+			if !ok {
+				continue
+			}
+			bk := bucketKey{k, start.Unix()}
+			if prev, ok := latest[bk]; ok {
+				drop = append(drop, prev)
+			}
+			latest[bk] = p.id
+		}
+	}
+	sort.Ints(drop)
+	return drop
+}
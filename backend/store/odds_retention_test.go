@@ -0,0 +1,83 @@
+package store
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"pauls-bach/models"
+)
+
+func TestCompactOdds(t *testing.T) {
+	now := time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+	r := OddsRetention{MinuteAfter: time.Hour, HourAfter: 24 * time.Hour}
+	hour := now.Add(-30 * time.Hour).Truncate(time.Hour)
+	minute := now.Add(-3 * time.Hour).Truncate(time.Minute)
+	at := func(id, outcomeID int, t time.Time) models.OddsSnapshot {
+		return models.OddsSnapshot{ID: id, EventID: 1, OutcomeID: outcomeID, CreatedAt: t.Format(time.RFC3339)}
+	}
+	est := time.FixedZone("EST", -5*60*60)
+
+	tests := []struct {
+		name      string
+		snapshots []models.OddsSnapshot
+		want      []int
+	}{
+		{"hour buckets", []models.OddsSnapshot{
+			at(1, 1, now.Add(-48*time.Hour)),
+			at(2, 1, hour.Add(5*time.Minute)),
+			at(3, 1, hour.Add(20*time.Minute)),
+			at(4, 1, hour.Add(50*time.Minute)),
+			at(5, 1, hour.Add(70*time.Minute)),
+			at(6, 1, now),
+		}, []int{2, 3}},
+		{"minute buckets", []models.OddsSnapshot{
+			at(1, 1, now.Add(-48*time.Hour)),
+			at(2, 1, minute.Add(10*time.Second)),
+			at(3, 1, minute.Add(40*time.Second)),
+			at(4, 1, minute.Add(70*time.Second)),
+			at(5, 1, now),
+		}, []int{2}},
+		{"recent kept", []models.OddsSnapshot{
+			at(1, 1, now.Add(-48*time.Hour)),
+			at(2, 1, now.Add(-10*time.Minute)),
+			at(3, 1, now.Add(-10*time.Minute+5*time.Second)),
+			at(4, 1, now.Add(-10*time.Minute+10*time.Second)),
+			at(5, 1, now),
+		}, nil},
+		{"first and last kept", []models.OddsSnapshot{
+			at(1, 1, minute.Add(10*time.Second)),
+			at(2, 1, minute.Add(20*time.Second)),
+			at(3, 1, minute.Add(30*time.Second)),
+		}, nil},
+		{"outcomes apart", []models.OddsSnapshot{
+			at(1, 1, now.Add(-48*time.Hour)),
+			at(2, 1, minute.Add(10*time.Second)),
+			at(3, 2, now.Add(-48*time.Hour)),
+			at(4, 2, minute.Add(20*time.Second)),
+			at(5, 1, now),
+			at(6, 2, now),
+		}, nil},
+		// As strings, 04:00:40-05:00 sorts before 09:00:10Z
+		{"offsets", []models.OddsSnapshot{
+			at(1, 1, now.Add(-48*time.Hour)),
+			at(2, 1, minute.Add(40*time.Second).In(est)),
+			at(3, 1, minute.Add(10*time.Second)),
+			at(4, 1, now),
+		}, []int{3}},
+		{"unparseable kept", []models.OddsSnapshot{
+			at(1, 1, now.Add(-48*time.Hour)),
+			{ID: 2, EventID: 1, OutcomeID: 1, CreatedAt: "yesterday"},
+			at(3, 1, minute.Add(10*time.Second)),
+			at(4, 1, minute.Add(20*time.Second)),
+			at(5, 1, now),
+		}, []int{3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := compactOdds(tt.snapshots, r, now); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("dropped %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -6,38 +6,58 @@ import (
 	"time"
 )
 
-type OddsSnapshotStore struct {
-	filePath string
+type csvOddsSnapshotStore struct {
+	file csvFile
 }
 
-var oddsSnapshotHeader = []string{"id", "event_id", "outcome_id", "odds", "created_at"}
+var oddsSnapshotHeader = []string{"id", "event_id", "outcome_id", "odds", "created_at", "expected_value"}
 
-func (s *OddsSnapshotStore) toRow(o *models.OddsSnapshot) []string {
+func (s *csvOddsSnapshotStore) toRow(o *models.OddsSnapshot) []string {
+	expectedValue := ""
+	if o.ExpectedValue != nil {
+		expectedValue = strconv.FormatFloat(*o.ExpectedValue, 'f', 2, 64)
+	}
 	return []string{
 		strconv.Itoa(o.ID),
 		strconv.Itoa(o.EventID),
 		strconv.Itoa(o.OutcomeID),
 		strconv.FormatFloat(o.Odds, 'f', 2, 64),
 		o.CreatedAt,
+		expectedValue,
 	}
 }
 
-func (s *OddsSnapshotStore) fromRow(row []string) *models.OddsSnapshot {
+func (s *csvOddsSnapshotStore) fromRow(row []string) *models.OddsSnapshot {
 	id, _ := strconv.Atoi(row[0])
 	eventID, _ := strconv.Atoi(row[1])
 	outcomeID, _ := strconv.Atoi(row[2])
 	odds, _ := strconv.ParseFloat(row[3], 64)
-	return &models.OddsSnapshot{
+	o := &models.OddsSnapshot{
 		ID:        id,
 		EventID:   eventID,
 		OutcomeID: outcomeID,
 		Odds:      odds,
 		CreatedAt: row[4],
 	}
+	if row[5] != "" {
+		if v, err := strconv.ParseFloat(row[5], 64); err == nil {
+			o.ExpectedValue = &v
+		}
+	}
+	return o
+}
+
+// canonical returns v as it reads back from the file, which rounds floats.
+func (s *csvOddsSnapshotStore) canonical(v models.OddsSnapshot) models.OddsSnapshot {
+	return *s.fromRow(s.toRow(&v))
 }
 
-func (s *OddsSnapshotStore) DeleteByEventID(eventID int) error {
-	rows, err := readAllRows(s.filePath)
+func (s *csvOddsSnapshotStore) GetAll() ([]models.OddsSnapshot, error) {
+	return readAllAs(s.file, s.fromRow)
+}
+
+func (s *csvOddsSnapshotStore) DeleteByEventID(eventID int) error {
+	rows, err := s.file.readAll()
 	if err != nil {
 		return err
 	}
@@ -48,20 +68,38 @@ func (s *OddsSnapshotStore) DeleteByEventID(eventID int) error {
 			kept = append(kept, row)
 		}
 	}
-	return writeAllRows(s.filePath, oddsSnapshotHeader, kept)
+	return s.file.writeAll(oddsSnapshotHeader, kept)
+}
+
+func (s *csvOddsSnapshotStore) DeleteByIDs(ids []int) error {
+	drop := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		drop[strconv.Itoa(id)] = true
+	}
+	rows, err := s.file.readAll()
+	if err != nil {
+		return err
+	}
+	var kept [][]string
+	for _, row := range rows {
+		if !drop[row[0]] {
+			kept = append(kept, row)
+		}
+	}
+	return s.file.writeAll(oddsSnapshotHeader, kept)
 }
 
-func (s *OddsSnapshotStore) Create(o *models.OddsSnapshot) error {
-	id, _ := nextID(s.filePath)
+func (s *csvOddsSnapshotStore) Create(o *models.OddsSnapshot) error {
+	id, _ := s.file.nextID()
 	o.ID = id
 	if o.CreatedAt == "" {
 		o.CreatedAt = time.Now().Format(time.RFC3339)
 	}
-	return appendRow(s.filePath, s.toRow(o))
+	return s.file.append(s.toRow(o))
 }
 
-func (s *OddsSnapshotStore) LastSnapshotTimeByEvent() (map[int]string, error) {
-	rows, err := readAllRows(s.filePath)
+func (s *csvOddsSnapshotStore) LastSnapshotTimeByEvent() (map[int]string, error) {
+	rows, err := s.file.readAll()
 	if err != nil {
 		return nil, err
 	}
@@ -75,8 +113,8 @@ func (s *OddsSnapshotStore) LastSnapshotTimeByEvent() (map[int]string, error) {
 	return result, nil
 }
 
-func (s *OddsSnapshotStore) GetByEventID(eventID int) ([]*models.OddsSnapshot, error) {
-	rows, err := readAllRows(s.filePath)
+func (s *csvOddsSnapshotStore) GetByEventID(eventID int) ([]*models.OddsSnapshot, error) {
+	rows, err := s.file.readAll()
 	if err != nil {
 		return nil, err
 	}
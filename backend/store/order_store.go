@@ -0,0 +1,186 @@
+package store
+
+import (
+	"fmt"
+	"pauls-bach/models"
+	"strconv"
+	"time"
+)
+
+type csvOrderStore struct {
+	file csvFile
+}
+
+var orderHeader = []string{"id", "user_id", "event_id", "outcome_id", "side", "limit_price", "amount", "shares", "status", "filled_shares", "filled_points", "expires_at", "created_at", "closed_at"}
+
+func (s *csvOrderStore) toRow(o *models.Order) []string {
+	return []string{
+		strconv.Itoa(o.ID),
+		strconv.Itoa(o.UserID),
+		strconv.Itoa(o.EventID),
+		strconv.Itoa(o.OutcomeID),
+		o.Side,
+		strconv.FormatFloat(o.LimitPrice, 'f', 2, 64),
+		strconv.Itoa(o.Amount),
+		strconv.FormatFloat(o.Shares, 'f', 6, 64),
+		o.Status,
+		strconv.FormatFloat(o.FilledShares, 'f', 6, 64),
+		strconv.Itoa(o.FilledPoints),
+		o.ExpiresAt,
+		o.CreatedAt,
+		o.ClosedAt,
+	}
+}
+
+func (s *csvOrderStore) fromRow(row []string) *models.Order {
+	id, _ := strconv.Atoi(row[0])
+	userID, _ := strconv.Atoi(row[1])
+	eventID, _ := strconv.Atoi(row[2])
+	outcomeID, _ := strconv.Atoi(row[3])
+	limitPrice, _ := strconv.ParseFloat(row[5], 64)
+	amount, _ := strconv.Atoi(row[6])
+	shares, _ := strconv.ParseFloat(row[7], 64)
+	filledShares, _ := strconv.ParseFloat(row[9], 64)
+	filledPoints, _ := strconv.Atoi(row[10])
+	return &models.Order{
+		ID:           id,
+		UserID:       userID,
+		EventID:      eventID,
+		OutcomeID:    outcomeID,
+		Side:         row[4],
+		LimitPrice:   limitPrice,
+		Amount:       amount,
+		Shares:       shares,
+		Status:       row[8],
+		FilledShares: filledShares,
+		FilledPoints: filledPoints,
+		ExpiresAt:    row[11],
+		CreatedAt:    row[12],
+		ClosedAt:     row[13],
+	}
+}
+
+// canonical returns v as it reads back from the file, which rounds floats.
+func (s *csvOrderStore) canonical(v models.Order) models.Order {
+	return *s.fromRow(s.toRow(&v))
+}
+
+func (s *csvOrderStore) GetAll() ([]models.Order, error) {
+	return readAllAs(s.file, s.fromRow)
+}
+
+func (s *csvOrderStore) GetByID(id int) (*models.Order, error) {
+	rows, err := s.file.readAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		rowID, _ := strconv.Atoi(row[0])
+		if rowID == id {
+			return s.fromRow(row), nil
+		}
+	}
+	return nil, fmt.Errorf("order not found")
+}
+
+func (s *csvOrderStore) GetByUserID(userID int) ([]models.Order, error) {
+	rows, err := s.file.readAll()
+	if err != nil {
+		return nil, err
+	}
+	var orders []models.Order
+	for _, row := range rows {
+		uid, _ := strconv.Atoi(row[1])
+		if uid == userID {
+			orders = append(orders, *s.fromRow(row))
+		}
+	}
+	return orders, nil
+}
+
+// GetOpen returns every open order, oldest first.
+func (s *csvOrderStore) GetOpen() ([]models.Order, error) {
+	rows, err := s.file.readAll()
+	if err != nil {
+		return nil, err
+	}
+	var orders []models.Order
+	for _, row := range rows {
+		if row[8] == "open" {
+			orders = append(orders, *s.fromRow(row))
+		}
+	}
+	return orders, nil
+}
+
+// GetOpenByEventID returns the open orders for an event, oldest first.
+func (s *csvOrderStore) GetOpenByEventID(eventID int) ([]models.Order, error) {
+	rows, err := s.file.readAll()
+	if err != nil {
+		return nil, err
+	}
+	var orders []models.Order
+	for _, row := range rows {
+		eid, _ := strconv.Atoi(row[2])
+		if eid == eventID && row[8] == "open" {
+			orders = append(orders, *s.fromRow(row))
+		}
+	}
+	return orders, nil
+}
+
+// GetOpenByUserID returns the user's open orders, oldest first.
+func (s *csvOrderStore) GetOpenByUserID(userID int) ([]models.Order, error) {
+	rows, err := s.file.readAll()
+	if err != nil {
+		return nil, err
+	}
+	var orders []models.Order
+	for _, row := range rows {
+		uid, _ := strconv.Atoi(row[1])
+		if uid == userID && row[8] == "open" {
+			orders = append(orders, *s.fromRow(row))
+		}
+	}
+	return orders, nil
+}
+
+func (s *csvOrderStore) Create(o *models.Order) error {
+	id, err := s.file.nextID()
+	if err != nil {
+		return err
+	}
+	o.ID = id
+	o.CreatedAt = time.Now().Format(time.RFC3339)
+	return s.file.append(s.toRow(o))
+}
+
+func (s *csvOrderStore) Update(o *models.Order) error {
+	rows, err := s.file.readAll()
+	if err != nil {
+		return err
+	}
+	for i, row := range rows {
+		rowID, _ := strconv.Atoi(row[0])
+		if rowID == o.ID {
+			rows[i] = s.toRow(o)
+			return s.file.writeAll(orderHeader, rows)
+		}
+	}
+	return fmt.Errorf("order not found")
+}
+
+func (s *csvOrderStore) DeleteByEventID(eventID int) error {
+	rows, err := s.file.readAll()
+	if err != nil {
+		return err
+	}
+	var kept [][]string
+	for _, row := range rows {
+		eid, _ := strconv.Atoi(row[2])
+		if eid != eventID {
+			kept = append(kept, row)
+		}
+	}
+	return s.file.writeAll(orderHeader, kept)
+}
@@ -6,11 +6,11 @@ import (
 	"strconv"
 )
 
-type OutcomeStore struct {
-	filePath string
+type csvOutcomeStore struct {
+	file csvFile
 }
 
-func (s *OutcomeStore) toRow(o *models.Outcome) []string {
+func (s *csvOutcomeStore) toRow(o *models.Outcome) []string {
 	return []string{
 		strconv.Itoa(o.ID),
 		strconv.Itoa(o.EventID),
@@ -18,7 +18,7 @@ func (s *OutcomeStore) toRow(o *models.Outcome) []string {
 	}
 }
 
-func (s *OutcomeStore) fromRow(row []string) *models.Outcome {
+func (s *csvOutcomeStore) fromRow(row []string) *models.Outcome {
 	id, _ := strconv.Atoi(row[0])
 	eventID, _ := strconv.Atoi(row[1])
 	return &models.Outcome{
@@ -28,8 +28,12 @@ func (s *OutcomeStore) fromRow(row []string) *models.Outcome {
 	}
 }
 
-func (s *OutcomeStore) GetByEventID(eventID int) ([]models.Outcome, error) {
-	rows, err := readAllRows(s.filePath)
+func (s *csvOutcomeStore) GetAll() ([]models.Outcome, error) {
+	return readAllAs(s.file, s.fromRow)
+}
+
+func (s *csvOutcomeStore) GetByEventID(eventID int) ([]models.Outcome, error) {
+	rows, err := s.file.readAll()
 	if err != nil {
 		return nil, err
 	}
@@ -43,19 +47,19 @@ func (s *OutcomeStore) GetByEventID(eventID int) ([]models.Outcome, error) {
 	return outcomes, nil
 }
 
-func (s *OutcomeStore) Create(o *models.Outcome) error {
-	id, err := nextID(s.filePath)
+func (s *csvOutcomeStore) Create(o *models.Outcome) error {
+	id, err := s.file.nextID()
 	if err != nil {
 		return err
 	}
 	o.ID = id
-	return appendRow(s.filePath, s.toRow(o))
+	return s.file.append(s.toRow(o))
 }
 
 var outcomeHeader = []string{"id", "event_id", "label"}
 
-func (s *OutcomeStore) Update(o *models.Outcome) error {
-	rows, err := readAllRows(s.filePath)
+func (s *csvOutcomeStore) Update(o *models.Outcome) error {
+	rows, err := s.file.readAll()
 	if err != nil {
 		return err
 	}
@@ -63,14 +67,14 @@ func (s *OutcomeStore) Update(o *models.Outcome) error {
 		rowID, _ := strconv.Atoi(row[0])
 		if rowID == o.ID {
 			rows[i] = s.toRow(o)
-			return writeAllRows(s.filePath, outcomeHeader, rows)
+			return s.file.writeAll(outcomeHeader, rows)
 		}
 	}
 	return fmt.Errorf("outcome not found")
 }
 
-func (s *OutcomeStore) DeleteByEventID(eventID int) error {
-	rows, err := readAllRows(s.filePath)
+func (s *csvOutcomeStore) DeleteByEventID(eventID int) error {
+	rows, err := s.file.readAll()
 	if err != nil {
 		return err
 	}
@@ -81,11 +85,11 @@ func (s *OutcomeStore) DeleteByEventID(eventID int) error {
 			kept = append(kept, row)
 		}
 	}
-	return writeAllRows(s.filePath, outcomeHeader, kept)
+	return s.file.writeAll(outcomeHeader, kept)
 }
 
-func (s *OutcomeStore) GetByID(id int) (*models.Outcome, error) {
-	rows, err := readAllRows(s.filePath)
+func (s *csvOutcomeStore) GetByID(id int) (*models.Outcome, error) {
+	rows, err := s.file.readAll()
 	if err != nil {
 		return nil, err
 	}
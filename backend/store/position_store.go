@@ -7,13 +7,13 @@ import (
 	"time"
 )
 
-type PositionStore struct {
-	filePath string
+type csvPositionStore struct {
+	file csvFile
 }
 
 var positionHeader = []string{"id", "user_id", "event_id", "outcome_id", "shares", "avg_price", "created_at"}
 
-func (s *PositionStore) toRow(p *models.Position) []string {
+func (s *csvPositionStore) toRow(p *models.Position) []string {
 	return []string{
 		strconv.Itoa(p.ID),
 		strconv.Itoa(p.UserID),
@@ -25,7 +25,7 @@ func (s *PositionStore) toRow(p *models.Position) []string {
 	}
 }
 
-func (s *PositionStore) fromRow(row []string) *models.Position {
+func (s *csvPositionStore) fromRow(row []string) *models.Position {
 	id, _ := strconv.Atoi(row[0])
 	userID, _ := strconv.Atoi(row[1])
 	eventID, _ := strconv.Atoi(row[2])
@@ -43,8 +43,17 @@ func (s *PositionStore) fromRow(row []string) *models.Position {
 	}
 }
 
-func (s *PositionStore) GetByUserID(userID int) ([]models.Position, error) {
-	rows, err := readAllRows(s.filePath)
+// canonical returns v as it reads back from the file, which rounds floats.
+func (s *csvPositionStore) canonical(v models.Position) models.Position {
+	return *s.fromRow(s.toRow(&v))
+}
+
+func (s *csvPositionStore) GetAll() ([]models.Position, error) {
+	return readAllAs(s.file, s.fromRow)
+}
+
+func (s *csvPositionStore) GetByUserID(userID int) ([]models.Position, error) {
+	rows, err := s.file.readAll()
 	if err != nil {
 		return nil, err
 	}
@@ -58,8 +67,8 @@ func (s *PositionStore) GetByUserID(userID int) ([]models.Position, error) {
 	return positions, nil
 }
 
-func (s *PositionStore) GetByEventID(eventID int) ([]models.Position, error) {
-	rows, err := readAllRows(s.filePath)
+func (s *csvPositionStore) GetByEventID(eventID int) ([]models.Position, error) {
+	rows, err := s.file.readAll()
 	if err != nil {
 		return nil, err
 	}
@@ -73,8 +82,8 @@ func (s *PositionStore) GetByEventID(eventID int) ([]models.Position, error) {
 	return positions, nil
 }
 
-func (s *PositionStore) GetByUserAndEvent(userID, eventID int) ([]models.Position, error) {
-	rows, err := readAllRows(s.filePath)
+func (s *csvPositionStore) GetByUserAndEvent(userID, eventID int) ([]models.Position, error) {
+	rows, err := s.file.readAll()
 	if err != nil {
 		return nil, err
 	}
@@ -89,8 +98,8 @@ func (s *PositionStore) GetByUserAndEvent(userID, eventID int) ([]models.Positio
 	return positions, nil
 }
 
-func (s *PositionStore) GetByUserEventOutcome(userID, eventID, outcomeID int) (*models.Position, error) {
-	rows, err := readAllRows(s.filePath)
+func (s *csvPositionStore) GetByUserEventOutcome(userID, eventID, outcomeID int) (*models.Position, error) {
+	rows, err := s.file.readAll()
 	if err != nil {
 		return nil, err
 	}
@@ -105,18 +114,20 @@ func (s *PositionStore) GetByUserEventOutcome(userID, eventID, outcomeID int) (*
 	return nil, nil
 }
 
-func (s *PositionStore) Create(p *models.Position) error {
-	id, err := nextID(s.filePath)
+func (s *csvPositionStore) Create(p *models.Position) error {
+	id, err := s.file.nextID()
 	if err != nil {
 		return err
 	}
 	p.ID = id
-	p.CreatedAt = time.Now().Format(time.RFC3339)
-	return appendRow(s.filePath, s.toRow(p))
+	if p.CreatedAt == "" {
+		p.CreatedAt = time.Now().Format(time.RFC3339)
+	}
+	return s.file.append(s.toRow(p))
 }
 
-func (s *PositionStore) Update(p *models.Position) error {
-	rows, err := readAllRows(s.filePath)
+func (s *csvPositionStore) Update(p *models.Position) error {
+	rows, err := s.file.readAll()
 	if err != nil {
 		return err
 	}
@@ -124,14 +135,14 @@ func (s *PositionStore) Update(p *models.Position) error {
 		rowID, _ := strconv.Atoi(row[0])
 		if rowID == p.ID {
 			rows[i] = s.toRow(p)
-			return writeAllRows(s.filePath, positionHeader, rows)
+			return s.file.writeAll(positionHeader, rows)
 		}
 	}
 	return fmt.Errorf("position not found")
 }
 
-func (s *PositionStore) Delete(id int) error {
-	rows, err := readAllRows(s.filePath)
+func (s *csvPositionStore) Delete(id int) error {
+	rows, err := s.file.readAll()
 	if err != nil {
 		return err
 	}
@@ -142,11 +153,11 @@ func (s *PositionStore) Delete(id int) error {
 			newRows = append(newRows, row)
 		}
 	}
-	return writeAllRows(s.filePath, positionHeader, newRows)
+	return s.file.writeAll(positionHeader, newRows)
 }
 
-func (s *PositionStore) DeleteByEventID(eventID int) error {
-	rows, err := readAllRows(s.filePath)
+func (s *csvPositionStore) DeleteByEventID(eventID int) error {
+	rows, err := s.file.readAll()
 	if err != nil {
 		return err
 	}
@@ -157,5 +168,5 @@ func (s *PositionStore) DeleteByEventID(eventID int) error {
 			newRows = append(newRows, row)
 		}
 	}
-	return writeAllRows(s.filePath, positionHeader, newRows)
+	return s.file.writeAll(positionHeader, newRows)
 }
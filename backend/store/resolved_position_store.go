@@ -0,0 +1,56 @@
+package store
+
+import (
+	"pauls-bach/models"
+	"strconv"
+)
+
+// csvResolvedPositionStore keeps the positions an event held when it was
+// resolved, so unresolving can put them back. Rows use the positions.csv
+// layout and keep their original IDs and timestamps.
+type csvResolvedPositionStore struct {
+	file csvFile
+	rows csvPositionStore
+}
+
+func (s *csvResolvedPositionStore) GetByEventID(eventID int) ([]models.Position, error) {
+	rows, err := s.file.readAll()
+	if err != nil {
+		return nil, err
+	}
+	var positions []models.Position
+	for _, row := range rows {
+		eid, _ := strconv.Atoi(row[2])
+		if eid == eventID {
+			positions = append(positions, *s.rows.fromRow(row))
+		}
+	}
+	return positions, nil
+}
+
+func (s *csvResolvedPositionStore) GetAll() ([]models.Position, error) {
+	return readAllAs(s.file, s.rows.fromRow)
+}
+
+func (s *csvResolvedPositionStore) canonical(p models.Position) models.Position {
+	return s.rows.canonical(p)
+}
+
+func (s *csvResolvedPositionStore) Create(p *models.Position) error {
+	return s.file.append(s.rows.toRow(p))
+}
+
+func (s *csvResolvedPositionStore) DeleteByEventID(eventID int) error {
+	rows, err := s.file.readAll()
+	if err != nil {
+		return err
+	}
+	var kept [][]string
+	for _, row := range rows {
+		eid, _ := strconv.Atoi(row[2])
+		if eid != eventID {
+			kept = append(kept, row)
+		}
+	}
+	return s.file.writeAll(positionHeader, kept)
+}
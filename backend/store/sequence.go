@@ -0,0 +1,75 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// sequence hands out the IDs of one CSV file. It reads the file to find the
+// highest ID in use the first time it's needed and counts in memory from
+// then on, so creating a record doesn't mean reading the whole file. IDs
+// are never handed out twice while the store is open, even if the records
+// that had them are deleted.
+//
+// A transaction takes IDs from its own count, which it copies back only if
+// it commits; see csvTx.nextID.
+type sequence struct {
+	last   int
+	seeded bool
+	seed   func() (int, error) // returns the highest ID in use
+}
+
+// current returns the last ID handed out.
+func (q *sequence) current() (int, error) {
+	if !q.seeded {
+		last, err := q.seed()
+		if err != nil {
+			return 0, err
+		}
+		q.last, q.seeded = last, true
+	}
+	return q.last, nil
+}
+
+// newSequences returns a sequence for each of the CSV files in dataDir,
+// by file name.
+func newSequences(dataDir string) map[string]*sequence {
+	seqs := make(map[string]*sequence)
+	for file := range csvHeaders {
+		path := filepath.Join(dataDir, file)
+		seqs[file] = &sequence{seed: func() (int, error) { return maxColumn(path, 0) }}
+	}
+	// Ledger entries outlive a deleted event, so its ID mustn't be handed
+	// out again even if it was the last one in the file
+	events, ledger := filepath.Join(dataDir, "events.csv"), filepath.Join(dataDir, "transactions.csv")
+	seqs["events.csv"].seed = func() (int, error) {
+		last, err := maxColumn(events, 0)
+		if err != nil {
+			return 0, err
+		}
+		used, err := maxColumn(ledger, 2) // event_id
+		return max(last, used), err
+	}
+	return seqs
+}
+
+// maxColumn returns the highest integer in the given column of the file,
+// or 0 if it has no rows.
+func maxColumn(path string, col int) (int, error) {
+	rows, err := readAllRows(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	highest := 0
+	for _, row := range rows {
+		if col < len(row) {
+			if n, _ := strconv.Atoi(row[col]); n > highest {
+				highest = n
+			}
+		}
+	}
+	return highest, nil
+}
@@ -0,0 +1,151 @@
+package store
+
+import (
+	"errors"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"pauls-bach/models"
+)
+
+func createUser(t *testing.T, s *Store, name string) int {
+	t.Helper()
+	u := &models.User{Username: name}
+	if err := s.Users.Create(u); err != nil {
+		t.Fatal(err)
+	}
+	return u.ID
+}
+
+// A reopened store counts on from the highest ID in the files.
+func TestSequenceReloadsAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	s, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "b", "c"} {
+		createUser(t, s, name)
+	}
+	event := &models.Event{Title: "E", EventType: "binary", Status: "open"}
+	if err := s.Events.Create(event); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Post(&models.Transaction{UserID: 1, EventID: event.ID, TxType: "buy", Points: 0}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Events.Delete(event.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := createUser(t, s, "d"); id != 4 {
+		t.Errorf("user ID %d after a restart, want 4", id)
+	}
+	// The deleted event's ID is still in the ledger
+	again := &models.Event{Title: "F", EventType: "binary", Status: "open"}
+	if err := s.Events.Create(again); err != nil {
+		t.Fatal(err)
+	}
+	if again.ID != event.ID+1 {
+		t.Errorf("event ID %d after a restart, want %d", again.ID, event.ID+1)
+	}
+}
+
+// A rolled back transaction gives its IDs back; a committed one keeps them.
+func TestSequenceRollback(t *testing.T) {
+	s, err := New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	createUser(t, s, "a")
+
+	failed := errors.New("fail")
+	err = s.Transact(func(s *Store) error {
+		if id := createUser(t, s, "b"); id != 2 {
+			t.Errorf("user ID %d in the transaction, want 2", id)
+		}
+		if id := createUser(t, s, "c"); id != 3 {
+			t.Errorf("user ID %d in the transaction, want 3", id)
+		}
+		return failed
+	})
+	if err != failed {
+		t.Fatalf("Transact returned %v", err)
+	}
+	if id := createUser(t, s, "b"); id != 2 {
+		t.Errorf("user ID %d after the rollback, want 2", id)
+	}
+
+	err = s.Transact(func(s *Store) error {
+		createUser(t, s, "c")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := createUser(t, s, "d"); id != 4 {
+		t.Errorf("user ID %d after the commit, want 4", id)
+	}
+}
+
+// Appending without reading the file hands out the IDs reading it did: one
+// past the last row's.
+func TestSequenceMatchesLastRow(t *testing.T) {
+	dir := t.TempDir()
+	s, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A gap left by rows deleted before the sequence existed
+	now := "2024-01-01T00:00:00Z"
+	rows := [][]string{
+		{"1", "1", "1", "1", "buy", "1.000000", "1", now, ""},
+		{"5", "1", "1", "1", "buy", "1.000000", "1", now, ""},
+	}
+	if err := writeAllRows(filepath.Join(dir, "transactions.csv"), transactionHeader, rows); err != nil {
+		t.Fatal(err)
+	}
+	s, err = New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	create := func(s *Store) {
+		t.Helper()
+		if err := s.Transactions.Create(&models.Transaction{UserID: 1, TxType: "grant", Points: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	create(s)
+	err = s.Transact(func(s *Store) error {
+		create(s)
+		// Reading the file mid-transaction doesn't change the count
+		if _, err := s.Transactions.GetAll(); err != nil {
+			return err
+		}
+		create(s)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	create(s)
+
+	got, err := readAllRows(filepath.Join(dir, "transactions.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 2; i < len(got); i++ {
+		if want := strconv.Itoa(lastID(got[:i]) + 1); got[i][0] != want {
+			t.Errorf("row %d has ID %s, want %s", i, got[i][0], want)
+		}
+	}
+	if len(got) != 6 || got[5][0] != "9" {
+		t.Errorf("%d rows ending in ID %s, want 6 ending in 9", len(got), got[len(got)-1][0])
+	}
+}
@@ -0,0 +1,400 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// sqliteDriver is the database/sql driver NewSQLite opens, registered by
+// the driver imported in sqlite_driver.go.
+const sqliteDriver = "sqlite"
+
+// sqliteFile is the database NewSQLite keeps in the data directory.
+const sqliteFile = "pauls-bach.db"
+
+// sqliteSchemaVersion is stored in the database's user_version. Bump it,
+// and bring older databases up to date in NewSQLite, when sqliteSchema
+// changes.
+const sqliteSchemaVersion = 2
+
+var sqliteSchema = []string{
+	`CREATE TABLE IF NOT EXISTS users (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		username TEXT NOT NULL UNIQUE,
+		pin_hash TEXT NOT NULL,
+		balance INTEGER NOT NULL,
+		is_admin INTEGER NOT NULL,
+		bingo INTEGER NOT NULL,
+		created_at TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		title TEXT NOT NULL,
+		description TEXT NOT NULL,
+		event_type TEXT NOT NULL,
+		status TEXT NOT NULL,
+		resolution TEXT NOT NULL,
+		created_at TEXT NOT NULL,
+		resolved_at TEXT NOT NULL,
+		creator_id INTEGER NOT NULL,
+		bounty_paid INTEGER NOT NULL,
+		pricing_model TEXT NOT NULL,
+		liquidity REAL NOT NULL,
+		closes_at TEXT NOT NULL,
+		voided INTEGER NOT NULL,
+		scalar_min REAL NOT NULL,
+		scalar_max REAL NOT NULL,
+		resolved_value REAL,
+		allow_hedging INTEGER NOT NULL,
+		rules TEXT
+	)`,
+	`CREATE TABLE IF NOT EXISTS outcomes (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		event_id INTEGER NOT NULL,
+		label TEXT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS outcomes_event ON outcomes (event_id)`,
+	`CREATE TABLE IF NOT EXISTS positions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		event_id INTEGER NOT NULL,
+		outcome_id INTEGER NOT NULL,
+		shares REAL NOT NULL,
+		avg_price REAL NOT NULL,
+		created_at TEXT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS positions_user_event ON positions (user_id, event_id, outcome_id)`,
+	`CREATE INDEX IF NOT EXISTS positions_event ON positions (event_id)`,
+	// Rows keep the ID they had in positions, so id isn't a key here
+	`CREATE TABLE IF NOT EXISTS resolved_positions (
+		id INTEGER NOT NULL,
+		user_id INTEGER NOT NULL,
+		event_id INTEGER NOT NULL,
+		outcome_id INTEGER NOT NULL,
+		shares REAL NOT NULL,
+		avg_price REAL NOT NULL,
+		created_at TEXT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS resolved_positions_event ON resolved_positions (event_id)`,
+	`CREATE TABLE IF NOT EXISTS transactions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		event_id INTEGER NOT NULL,
+		outcome_id INTEGER NOT NULL,
+		tx_type TEXT NOT NULL,
+		shares REAL NOT NULL,
+		points INTEGER NOT NULL,
+		created_at TEXT NOT NULL,
+		reason TEXT NOT NULL DEFAULT ''
+	)`,
+	`CREATE INDEX IF NOT EXISTS transactions_user ON transactions (user_id)`,
+	`CREATE INDEX IF NOT EXISTS transactions_event ON transactions (event_id)`,
+	`CREATE TABLE IF NOT EXISTS odds_snapshots (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		event_id INTEGER NOT NULL,
+		outcome_id INTEGER NOT NULL,
+		odds REAL NOT NULL,
+		created_at TEXT NOT NULL,
+		expected_value REAL
+	)`,
+	`CREATE INDEX IF NOT EXISTS odds_snapshots_event ON odds_snapshots (event_id, created_at)`,
+	`CREATE TABLE IF NOT EXISTS bingo_events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		title TEXT NOT NULL,
+		rarity TEXT NOT NULL,
+		resolved INTEGER NOT NULL,
+		created_at TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS bingo_boards (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		squares TEXT NOT NULL,
+		created_at TEXT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS bingo_boards_user ON bingo_boards (user_id)`,
+	`CREATE TABLE IF NOT EXISTS bingo_winners (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		username TEXT NOT NULL,
+		board_id INTEGER NOT NULL,
+		line TEXT NOT NULL,
+		created_at TEXT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS bingo_winners_board ON bingo_winners (board_id)`,
+	`CREATE INDEX IF NOT EXISTS bingo_winners_user ON bingo_winners (user_id)`,
+	`CREATE TABLE IF NOT EXISTS activity (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		type TEXT NOT NULL,
+		message TEXT NOT NULL,
+		user_id INTEGER NOT NULL,
+		event_id INTEGER NOT NULL,
+		created_at TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS orders (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		event_id INTEGER NOT NULL,
+		outcome_id INTEGER NOT NULL,
+		side TEXT NOT NULL,
+		limit_price REAL NOT NULL,
+		amount INTEGER NOT NULL,
+		shares REAL NOT NULL,
+		status TEXT NOT NULL,
+		filled_shares REAL NOT NULL,
+		filled_points INTEGER NOT NULL,
+		expires_at TEXT NOT NULL,
+		created_at TEXT NOT NULL,
+		closed_at TEXT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS orders_event_status ON orders (event_id, status)`,
+	`CREATE INDEX IF NOT EXISTS orders_user_status ON orders (user_id, status)`,
+	`CREATE INDEX IF NOT EXISTS orders_status ON orders (status)`,
+}
+
+// NewSQLite opens (creating if needed) the SQLite database in dataDir. A new
+// database is seeded from any CSV files already in dataDir, so switching
+// backends keeps the data.
+func NewSQLite(dataDir string) (*Store, error) {
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(dataDir, sqliteFile)
+	_, statErr := os.Stat(path)
+	fresh := os.IsNotExist(statErr)
+
+	db, err := sql.Open(sqliteDriver, path)
+	if err != nil {
+		return nil, err
+	}
+	// Writers are serialized by the store lock anyway, and a single
+	// connection keeps SQLite from returning SQLITE_BUSY
+	db.SetMaxOpenConns(1)
+	for _, pragma := range []string{"PRAGMA journal_mode = WAL", "PRAGMA synchronous = NORMAL", "PRAGMA busy_timeout = 5000"} {
+		if _, err := db.Exec(pragma); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("%s: %w", pragma, err)
+		}
+	}
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if version > sqliteSchemaVersion {
+		db.Close()
+		return nil, fmt.Errorf("%s has schema version %d but this build only knows up to %d; run a newer build", path, version, sqliteSchemaVersion)
+	}
+	for _, stmt := range sqliteSchema {
+		if _, err := db.Exec(stmt); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("create schema: %w", err)
+		}
+	}
+	if !fresh && version < 2 {
+		if err := migrateSQLiteLedger(db); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("migrate to schema version 2: %w", err)
+		}
+	}
+	// PRAGMA doesn't take bound parameters
+	if _, err := db.Exec(fmt.Sprintf("PRAGMA user_version = %d", sqliteSchemaVersion)); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	if fresh {
+		// The import reads the CSV files with the current layout
+		err := checkSchemaVersion(dataDir)
+		if err == nil {
+			err = migrate(dataDir)
+		}
+		if err == nil {
+			err = importCSV(db, dataDir)
+		}
+		if err != nil {
+			db.Close()
+			os.Remove(path)
+			return nil, fmt.Errorf("import csv data: %w", err)
+		}
+	}
+	s := newSQLiteStore(db)
+	s.checkpoint = func() error {
+		// Move everything out of the write-ahead log into the database file
+		_, err := db.Exec("PRAGMA wal_checkpoint(TRUNCATE)")
+		return err
+	}
+	s.close = db.Close
+	s.begin = func() (*txn, error) {
+		tx, err := db.Begin()
+		if err != nil {
+			return nil, err
+		}
+		return &txn{
+			store:    newSQLiteStore(tx),
+			commit:   tx.Commit,
+			rollback: func() { tx.Rollback() },
+		}, nil
+	}
+	return s, nil
+}
+
+// newSQLiteReadOnly opens the SQLite store in dataDir for OpenReadOnly. A
+// write-ahead log with anything in it holds writes that haven't reached the
+// database file, which only a writer can move across, so it fails then.
+func newSQLiteReadOnly(dataDir string) (*Store, error) {
+	path := filepath.Join(dataDir, sqliteFile)
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(path + "-wal"); err == nil && info.Size() > 0 {
+		return nil, fmt.Errorf("%s has writes left in its write-ahead log; start the server once to checkpoint them", path)
+	}
+
+	// immutable keeps SQLite from creating the WAL's shared-memory file;
+	// the caller holds the data directory lock, so nothing else writes
+	db, err := sql.Open(sqliteDriver, "file:"+path+"?mode=ro&immutable=1")
+	if err != nil {
+		return nil, err
+	}
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if version > sqliteSchemaVersion {
+		db.Close()
+		return nil, fmt.Errorf("%s has schema version %d but this build only knows up to %d; run a newer build", path, version, sqliteSchemaVersion)
+	}
+	if version < sqliteSchemaVersion {
+		db.Close()
+		return nil, fmt.Errorf("%s has schema version %d and needs migrating to %d; start the server once to migrate it", path, version, sqliteSchemaVersion)
+	}
+
+	s := newSQLiteStore(db)
+	s.close = db.Close
+	s.begin = func() (*txn, error) { return nil, ErrReadOnly }
+	return s, nil
+}
+
+// migrateSQLiteLedger is the SQLite side of migrateLedger.
+func migrateSQLiteLedger(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range []string{
+		`ALTER TABLE transactions ADD COLUMN reason TEXT NOT NULL DEFAULT ''`,
+		`UPDATE transactions SET tx_type = 'admin_adjust' WHERE tx_type = 'adjustment'`,
+		`UPDATE transactions SET tx_type = 'bounty' WHERE tx_type = 'bonus' AND outcome_id = 0`,
+	} {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+
+	users, err := (&sqliteUserStore{db: tx}).GetAll()
+	if err != nil {
+		return err
+	}
+	transactions := &sqliteTransactionStore{db: tx}
+	txs, err := transactions.GetAll()
+	if err != nil {
+		return err
+	}
+	for _, t := range ledgerOpeningEntries(users, txs, nowRFC3339()) {
+		if err := transactions.insert(&t); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func newSQLiteStore(db sqlDB) *Store {
+	return &Store{
+		Users:             &sqliteUserStore{db: db},
+		Events:            &sqliteEventStore{db: db},
+		Outcomes:          &sqliteOutcomeStore{db: db},
+		Positions:         &sqlitePositionStore{db: db, table: "positions"},
+		Transactions:      &sqliteTransactionStore{db: db},
+		OddsSnapshots:     &sqliteOddsSnapshotStore{db: db},
+		BingoEvents:       &sqliteBingoEventStore{db: db},
+		BingoBoards:       &sqliteBingoBoardStore{db: db},
+		BingoWinners:      &sqliteBingoWinnerStore{db: db},
+		Activity:          &sqliteActivityStore{db: db},
+		Orders:            &sqliteOrderStore{db: db},
+		ResolvedPositions: &sqliteResolvedPositionStore{rows: sqlitePositionStore{db: db, table: "resolved_positions"}},
+	}
+}
+
+// sqlDB is satisfied by *sql.DB and *sql.Tx, so the stores can also run
+// inside a transaction.
+type sqlDB interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// sqlScanner is satisfied by *sql.Row and *sql.Rows.
+type sqlScanner interface {
+	Scan(dest ...any) error
+}
+
+// queryAll runs query and scans every row with scan.
+func queryAll[T any](db sqlDB, scan func(sqlScanner) (*T, error), query string, args ...any) ([]T, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []T
+	for rows.Next() {
+		v, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, *v)
+	}
+	return result, rows.Err()
+}
+
+// insertRow runs an INSERT and returns the ID SQLite assigned.
+func insertRow(db sqlDB, query string, args ...any) (int, error) {
+	res, err := db.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+// updateRow runs an UPDATE of a single row and returns notFound if no row
+// matched.
+func updateRow(db sqlDB, notFound string, query string, args ...any) error {
+	res, err := db.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("%s", notFound)
+	}
+	return nil
+}
+
+// nullID lets SQLite assign the ID of a record created without one.
+func nullID(id int) any {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
+
+func nowRFC3339() string {
+	return time.Now().Format(time.RFC3339)
+}
@@ -0,0 +1,40 @@
+package store
+
+import "pauls-bach/models"
+
+type sqliteActivityStore struct {
+	db sqlDB
+}
+
+const activityColumns = "id, type, message, user_id, event_id, created_at"
+
+func scanActivity(r sqlScanner) (*models.ActivityEntry, error) {
+	var e models.ActivityEntry
+	if err := r.Scan(&e.ID, &e.Type, &e.Message, &e.UserID, &e.EventID, &e.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func (s *sqliteActivityStore) Create(e *models.ActivityEntry) error {
+	e.CreatedAt = nowRFC3339()
+	return s.insert(e)
+}
+
+func (s *sqliteActivityStore) insert(e *models.ActivityEntry) error {
+	id, err := insertRow(s.db, "INSERT INTO activity ("+activityColumns+") VALUES (?, ?, ?, ?, ?, ?)",
+		nullID(e.ID), e.Type, e.Message, e.UserID, e.EventID, e.CreatedAt)
+	if err != nil {
+		return err
+	}
+	e.ID = id
+	return nil
+}
+
+func (s *sqliteActivityStore) GetRecent(limit int) ([]models.ActivityEntry, error) {
+	return queryAll(s.db, scanActivity, "SELECT "+activityColumns+" FROM activity ORDER BY id DESC LIMIT ?", limit)
+}
+
+func (s *sqliteActivityStore) all() ([]models.ActivityEntry, error) {
+	return queryAll(s.db, scanActivity, "SELECT "+activityColumns+" FROM activity ORDER BY id")
+}
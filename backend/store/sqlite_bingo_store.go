@@ -0,0 +1,187 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"pauls-bach/models"
+)
+
+type sqliteBingoEventStore struct {
+	db sqlDB
+}
+
+const bingoEventColumns = "id, title, rarity, resolved, created_at"
+
+func scanBingoEvent(r sqlScanner) (*models.BingoEvent, error) {
+	var e models.BingoEvent
+	if err := r.Scan(&e.ID, &e.Title, &e.Rarity, &e.Resolved, &e.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func (s *sqliteBingoEventStore) GetAll() ([]models.BingoEvent, error) {
+	events, err := queryAll(s.db, scanBingoEvent, "SELECT "+bingoEventColumns+" FROM bingo_events ORDER BY id")
+	if events == nil && err == nil {
+		events = []models.BingoEvent{}
+	}
+	return events, err
+}
+
+func (s *sqliteBingoEventStore) GetByID(id int) (*models.BingoEvent, error) {
+	e, err := scanBingoEvent(s.db.QueryRow("SELECT "+bingoEventColumns+" FROM bingo_events WHERE id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("bingo event not found")
+	}
+	return e, err
+}
+
+func (s *sqliteBingoEventStore) Create(e *models.BingoEvent) error {
+	e.CreatedAt = nowRFC3339()
+	return s.insert(e)
+}
+
+func (s *sqliteBingoEventStore) insert(e *models.BingoEvent) error {
+	id, err := insertRow(s.db, "INSERT INTO bingo_events ("+bingoEventColumns+") VALUES (?, ?, ?, ?, ?)",
+		nullID(e.ID), e.Title, e.Rarity, e.Resolved, e.CreatedAt)
+	if err != nil {
+		return err
+	}
+	e.ID = id
+	return nil
+}
+
+func (s *sqliteBingoEventStore) Update(e *models.BingoEvent) error {
+	return updateRow(s.db, "bingo event not found",
+		"UPDATE bingo_events SET title = ?, rarity = ?, resolved = ?, created_at = ? WHERE id = ?",
+		e.Title, e.Rarity, e.Resolved, e.CreatedAt, e.ID)
+}
+
+type sqliteBingoBoardStore struct {
+	db sqlDB
+}
+
+const bingoBoardColumns = "id, user_id, squares, created_at"
+
+func scanBingoBoard(r sqlScanner) (*models.BingoBoard, error) {
+	var b models.BingoBoard
+	var squares string
+	if err := r.Scan(&b.ID, &b.UserID, &squares, &b.CreatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(squares), &b.Squares); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+func (s *sqliteBingoBoardStore) GetAll() ([]models.BingoBoard, error) {
+	boards, err := queryAll(s.db, scanBingoBoard, "SELECT "+bingoBoardColumns+" FROM bingo_boards ORDER BY id")
+	if boards == nil && err == nil {
+		boards = []models.BingoBoard{}
+	}
+	return boards, err
+}
+
+func (s *sqliteBingoBoardStore) GetByID(id int) (*models.BingoBoard, error) {
+	b, err := scanBingoBoard(s.db.QueryRow("SELECT "+bingoBoardColumns+" FROM bingo_boards WHERE id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("bingo board not found")
+	}
+	return b, err
+}
+
+func (s *sqliteBingoBoardStore) GetByUserID(userID int) (*models.BingoBoard, error) {
+	b, err := scanBingoBoard(s.db.QueryRow("SELECT "+bingoBoardColumns+" FROM bingo_boards WHERE user_id = ? ORDER BY id LIMIT 1", userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil // no board yet
+	}
+	return b, err
+}
+
+func (s *sqliteBingoBoardStore) Create(b *models.BingoBoard) error {
+	b.CreatedAt = nowRFC3339()
+	return s.insert(b)
+}
+
+func (s *sqliteBingoBoardStore) insert(b *models.BingoBoard) error {
+	squares, err := json.Marshal(b.Squares)
+	if err != nil {
+		return err
+	}
+	id, err := insertRow(s.db, "INSERT INTO bingo_boards ("+bingoBoardColumns+") VALUES (?, ?, ?, ?)",
+		nullID(b.ID), b.UserID, string(squares), b.CreatedAt)
+	if err != nil {
+		return err
+	}
+	b.ID = id
+	return nil
+}
+
+func (s *sqliteBingoBoardStore) Update(b *models.BingoBoard) error {
+	squares, err := json.Marshal(b.Squares)
+	if err != nil {
+		return err
+	}
+	return updateRow(s.db, "bingo board not found",
+		"UPDATE bingo_boards SET user_id = ?, squares = ?, created_at = ? WHERE id = ?",
+		b.UserID, string(squares), b.CreatedAt, b.ID)
+}
+
+func (s *sqliteBingoBoardStore) DeleteByUserID(userID int) error {
+	_, err := s.db.Exec("DELETE FROM bingo_boards WHERE user_id = ?", userID)
+	return err
+}
+
+type sqliteBingoWinnerStore struct {
+	db sqlDB
+}
+
+const bingoWinnerColumns = "id, user_id, username, board_id, line, created_at"
+
+func scanBingoWinner(r sqlScanner) (*models.BingoWinner, error) {
+	var w models.BingoWinner
+	if err := r.Scan(&w.ID, &w.UserID, &w.Username, &w.BoardID, &w.Line, &w.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+func (s *sqliteBingoWinnerStore) GetAll() ([]models.BingoWinner, error) {
+	winners, err := queryAll(s.db, scanBingoWinner, "SELECT "+bingoWinnerColumns+" FROM bingo_winners ORDER BY id")
+	if winners == nil && err == nil {
+		winners = []models.BingoWinner{}
+	}
+	return winners, err
+}
+
+func (s *sqliteBingoWinnerStore) GetByBoardID(boardID int) ([]models.BingoWinner, error) {
+	return queryAll(s.db, scanBingoWinner, "SELECT "+bingoWinnerColumns+" FROM bingo_winners WHERE board_id = ? ORDER BY id", boardID)
+}
+
+func (s *sqliteBingoWinnerStore) DeleteByUserID(userID int) error {
+	_, err := s.db.Exec("DELETE FROM bingo_winners WHERE user_id = ?", userID)
+	return err
+}
+
+func (s *sqliteBingoWinnerStore) DeleteByBoardIDAndLine(boardID int, line string) error {
+	_, err := s.db.Exec("DELETE FROM bingo_winners WHERE board_id = ? AND line = ?", boardID, line)
+	return err
+}
+
+func (s *sqliteBingoWinnerStore) Create(w *models.BingoWinner) error {
+	w.CreatedAt = nowRFC3339()
+	return s.insert(w)
+}
+
+func (s *sqliteBingoWinnerStore) insert(w *models.BingoWinner) error {
+	id, err := insertRow(s.db, "INSERT INTO bingo_winners ("+bingoWinnerColumns+") VALUES (?, ?, ?, ?, ?, ?)",
+		nullID(w.ID), w.UserID, w.Username, w.BoardID, w.Line, w.CreatedAt)
+	if err != nil {
+		return err
+	}
+	w.ID = id
+	return nil
+}
@@ -0,0 +1,5 @@
+package store
+
+// modernc.org/sqlite is a cgo-free translation of SQLite, so the server
+// still builds into a static binary with CGO_ENABLED=0.
+import _ "modernc.org/sqlite"
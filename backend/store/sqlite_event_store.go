@@ -0,0 +1,118 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"pauls-bach/models"
+)
+
+type sqliteEventStore struct {
+	db sqlDB
+}
+
+const eventColumns = "id, title, description, event_type, status, resolution, created_at, resolved_at, creator_id, bounty_paid, " +
+	"pricing_model, liquidity, closes_at, voided, scalar_min, scalar_max, resolved_value, allow_hedging, rules"
+
+func scanEvent(r sqlScanner) (*models.Event, error) {
+	var e models.Event
+	var resolution string
+	var resolvedValue sql.NullFloat64
+	var rules sql.NullString
+	if err := r.Scan(&e.ID, &e.Title, &e.Description, &e.EventType, &e.Status, &resolution, &e.CreatedAt, &e.ResolvedAt,
+		&e.CreatorID, &e.BountyPaid, &e.PricingModel, &e.Liquidity, &e.ClosesAt, &e.Voided,
+		&e.ScalarMin, &e.ScalarMax, &resolvedValue, &e.AllowHedging, &rules); err != nil {
+		return nil, err
+	}
+	if resolution != "" {
+		if err := json.Unmarshal([]byte(resolution), &e.Resolution); err != nil {
+			return nil, err
+		}
+	}
+	if resolvedValue.Valid {
+		e.ResolvedValue = &resolvedValue.Float64
+	}
+	if rules.Valid && rules.String != "" {
+		e.Rules = &models.EventRules{}
+		if err := json.Unmarshal([]byte(rules.String), e.Rules); err != nil {
+			return nil, err
+		}
+	}
+	return &e, nil
+}
+
+// eventArgs returns the event's columns after id, in eventColumns order.
+func eventArgs(e *models.Event) ([]any, error) {
+	resolution := ""
+	if len(e.Resolution) > 0 {
+		b, err := json.Marshal(e.Resolution)
+		if err != nil {
+			return nil, err
+		}
+		resolution = string(b)
+	}
+	var rules any
+	if e.Rules != nil {
+		b, err := json.Marshal(e.Rules)
+		if err != nil {
+			return nil, err
+		}
+		rules = string(b)
+	}
+	return []any{e.Title, e.Description, e.EventType, e.Status, resolution, e.CreatedAt, e.ResolvedAt,
+		e.CreatorID, e.BountyPaid, e.PricingModel, e.Liquidity, e.ClosesAt, e.Voided,
+		e.ScalarMin, e.ScalarMax, e.ResolvedValue, e.AllowHedging, rules}, nil
+}
+
+func (s *sqliteEventStore) GetAll() ([]models.Event, error) {
+	events, err := queryAll(s.db, scanEvent, "SELECT "+eventColumns+" FROM events ORDER BY id")
+	if events == nil && err == nil {
+		events = []models.Event{}
+	}
+	return events, err
+}
+
+func (s *sqliteEventStore) GetByID(id int) (*models.Event, error) {
+	e, err := scanEvent(s.db.QueryRow("SELECT "+eventColumns+" FROM events WHERE id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("event not found")
+	}
+	return e, err
+}
+
+func (s *sqliteEventStore) Create(e *models.Event) error {
+	e.CreatedAt = nowRFC3339()
+	return s.insert(e)
+}
+
+func (s *sqliteEventStore) insert(e *models.Event) error {
+	args, err := eventArgs(e)
+	if err != nil {
+		return err
+	}
+	id, err := insertRow(s.db, "INSERT INTO events ("+eventColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		append([]any{nullID(e.ID)}, args...)...)
+	if err != nil {
+		return err
+	}
+	e.ID = id
+	return nil
+}
+
+func (s *sqliteEventStore) Update(e *models.Event) error {
+	args, err := eventArgs(e)
+	if err != nil {
+		return err
+	}
+	return updateRow(s.db, "event not found",
+		"UPDATE events SET title = ?, description = ?, event_type = ?, status = ?, resolution = ?, created_at = ?, resolved_at = ?, "+
+			"creator_id = ?, bounty_paid = ?, pricing_model = ?, liquidity = ?, closes_at = ?, voided = ?, "+
+			"scalar_min = ?, scalar_max = ?, resolved_value = ?, allow_hedging = ?, rules = ? WHERE id = ?",
+		append(args, e.ID)...)
+}
+
+func (s *sqliteEventStore) Delete(id int) error {
+	_, err := s.db.Exec("DELETE FROM events WHERE id = ?", id)
+	return err
+}
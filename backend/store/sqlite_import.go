@@ -0,0 +1,108 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// importCSV copies the CSV files in dataDir, if there are any, into a new
+// SQLite database. Records keep their IDs and timestamps.
+func importCSV(db *sql.DB, dataDir string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var (
+		users        = &sqliteUserStore{db: tx}
+		events       = &sqliteEventStore{db: tx}
+		outcomes     = &sqliteOutcomeStore{db: tx}
+		positions    = &sqlitePositionStore{db: tx, table: "positions"}
+		resolved     = &sqliteResolvedPositionStore{rows: sqlitePositionStore{db: tx, table: "resolved_positions"}}
+		transactions = &sqliteTransactionStore{db: tx}
+		snapshots    = &sqliteOddsSnapshotStore{db: tx}
+		bingoEvents  = &sqliteBingoEventStore{db: tx}
+		bingoBoards  = &sqliteBingoBoardStore{db: tx}
+		bingoWinners = &sqliteBingoWinnerStore{db: tx}
+		activity     = &sqliteActivityStore{db: tx}
+		orders       = &sqliteOrderStore{db: tx}
+	)
+
+	imports := map[string]func(row []string) error{
+		"users.csv": func(row []string) error {
+			u, err := (&csvUserStore{}).fromRow(row)
+			if err != nil {
+				return err
+			}
+			return users.insert(u)
+		},
+		"events.csv": func(row []string) error {
+			e, err := (&csvEventStore{}).fromRow(row)
+			if err != nil {
+				return err
+			}
+			return events.insert(e)
+		},
+		"outcomes.csv": func(row []string) error {
+			return outcomes.Create((&csvOutcomeStore{}).fromRow(row))
+		},
+		"positions.csv": func(row []string) error {
+			return positions.insert((&csvPositionStore{}).fromRow(row))
+		},
+		"resolved_positions.csv": func(row []string) error {
+			return resolved.Create((&csvPositionStore{}).fromRow(row))
+		},
+		"transactions.csv": func(row []string) error {
+			return transactions.insert((&csvTransactionStore{}).fromRow(row))
+		},
+		"odds_snapshots.csv": func(row []string) error {
+			return snapshots.Create((&csvOddsSnapshotStore{}).fromRow(row))
+		},
+		"bingo_events.csv": func(row []string) error {
+			e, err := (&csvBingoEventStore{}).fromRow(row)
+			if err != nil {
+				return err
+			}
+			return bingoEvents.insert(e)
+		},
+		"bingo_boards.csv": func(row []string) error {
+			b, err := (&csvBingoBoardStore{}).fromRow(row)
+			if err != nil {
+				return err
+			}
+			return bingoBoards.insert(b)
+		},
+		"bingo_winners.csv": func(row []string) error {
+			w, err := (&csvBingoWinnerStore{}).fromRow(row)
+			if err != nil {
+				return err
+			}
+			return bingoWinners.insert(w)
+		},
+		"activity.csv": func(row []string) error {
+			return activity.insert((&csvActivityStore{}).fromRow(row))
+		},
+		"orders.csv": func(row []string) error {
+			return orders.insert((&csvOrderStore{}).fromRow(row))
+		},
+	}
+
+	for file, importRow := range imports {
+		rows, err := readAllRows(filepath.Join(dataDir, file))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			if err := importRow(row); err != nil {
+				return fmt.Errorf("%s: %w", file, err)
+			}
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,96 @@
+package store
+
+import (
+	"database/sql"
+	"pauls-bach/models"
+	"strings"
+)
+
+type sqliteOddsSnapshotStore struct {
+	db sqlDB
+}
+
+const oddsSnapshotColumns = "id, event_id, outcome_id, odds, created_at, expected_value"
+
+func scanOddsSnapshot(r sqlScanner) (*models.OddsSnapshot, error) {
+	var o models.OddsSnapshot
+	var expectedValue sql.NullFloat64
+	if err := r.Scan(&o.ID, &o.EventID, &o.OutcomeID, &o.Odds, &o.CreatedAt, &expectedValue); err != nil {
+		return nil, err
+	}
+	if expectedValue.Valid {
+		o.ExpectedValue = &expectedValue.Float64
+	}
+	return &o, nil
+}
+
+func (s *sqliteOddsSnapshotStore) GetByEventID(eventID int) ([]*models.OddsSnapshot, error) {
+	snapshots, err := queryAll(s.db, scanOddsSnapshot, "SELECT "+oddsSnapshotColumns+" FROM odds_snapshots WHERE event_id = ? ORDER BY id", eventID)
+	if err != nil {
+		return nil, err
+	}
+	var results []*models.OddsSnapshot
+	for i := range snapshots {
+		results = append(results, &snapshots[i])
+	}
+	return results, nil
+}
+
+func (s *sqliteOddsSnapshotStore) GetAll() ([]models.OddsSnapshot, error) {
+	return queryAll(s.db, scanOddsSnapshot, "SELECT "+oddsSnapshotColumns+" FROM odds_snapshots ORDER BY id")
+}
+
+func (s *sqliteOddsSnapshotStore) LastSnapshotTimeByEvent() (map[int]string, error) {
+	rows, err := s.db.Query("SELECT event_id, MAX(created_at) FROM odds_snapshots GROUP BY event_id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make(map[int]string)
+	for rows.Next() {
+		var eventID int
+		var createdAt string
+		if err := rows.Scan(&eventID, &createdAt); err != nil {
+			return nil, err
+		}
+		result[eventID] = createdAt
+	}
+	return result, rows.Err()
+}
+
+func (s *sqliteOddsSnapshotStore) Create(o *models.OddsSnapshot) error {
+	if o.CreatedAt == "" {
+		o.CreatedAt = nowRFC3339()
+	}
+	id, err := insertRow(s.db, "INSERT INTO odds_snapshots ("+oddsSnapshotColumns+") VALUES (?, ?, ?, ?, ?, ?)",
+		nullID(o.ID), o.EventID, o.OutcomeID, o.Odds, o.CreatedAt, o.ExpectedValue)
+	if err != nil {
+		return err
+	}
+	o.ID = id
+	return nil
+}
+
+func (s *sqliteOddsSnapshotStore) DeleteByEventID(eventID int) error {
+	_, err := s.db.Exec("DELETE FROM odds_snapshots WHERE event_id = ?", eventID)
+	return err
+}
+
+func (s *sqliteOddsSnapshotStore) DeleteByIDs(ids []int) error {
+	// SQLite limits the number of parameters in a statement
+	const batch = 500
+	for len(ids) > 0 {
+		n := min(len(ids), batch)
+		args := make([]any, n)
+		for i, id := range ids[:n] {
+			args[i] = id
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+		if _, err := s.db.Exec("DELETE FROM odds_snapshots WHERE id IN ("+placeholders+")", args...); err != nil {
+			return err
+		}
+		ids = ids[n:]
+	}
+	return nil
+}
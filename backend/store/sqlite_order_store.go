@@ -0,0 +1,85 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"pauls-bach/models"
+)
+
+type sqliteOrderStore struct {
+	db sqlDB
+}
+
+const orderColumns = "id, user_id, event_id, outcome_id, side, limit_price, amount, shares, status, " +
+	"filled_shares, filled_points, expires_at, created_at, closed_at"
+
+func scanOrder(r sqlScanner) (*models.Order, error) {
+	var o models.Order
+	if err := r.Scan(&o.ID, &o.UserID, &o.EventID, &o.OutcomeID, &o.Side, &o.LimitPrice, &o.Amount, &o.Shares, &o.Status,
+		&o.FilledShares, &o.FilledPoints, &o.ExpiresAt, &o.CreatedAt, &o.ClosedAt); err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+func (s *sqliteOrderStore) query(where string, args ...any) ([]models.Order, error) {
+	return queryAll(s.db, scanOrder, "SELECT "+orderColumns+" FROM orders WHERE "+where+" ORDER BY id", args...)
+}
+
+func (s *sqliteOrderStore) GetByID(id int) (*models.Order, error) {
+	o, err := scanOrder(s.db.QueryRow("SELECT "+orderColumns+" FROM orders WHERE id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("order not found")
+	}
+	return o, err
+}
+
+func (s *sqliteOrderStore) GetByUserID(userID int) ([]models.Order, error) {
+	return s.query("user_id = ?", userID)
+}
+
+func (s *sqliteOrderStore) GetOpen() ([]models.Order, error) {
+	return s.query("status = 'open'")
+}
+
+func (s *sqliteOrderStore) GetOpenByEventID(eventID int) ([]models.Order, error) {
+	return s.query("event_id = ? AND status = 'open'", eventID)
+}
+
+func (s *sqliteOrderStore) GetOpenByUserID(userID int) ([]models.Order, error) {
+	return s.query("user_id = ? AND status = 'open'", userID)
+}
+
+func (s *sqliteOrderStore) GetAll() ([]models.Order, error) {
+	return queryAll(s.db, scanOrder, "SELECT "+orderColumns+" FROM orders ORDER BY id")
+}
+
+func (s *sqliteOrderStore) Create(o *models.Order) error {
+	o.CreatedAt = nowRFC3339()
+	return s.insert(o)
+}
+
+func (s *sqliteOrderStore) insert(o *models.Order) error {
+	id, err := insertRow(s.db, "INSERT INTO orders ("+orderColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		nullID(o.ID), o.UserID, o.EventID, o.OutcomeID, o.Side, o.LimitPrice, o.Amount, o.Shares, o.Status,
+		o.FilledShares, o.FilledPoints, o.ExpiresAt, o.CreatedAt, o.ClosedAt)
+	if err != nil {
+		return err
+	}
+	o.ID = id
+	return nil
+}
+
+func (s *sqliteOrderStore) Update(o *models.Order) error {
+	return updateRow(s.db, "order not found",
+		"UPDATE orders SET user_id = ?, event_id = ?, outcome_id = ?, side = ?, limit_price = ?, amount = ?, shares = ?, status = ?, "+
+			"filled_shares = ?, filled_points = ?, expires_at = ?, created_at = ?, closed_at = ? WHERE id = ?",
+		o.UserID, o.EventID, o.OutcomeID, o.Side, o.LimitPrice, o.Amount, o.Shares, o.Status,
+		o.FilledShares, o.FilledPoints, o.ExpiresAt, o.CreatedAt, o.ClosedAt, o.ID)
+}
+
+func (s *sqliteOrderStore) DeleteByEventID(eventID int) error {
+	_, err := s.db.Exec("DELETE FROM orders WHERE event_id = ?", eventID)
+	return err
+}
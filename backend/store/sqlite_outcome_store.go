@@ -0,0 +1,57 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"pauls-bach/models"
+)
+
+type sqliteOutcomeStore struct {
+	db sqlDB
+}
+
+const outcomeColumns = "id, event_id, label"
+
+func scanOutcome(r sqlScanner) (*models.Outcome, error) {
+	var o models.Outcome
+	if err := r.Scan(&o.ID, &o.EventID, &o.Label); err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+func (s *sqliteOutcomeStore) GetByEventID(eventID int) ([]models.Outcome, error) {
+	return queryAll(s.db, scanOutcome, "SELECT "+outcomeColumns+" FROM outcomes WHERE event_id = ? ORDER BY id", eventID)
+}
+
+func (s *sqliteOutcomeStore) GetByID(id int) (*models.Outcome, error) {
+	o, err := scanOutcome(s.db.QueryRow("SELECT "+outcomeColumns+" FROM outcomes WHERE id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return o, err
+}
+
+func (s *sqliteOutcomeStore) GetAll() ([]models.Outcome, error) {
+	return queryAll(s.db, scanOutcome, "SELECT "+outcomeColumns+" FROM outcomes ORDER BY id")
+}
+
+func (s *sqliteOutcomeStore) Create(o *models.Outcome) error {
+	id, err := insertRow(s.db, "INSERT INTO outcomes ("+outcomeColumns+") VALUES (?, ?, ?)",
+		nullID(o.ID), o.EventID, o.Label)
+	if err != nil {
+		return err
+	}
+	o.ID = id
+	return nil
+}
+
+func (s *sqliteOutcomeStore) Update(o *models.Outcome) error {
+	return updateRow(s.db, "outcome not found",
+		"UPDATE outcomes SET event_id = ?, label = ? WHERE id = ?", o.EventID, o.Label, o.ID)
+}
+
+func (s *sqliteOutcomeStore) DeleteByEventID(eventID int) error {
+	_, err := s.db.Exec("DELETE FROM outcomes WHERE event_id = ?", eventID)
+	return err
+}
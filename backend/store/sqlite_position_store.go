@@ -0,0 +1,114 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"pauls-bach/models"
+)
+
+// sqlitePositionStore serves both the positions and resolved_positions
+// tables, which share a layout.
+type sqlitePositionStore struct {
+	db    sqlDB
+	table string
+}
+
+const positionColumns = "id, user_id, event_id, outcome_id, shares, avg_price, created_at"
+
+func scanPosition(r sqlScanner) (*models.Position, error) {
+	var p models.Position
+	if err := r.Scan(&p.ID, &p.UserID, &p.EventID, &p.OutcomeID, &p.Shares, &p.AvgPrice, &p.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (s *sqlitePositionStore) query(where string, args ...any) ([]models.Position, error) {
+	return queryAll(s.db, scanPosition, "SELECT "+positionColumns+" FROM "+s.table+" WHERE "+where+" ORDER BY id", args...)
+}
+
+func (s *sqlitePositionStore) GetByUserID(userID int) ([]models.Position, error) {
+	return s.query("user_id = ?", userID)
+}
+
+func (s *sqlitePositionStore) GetByEventID(eventID int) ([]models.Position, error) {
+	return s.query("event_id = ?", eventID)
+}
+
+func (s *sqlitePositionStore) GetByUserAndEvent(userID, eventID int) ([]models.Position, error) {
+	return s.query("user_id = ? AND event_id = ?", userID, eventID)
+}
+
+func (s *sqlitePositionStore) GetByUserEventOutcome(userID, eventID, outcomeID int) (*models.Position, error) {
+	p, err := scanPosition(s.db.QueryRow("SELECT "+positionColumns+" FROM "+s.table+
+		" WHERE user_id = ? AND event_id = ? AND outcome_id = ? ORDER BY id LIMIT 1", userID, eventID, outcomeID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return p, err
+}
+
+func (s *sqlitePositionStore) GetAll() ([]models.Position, error) {
+	return queryAll(s.db, scanPosition, "SELECT "+positionColumns+" FROM "+s.table+" ORDER BY id")
+}
+
+func (s *sqlitePositionStore) Create(p *models.Position) error {
+	if p.CreatedAt == "" {
+		p.CreatedAt = nowRFC3339()
+	}
+	return s.insert(p)
+}
+
+func (s *sqlitePositionStore) insert(p *models.Position) error {
+	id, err := insertRow(s.db, "INSERT INTO "+s.table+" ("+positionColumns+") VALUES (?, ?, ?, ?, ?, ?, ?)",
+		nullID(p.ID), p.UserID, p.EventID, p.OutcomeID, p.Shares, p.AvgPrice, p.CreatedAt)
+	if err != nil {
+		return err
+	}
+	p.ID = id
+	return nil
+}
+
+func (s *sqlitePositionStore) Update(p *models.Position) error {
+	return updateRow(s.db, "position not found",
+		"UPDATE "+s.table+" SET user_id = ?, event_id = ?, outcome_id = ?, shares = ?, avg_price = ?, created_at = ? WHERE id = ?",
+		p.UserID, p.EventID, p.OutcomeID, p.Shares, p.AvgPrice, p.CreatedAt, p.ID)
+}
+
+func (s *sqlitePositionStore) Delete(id int) error {
+	_, err := s.db.Exec("DELETE FROM "+s.table+" WHERE id = ?", id)
+	return err
+}
+
+func (s *sqlitePositionStore) DeleteByEventID(eventID int) error {
+	_, err := s.db.Exec("DELETE FROM "+s.table+" WHERE event_id = ?", eventID)
+	return err
+}
+
+// sqliteResolvedPositionStore keeps archived positions with their original
+// IDs and timestamps.
+type sqliteResolvedPositionStore struct {
+	rows sqlitePositionStore
+}
+
+func (s *sqliteResolvedPositionStore) GetByEventID(eventID int) ([]models.Position, error) {
+	return s.rows.GetByEventID(eventID)
+}
+
+func (s *sqliteResolvedPositionStore) GetAll() ([]models.Position, error) {
+	return s.rows.GetAll()
+}
+
+func (s *sqliteResolvedPositionStore) Create(p *models.Position) error {
+	if p.ID == 0 {
+		return fmt.Errorf("resolved position needs an id")
+	}
+	_, err := s.rows.db.Exec("INSERT INTO resolved_positions ("+positionColumns+") VALUES (?, ?, ?, ?, ?, ?, ?)",
+		p.ID, p.UserID, p.EventID, p.OutcomeID, p.Shares, p.AvgPrice, p.CreatedAt)
+	return err
+}
+
+func (s *sqliteResolvedPositionStore) DeleteByEventID(eventID int) error {
+	return s.rows.DeleteByEventID(eventID)
+}
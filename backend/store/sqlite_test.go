@@ -0,0 +1,185 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"pauls-bach/models"
+)
+
+// TestSQLiteImportsCSV switches a data directory with CSV data over to
+// SQLite and trades on it.
+func TestSQLiteImportsCSV(t *testing.T) {
+	dir := t.TempDir()
+	csv, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice := &models.User{Username: "alice"}
+	if err := csv.Users.Create(alice); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := csv.Post(&models.Transaction{UserID: alice.ID, TxType: "grant", Points: models.StartingBalance}); err != nil {
+		t.Fatal(err)
+	}
+	event := &models.Event{Title: "E", EventType: "binary", Status: "open", PricingModel: "pool"}
+	if err := csv.Events.Create(event); err != nil {
+		t.Fatal(err)
+	}
+	yes := &models.Outcome{EventID: event.ID, Label: "Yes"}
+	if err := csv.Outcomes.Create(yes); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewSQLite(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	u, err := s.Users.GetByUsername("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.ID != alice.ID || u.Balance != models.StartingBalance {
+		t.Errorf("imported user %+v, want ID %d with balance %d", u, alice.ID, models.StartingBalance)
+	}
+	if e, err := s.Events.GetByID(event.ID); err != nil || e.Title != "E" {
+		t.Errorf("imported event %+v, %v", e, err)
+	}
+	if txs, _ := s.Transactions.GetByUserID(alice.ID); len(txs) != 1 || txs[0].TxType != "grant" {
+		t.Errorf("imported ledger %+v, want the grant", txs)
+	}
+
+	// A transaction commits its writes together...
+	err = s.Transact(func(s *Store) error {
+		if err := s.Positions.Create(&models.Position{UserID: alice.ID, EventID: event.ID, OutcomeID: yes.ID, Shares: 10, AvgPrice: 0.5}); err != nil {
+			return err
+		}
+		_, err := s.Post(&models.Transaction{UserID: alice.ID, EventID: event.ID, OutcomeID: yes.ID, TxType: "buy", Shares: 10, Points: 10})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// ...and a failed one leaves nothing behind
+	failed := errors.New("fail")
+	err = s.Transact(func(s *Store) error {
+		if _, err := s.Post(&models.Transaction{UserID: alice.ID, TxType: "admin_adjust", Points: 500}); err != nil {
+			return err
+		}
+		return failed
+	})
+	if err != failed {
+		t.Fatalf("Transact returned %v, want %v", err, failed)
+	}
+
+	if u, _ := s.Users.GetByID(alice.ID); u.Balance != models.StartingBalance-10 {
+		t.Errorf("balance %d, want %d", u.Balance, models.StartingBalance-10)
+	}
+	if positions, _ := s.Positions.GetByEventID(event.ID); len(positions) != 1 {
+		t.Errorf("%d positions, want 1", len(positions))
+	}
+	balances, err := s.LedgerBalances()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balances[alice.ID] != models.StartingBalance-10 {
+		t.Errorf("ledger adds up to %d, want %d", balances[alice.ID], models.StartingBalance-10)
+	}
+}
+
+// TestSQLiteLedgerMigration opens a database written before the ledger
+// (schema version 1) and checks it's brought up to version 2.
+func TestSQLiteLedgerMigration(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, sqliteFile)
+	db, err := sql.Open(sqliteDriver, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range sqliteSchema {
+		// Version 1 transactions had no reason
+		stmt = strings.Replace(stmt, ",\n\t\treason TEXT NOT NULL DEFAULT ''", "", 1)
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, stmt := range []string{
+		`INSERT INTO users VALUES (1, 'admin', '', 0, 1, 0, '2024-01-01T00:00:00Z')`,
+		// 1000 - 100 bought + 30 adjusted + 10 bounty + 60 unaccounted for
+		`INSERT INTO users VALUES (2, 'bob', '', 1000, 0, 0, '2024-01-01T00:00:00Z')`,
+		`INSERT INTO transactions VALUES (1, 2, 1, 1, 'buy', 100, 100, '2024-01-02T00:00:00Z')`,
+		`INSERT INTO transactions VALUES (2, 2, 0, 0, 'adjustment', 0, 30, '2024-01-02T00:00:00Z')`,
+		`INSERT INTO transactions VALUES (3, 2, 1, 0, 'bonus', 0, 10, '2024-01-02T00:00:00Z')`,
+		`INSERT INTO transactions VALUES (4, 2, 1, 1, 'bonus', 0, 5, '2024-01-03T00:00:00Z')`,
+		`PRAGMA user_version = 1`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	db.Close()
+
+	s, err := NewSQLite(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	txs, err := s.Transactions.GetByUserID(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	types := make(map[string]int)
+	for _, tx := range txs {
+		types[tx.TxType]++
+	}
+	want := map[string]int{"buy": 1, "admin_adjust": 2, "bounty": 1, "bonus": 1, "grant": 1}
+	for typ, n := range want {
+		if types[typ] != n {
+			t.Errorf("%d %q transactions, want %d (all: %v)", types[typ], typ, n, types)
+		}
+	}
+	if types["adjustment"] != 0 {
+		t.Errorf("old adjustment type left behind")
+	}
+
+	balances, err := s.LedgerBalances()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balances[2] != 1000 {
+		t.Errorf("bob's ledger adds up to %d, want his balance of 1000", balances[2])
+	}
+	if balances[1] != 0 {
+		t.Errorf("admin's ledger adds up to %d, want 0", balances[1])
+	}
+
+	var version int
+	if err := s.checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+	db, err = sql.Open(sqliteDriver, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil || version != sqliteSchemaVersion {
+		t.Errorf("schema version %d (%v), want %d", version, err, sqliteSchemaVersion)
+	}
+
+	// Opening it again doesn't migrate twice
+	s.Close()
+	s, err = NewSQLite(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := s.Transactions.GetByUserID(2); len(again) != len(txs) {
+		t.Errorf("%d transactions after reopening, want %d", len(again), len(txs))
+	}
+	s.Close()
+}
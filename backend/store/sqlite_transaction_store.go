@@ -0,0 +1,44 @@
+package store
+
+import "pauls-bach/models"
+
+type sqliteTransactionStore struct {
+	db sqlDB
+}
+
+const transactionColumns = "id, user_id, event_id, outcome_id, tx_type, shares, points, created_at, reason"
+
+func scanTransaction(r sqlScanner) (*models.Transaction, error) {
+	var t models.Transaction
+	if err := r.Scan(&t.ID, &t.UserID, &t.EventID, &t.OutcomeID, &t.TxType, &t.Shares, &t.Points, &t.CreatedAt, &t.Reason); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (s *sqliteTransactionStore) GetByUserID(userID int) ([]models.Transaction, error) {
+	return queryAll(s.db, scanTransaction, "SELECT "+transactionColumns+" FROM transactions WHERE user_id = ? ORDER BY id", userID)
+}
+
+func (s *sqliteTransactionStore) GetByEventID(eventID int) ([]models.Transaction, error) {
+	return queryAll(s.db, scanTransaction, "SELECT "+transactionColumns+" FROM transactions WHERE event_id = ? ORDER BY id", eventID)
+}
+
+func (s *sqliteTransactionStore) GetAll() ([]models.Transaction, error) {
+	return queryAll(s.db, scanTransaction, "SELECT "+transactionColumns+" FROM transactions ORDER BY id")
+}
+
+func (s *sqliteTransactionStore) Create(t *models.Transaction) error {
+	t.CreatedAt = nowRFC3339()
+	return s.insert(t)
+}
+
+func (s *sqliteTransactionStore) insert(t *models.Transaction) error {
+	id, err := insertRow(s.db, "INSERT INTO transactions ("+transactionColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		nullID(t.ID), t.UserID, t.EventID, t.OutcomeID, t.TxType, t.Shares, t.Points, t.CreatedAt, t.Reason)
+	if err != nil {
+		return err
+	}
+	t.ID = id
+	return nil
+}
@@ -0,0 +1,67 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"pauls-bach/models"
+)
+
+type sqliteUserStore struct {
+	db sqlDB
+}
+
+const userColumns = "id, username, pin_hash, balance, is_admin, bingo, created_at"
+
+func scanUser(r sqlScanner) (*models.User, error) {
+	var u models.User
+	if err := r.Scan(&u.ID, &u.Username, &u.PinHash, &u.Balance, &u.IsAdmin, &u.Bingo, &u.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+func (s *sqliteUserStore) getOne(query string, args ...any) (*models.User, error) {
+	u, err := scanUser(s.db.QueryRow(query, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("user not found")
+	}
+	return u, err
+}
+
+func (s *sqliteUserStore) GetAll() ([]models.User, error) {
+	users, err := queryAll(s.db, scanUser, "SELECT "+userColumns+" FROM users ORDER BY id")
+	if users == nil && err == nil {
+		users = []models.User{}
+	}
+	return users, err
+}
+
+func (s *sqliteUserStore) GetByID(id int) (*models.User, error) {
+	return s.getOne("SELECT "+userColumns+" FROM users WHERE id = ?", id)
+}
+
+func (s *sqliteUserStore) GetByUsername(username string) (*models.User, error) {
+	return s.getOne("SELECT "+userColumns+" FROM users WHERE username = ?", username)
+}
+
+func (s *sqliteUserStore) Create(u *models.User) error {
+	u.CreatedAt = nowRFC3339()
+	return s.insert(u)
+}
+
+func (s *sqliteUserStore) insert(u *models.User) error {
+	id, err := insertRow(s.db, "INSERT INTO users ("+userColumns+") VALUES (?, ?, ?, ?, ?, ?, ?)",
+		nullID(u.ID), u.Username, u.PinHash, u.Balance, u.IsAdmin, u.Bingo, u.CreatedAt)
+	if err != nil {
+		return err
+	}
+	u.ID = id
+	return nil
+}
+
+func (s *sqliteUserStore) Update(u *models.User) error {
+	return updateRow(s.db, "user not found",
+		"UPDATE users SET username = ?, pin_hash = ?, balance = ?, is_admin = ?, bingo = ?, created_at = ? WHERE id = ?",
+		u.Username, u.PinHash, u.Balance, u.IsAdmin, u.Bingo, u.CreatedAt, u.ID)
+}
@@ -1,8 +1,12 @@
 package store
 
 import (
+	"errors"
+	"fmt"
+	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 )
 
@@ -14,55 +18,234 @@ func WriteLock()   { mu.Lock() }
 func WriteUnlock() { mu.Unlock() }
 
 type Store struct {
-	Users         *UserStore
-	Events        *EventStore
-	Outcomes      *OutcomeStore
-	Positions     *PositionStore
-	Transactions  *TransactionStore
-	OddsSnapshots *OddsSnapshotStore
-	BingoEvents   *BingoEventStore
-	BingoBoards   *BingoBoardStore
-	BingoWinners  *BingoWinnerStore
-	Activity      *ActivityStore
+	Users         UserStore
+	Events        EventStore
+	Outcomes      OutcomeStore
+	Positions     PositionStore
+	Transactions  TransactionStore
+	OddsSnapshots OddsSnapshotStore
+	BingoEvents   BingoEventStore
+	BingoBoards   BingoBoardStore
+	BingoWinners  BingoWinnerStore
+	Activity      ActivityStore
+	Orders        OrderStore
+	// Positions as they stood when their event was resolved
+	ResolvedPositions ResolvedPositionStore
+
+	// begin starts a transaction; nil for a store that is already one
+	begin func() (*txn, error)
+	// Set by backends that keep state outside their data files, or open
+	// resources; see Checkpoint and Close
+	checkpoint func() error
+	close      func() error
+}
+
+// Checkpoint brings the files in the data directory up to date with
+// everything committed, so that copying them copies the store. The caller
+// holds the write lock.
+func (s *Store) Checkpoint() error {
+	if s.checkpoint == nil {
+		return nil
+	}
+	return s.checkpoint()
+}
+
+// Close releases the backend's resources. The store can't be used after.
+func (s *Store) Close() error {
+	if s.close == nil {
+		return nil
+	}
+	return s.close()
+}
+
+// Open returns the store kept in dataDir by the given backend: "csv" (the
+// default) or "sqlite", behind an in-memory cache.
+func Open(backend, dataDir string) (*Store, error) {
+	var s *Store
+	var err error
+	switch backend {
+	case "", "csv":
+		s, err = New(dataDir)
+	case "sqlite":
+		s, err = NewSQLite(dataDir)
+	default:
+		return nil, fmt.Errorf("unknown store backend %q", backend)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return Cached(s)
+}
+
+// OpenReadOnly returns the store in dataDir for reading only, for the
+// commands that inspect a data directory while the server is stopped.
+// Unlike Open it changes nothing on disk: instead of recovering an
+// interrupted transaction, repairing a torn row or migrating old data, it
+// fails and says so. Starting the server once does all of those.
+func OpenReadOnly(backend, dataDir string) (*Store, error) {
+	switch backend {
+	case "", "csv":
+		return newCSVReadOnly(dataDir)
+	case "sqlite":
+		return newSQLiteReadOnly(dataDir)
+	default:
+		return nil, fmt.Errorf("unknown store backend %q", backend)
+	}
 }
 
+var (
+	ErrReadOnly = errors.New("store is open read-only")
+	ErrLocked   = errors.New("data directory is in use by another process, such as a running server")
+)
+
+// lockFile is the file LockDir locks. It's hidden, so backups and restores
+// leave it alone.
+const lockFile = ".lock"
+
+// csvHeaders are the CSV store's files and their headers.
+var csvHeaders = map[string][]string{
+	"users.csv":              userHeader,
+	"events.csv":             eventHeader,
+	"outcomes.csv":           outcomeHeader,
+	"positions.csv":          positionHeader,
+	"resolved_positions.csv": positionHeader,
+	"transactions.csv":       transactionHeader,
+	"odds_snapshots.csv":     oddsSnapshotHeader,
+	"bingo_events.csv":       bingoEventHeader,
+	"bingo_boards.csv":       bingoBoardHeader,
+	"bingo_winners.csv":      bingoWinnerHeader,
+	"activity.csv":           activityHeader,
+	"orders.csv":             orderHeader,
+}
+
+// RequiredFiles returns the files in a data directory kept by backend that
+// the store can't do without: the accounts, events, positions and ledger,
+// and what records their layout. Open creates the rest empty when they're
+// missing, but a directory without these has lost its data.
+func RequiredFiles(backend string) ([]string, error) {
+	switch backend {
+	case "", "csv":
+		return []string{schemaVersionFile, "users.csv", "events.csv", "outcomes.csv", "positions.csv", "transactions.csv"}, nil
+	case "sqlite":
+		// The database records its own schema version
+		return []string{sqliteFile}, nil
+	default:
+		return nil, fmt.Errorf("unknown store backend %q", backend)
+	}
+}
+
+// New returns the CSV-backed store, creating any missing files in dataDir.
 func New(dataDir string) (*Store, error) {
 	if err := os.MkdirAll(dataDir, 0755); err != nil {
 		return nil, err
 	}
 
-	headers := map[string]string{
-		"users.csv":          "id,username,pin_hash,balance,is_admin,bingo,created_at",
-		"events.csv":         "id,title,description,event_type,status,winning_outcome_id,created_at,resolved_at,creator_id,bounty_paid",
-		"outcomes.csv":       "id,event_id,label",
-		"positions.csv":      "id,user_id,event_id,outcome_id,shares,avg_price,created_at",
-		"transactions.csv":   "id,user_id,event_id,outcome_id,tx_type,shares,points,created_at",
-		"odds_snapshots.csv": "id,event_id,outcome_id,odds,created_at",
-		"bingo_events.csv":   "id,title,resolved,created_at",
-		"bingo_boards.csv":   "id,user_id,squares,created_at",
-		"bingo_winners.csv":  "id,user_id,username,board_id,line,created_at",
-		"activity.csv":       "id,type,message,user_id,event_id,created_at",
+	if err := checkSchemaVersion(dataDir); err != nil {
+		return nil, err
+	}
+
+	// Finish or discard a transaction interrupted by a crash
+	if err := recoverJournal(dataDir); err != nil {
+		return nil, fmt.Errorf("recover journal: %w", err)
+	}
+
+	// Temp files from a rewrite that never got renamed into place
+	leftovers, _ := filepath.Glob(filepath.Join(dataDir, "*.csv"+tempSuffix+"*"))
+	for _, p := range leftovers {
+		os.Remove(p)
+	}
+
+	for file, header := range csvHeaders {
+		p := filepath.Join(dataDir, file)
+		if _, err := os.Stat(p); os.IsNotExist(err) {
+			continue
+		}
+		dropped, err := repairTornTail(p, strings.Join(header, ","))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		if dropped != "" {
+			log.Printf("store: dropped torn row at end of %s: %q", file, dropped)
+		}
 	}
 
-	for file, header := range headers {
+	if err := migrate(dataDir); err != nil {
+		return nil, err
+	}
+
+	for file, header := range csvHeaders {
 		p := filepath.Join(dataDir, file)
 		if _, err := os.Stat(p); os.IsNotExist(err) {
-			if err := os.WriteFile(p, []byte(header+"\n"), 0644); err != nil {
+			if err := writeAllRows(p, header, nil); err != nil {
 				return nil, err
 			}
 		}
 	}
 
+	seqs := newSequences(dataDir)
+	s := newCSVStore(dataDir, nil, seqs, false)
+	s.begin = func() (*txn, error) { return beginCSV(dataDir, seqs) }
+	return s, nil
+}
+
+// newCSVReadOnly opens the CSV store in dataDir for OpenReadOnly, after
+// checking for everything New would have fixed.
+func newCSVReadOnly(dataDir string) (*Store, error) {
+	if _, err := os.Stat(dataDir); err != nil {
+		return nil, err
+	}
+	if err := checkSchemaVersion(dataDir); err != nil {
+		return nil, err
+	}
+	version, err := ReadSchemaVersion(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	if version < SchemaVersion {
+		return nil, fmt.Errorf("data in %s has schema version %d and needs migrating to %d; start the server once to migrate it", dataDir, version, SchemaVersion)
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, journalFile)); err == nil {
+		return nil, fmt.Errorf("data in %s has a transaction interrupted by a crash; start the server once to recover it", dataDir)
+	}
+	for file := range csvHeaders {
+		data, err := os.ReadFile(filepath.Join(dataDir, file))
+		if err != nil {
+			return nil, err
+		}
+		torn := int64(0)
+		if len(data) > 0 {
+			if torn, err = tornTail(data); err != nil {
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+		}
+		if torn >= 0 {
+			return nil, fmt.Errorf("%s ends with a row torn by a crash; start the server once to repair it", file)
+		}
+	}
+
+	s := newCSVStore(dataDir, nil, newSequences(dataDir), true)
+	s.begin = func() (*txn, error) { return nil, ErrReadOnly }
+	return s, nil
+}
+
+// newCSVStore returns the CSV stores for dataDir. With a non-nil tx they
+// read and write its staged copies of the files instead of the files.
+func newCSVStore(dataDir string, tx *csvTx, seqs map[string]*sequence, readOnly bool) *Store {
+	file := func(name string) csvFile {
+		return csvFile{path: filepath.Join(dataDir, name), tx: tx, seq: seqs[name], readOnly: readOnly}
+	}
 	return &Store{
-		Users:         &UserStore{filePath: filepath.Join(dataDir, "users.csv")},
-		Events:        &EventStore{filePath: filepath.Join(dataDir, "events.csv")},
-		Outcomes:      &OutcomeStore{filePath: filepath.Join(dataDir, "outcomes.csv")},
-		Positions:     &PositionStore{filePath: filepath.Join(dataDir, "positions.csv")},
-		Transactions:  &TransactionStore{filePath: filepath.Join(dataDir, "transactions.csv")},
-		OddsSnapshots: &OddsSnapshotStore{filePath: filepath.Join(dataDir, "odds_snapshots.csv")},
-		BingoEvents:   &BingoEventStore{filePath: filepath.Join(dataDir, "bingo_events.csv")},
-		BingoBoards:   &BingoBoardStore{filePath: filepath.Join(dataDir, "bingo_boards.csv")},
-		BingoWinners:  &BingoWinnerStore{filePath: filepath.Join(dataDir, "bingo_winners.csv")},
-		Activity:      &ActivityStore{filePath: filepath.Join(dataDir, "activity.csv")},
-	}, nil
+		Users:             &csvUserStore{file: file("users.csv")},
+		Events:            &csvEventStore{file: file("events.csv")},
+		Outcomes:          &csvOutcomeStore{file: file("outcomes.csv")},
+		Positions:         &csvPositionStore{file: file("positions.csv")},
+		Transactions:      &csvTransactionStore{file: file("transactions.csv")},
+		OddsSnapshots:     &csvOddsSnapshotStore{file: file("odds_snapshots.csv")},
+		BingoEvents:       &csvBingoEventStore{file: file("bingo_events.csv")},
+		BingoBoards:       &csvBingoBoardStore{file: file("bingo_boards.csv")},
+		BingoWinners:      &csvBingoWinnerStore{file: file("bingo_winners.csv")},
+		Activity:          &csvActivityStore{file: file("activity.csv")},
+		Orders:            &csvOrderStore{file: file("orders.csv")},
+		ResolvedPositions: &csvResolvedPositionStore{file: file("resolved_positions.csv")},
+	}
 }
@@ -0,0 +1,104 @@
+package store
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"pauls-bach/models"
+)
+
+// The append path should cost the same however long the file already is.
+// Compare e.g.
+//
+//	go test ./store -run '^$' -bench . -benchtime 200x
+
+var benchSizes = []int{1_000, 10_000, 100_000}
+
+// newBenchStore returns a CSV store for a user with ID 1 whose ledger and
+// odds snapshots already have n rows each. The benchmarks create one record
+// before starting the clock, so that reading the file to seed its ID
+// sequence isn't counted.
+func newBenchStore(b *testing.B, n int) *Store {
+	b.Helper()
+	dir := b.TempDir()
+	now := time.Now().Format(time.RFC3339)
+	fill := func(file string, header []string, row func(id string) []string) {
+		rows := make([][]string, n)
+		for i := range rows {
+			rows[i] = row(strconv.Itoa(i + 1))
+		}
+		if err := writeAllRows(filepath.Join(dir, file), header, rows); err != nil {
+			b.Fatal(err)
+		}
+	}
+	fill("transactions.csv", transactionHeader, func(id string) []string {
+		return []string{id, "1", "1", "1", "buy", "1.000000", "1", now, ""}
+	})
+	fill("odds_snapshots.csv", oddsSnapshotHeader, func(id string) []string {
+		return []string{id, "1", "1", "50.00", now, ""}
+	})
+	users := [][]string{{"1", "bench", "", strconv.Itoa(-n), "false", "false", now}}
+	if err := writeAllRows(filepath.Join(dir, "users.csv"), userHeader, users); err != nil {
+		b.Fatal(err)
+	}
+	if err := writeSchemaVersion(dir, SchemaVersion); err != nil {
+		b.Fatal(err)
+	}
+	s, err := New(dir)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return s
+}
+
+// benchLoop times b.N calls of create, after a first untimed one.
+func benchLoop(b *testing.B, create func() error) {
+	b.Helper()
+	if err := create(); err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := create(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkTransactionCreate(b *testing.B) {
+	for _, n := range benchSizes {
+		b.Run(fmt.Sprintf("rows=%d", n), func(b *testing.B) {
+			s := newBenchStore(b, n)
+			benchLoop(b, func() error {
+				return s.Transactions.Create(&models.Transaction{UserID: 1, EventID: 1, OutcomeID: 1, TxType: "buy", Shares: 1, Points: 1})
+			})
+		})
+	}
+}
+
+// BenchmarkPost appends to the ledger inside a transaction, as trades do.
+func BenchmarkPost(b *testing.B) {
+	for _, n := range benchSizes {
+		b.Run(fmt.Sprintf("rows=%d", n), func(b *testing.B) {
+			s := newBenchStore(b, n)
+			benchLoop(b, func() error {
+				_, err := s.Post(&models.Transaction{UserID: 1, TxType: "grant", Points: 1})
+				return err
+			})
+		})
+	}
+}
+
+func BenchmarkOddsSnapshotCreate(b *testing.B) {
+	for _, n := range benchSizes {
+		b.Run(fmt.Sprintf("rows=%d", n), func(b *testing.B) {
+			s := newBenchStore(b, n)
+			benchLoop(b, func() error {
+				return s.OddsSnapshots.Create(&models.OddsSnapshot{EventID: 1, OutcomeID: 1, Odds: 50})
+			})
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package store
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"pauls-bach/models"
+)
+
+func TestOpenReadOnly(t *testing.T) {
+	dir := t.TempDir()
+	s, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Users.Create(&models.User{Username: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+
+	ro, err := OpenReadOnly("csv", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := usernames(t, ro); len(got) != 1 || got[0] != "alice" {
+		t.Errorf("users %v, want [alice]", got)
+	}
+	if err := ro.Users.Create(&models.User{Username: "bob"}); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Create returned %v, want %v", err, ErrReadOnly)
+	}
+	if err := ro.Transact(func(*Store) error { return nil }); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Transact returned %v, want %v", err, ErrReadOnly)
+	}
+
+	// What New would fix, OpenReadOnly refuses, and leaves as it was
+	users := filepath.Join(dir, "users.csv")
+	before := readFile(t, users)
+	tests := []struct {
+		name  string
+		setup func() error
+		undo  func() error
+	}{
+		{"journal", func() error {
+			return os.WriteFile(filepath.Join(dir, journalFile), []byte("[]"), 0644)
+		}, func() error {
+			return os.Remove(filepath.Join(dir, journalFile))
+		}},
+		{"torn row", func() error {
+			return os.WriteFile(users, []byte(before+"2,bo"), 0644)
+		}, func() error {
+			return os.WriteFile(users, []byte(before), 0644)
+		}},
+		{"old schema", func() error {
+			return writeSchemaVersion(dir, SchemaVersion-1)
+		}, func() error {
+			return writeSchemaVersion(dir, SchemaVersion)
+		}},
+	}
+	for _, tt := range tests {
+		if err := tt.setup(); err != nil {
+			t.Fatal(err)
+		}
+		snapshot := readFile(t, users)
+		if _, err := OpenReadOnly("csv", dir); err == nil {
+			t.Errorf("%s: opened read-only", tt.name)
+		}
+		if got := readFile(t, users); got != snapshot {
+			t.Errorf("%s: users.csv changed from %q to %q", tt.name, snapshot, got)
+		}
+		if err := tt.undo(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := OpenReadOnly("csv", filepath.Join(dir, "missing")); err == nil {
+		t.Error("opened a data directory that doesn't exist")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "missing")); !os.IsNotExist(err) {
+		t.Error("read-only open created the data directory")
+	}
+}
+
+func TestOpenSQLiteReadOnly(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewSQLite(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Users.Create(&models.User{Username: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	ro, err := OpenReadOnly("sqlite", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ro.Close()
+	if got := usernames(t, ro); len(got) != 1 || got[0] != "alice" {
+		t.Errorf("users %v, want [alice]", got)
+	}
+	if err := ro.Users.Create(&models.User{Username: "bob"}); err == nil {
+		t.Error("wrote to a read-only store")
+	}
+}
+
+func TestLockDir(t *testing.T) {
+	dir := t.TempDir()
+	release, err := LockDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LockDir(dir); !errors.Is(err, ErrLocked) {
+		t.Errorf("second lock returned %v, want %v", err, ErrLocked)
+	}
+	release()
+	release, err = LockDir(dir)
+	if err != nil {
+		t.Fatalf("lock after release: %v", err)
+	}
+	release()
+}
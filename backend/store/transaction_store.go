@@ -6,11 +6,11 @@ import (
 	"time"
 )
 
-type TransactionStore struct {
-	filePath string
+type csvTransactionStore struct {
+	file csvFile
 }
 
-func (s *TransactionStore) toRow(t *models.Transaction) []string {
+func (s *csvTransactionStore) toRow(t *models.Transaction) []string {
 	return []string{
 		strconv.Itoa(t.ID),
 		strconv.Itoa(t.UserID),
@@ -20,10 +20,11 @@ func (s *TransactionStore) toRow(t *models.Transaction) []string {
 		strconv.FormatFloat(t.Shares, 'f', 6, 64),
 		strconv.Itoa(t.Points),
 		t.CreatedAt,
+		t.Reason,
 	}
 }
 
-func (s *TransactionStore) fromRow(row []string) *models.Transaction {
+func (s *csvTransactionStore) fromRow(row []string) *models.Transaction {
 	id, _ := strconv.Atoi(row[0])
 	userID, _ := strconv.Atoi(row[1])
 	eventID, _ := strconv.Atoi(row[2])
@@ -39,11 +40,21 @@ func (s *TransactionStore) fromRow(row []string) *models.Transaction {
 		Shares:    shares,
 		Points:    points,
 		CreatedAt: row[7],
+		Reason:    row[8],
 	}
 }
 
-func (s *TransactionStore) GetByUserID(userID int) ([]models.Transaction, error) {
-	rows, err := readAllRows(s.filePath)
+// canonical returns v as it reads back from the file, which rounds floats.
+func (s *csvTransactionStore) canonical(v models.Transaction) models.Transaction {
+	return *s.fromRow(s.toRow(&v))
+}
+
+func (s *csvTransactionStore) GetAll() ([]models.Transaction, error) {
+	return readAllAs(s.file, s.fromRow)
+}
+
+func (s *csvTransactionStore) GetByUserID(userID int) ([]models.Transaction, error) {
+	rows, err := s.file.readAll()
 	if err != nil {
 		return nil, err
 	}
@@ -57,29 +68,29 @@ func (s *TransactionStore) GetByUserID(userID int) ([]models.Transaction, error)
 	return txs, nil
 }
 
-var transactionHeader = []string{"id", "user_id", "event_id", "outcome_id", "tx_type", "shares", "points", "created_at"}
-
-func (s *TransactionStore) DeleteByEventID(eventID int) error {
-	rows, err := readAllRows(s.filePath)
+func (s *csvTransactionStore) GetByEventID(eventID int) ([]models.Transaction, error) {
+	rows, err := s.file.readAll()
 	if err != nil {
-		return err
+		return nil, err
 	}
-	var kept [][]string
+	var txs []models.Transaction
 	for _, row := range rows {
 		eid, _ := strconv.Atoi(row[2])
-		if eid != eventID {
-			kept = append(kept, row)
+		if eid == eventID {
+			txs = append(txs, *s.fromRow(row))
 		}
 	}
-	return writeAllRows(s.filePath, transactionHeader, kept)
+	return txs, nil
 }
 
-func (s *TransactionStore) Create(t *models.Transaction) error {
-	id, err := nextID(s.filePath)
+var transactionHeader = []string{"id", "user_id", "event_id", "outcome_id", "tx_type", "shares", "points", "created_at", "reason"}
+
+func (s *csvTransactionStore) Create(t *models.Transaction) error {
+	id, err := s.file.nextID()
 	if err != nil {
 		return err
 	}
 	t.ID = id
 	t.CreatedAt = time.Now().Format(time.RFC3339)
-	return appendRow(s.filePath, s.toRow(t))
+	return s.file.append(s.toRow(t))
 }
@@ -0,0 +1,31 @@
+package store
+
+// txn is a transaction in progress. Its store reads its own uncommitted
+// changes; nobody else sees them until commit succeeds.
+type txn struct {
+	store    *Store
+	commit   func() error
+	rollback func()
+}
+
+// Transact runs fn with a store whose changes are all committed if fn returns
+// nil and all discarded otherwise, so a multi-step write such as a trade
+// can't leave some of its steps applied and not others.
+//
+// Called on a store that is already a transaction, fn simply joins it: its
+// changes commit or roll back with the outer transaction, so it should pass
+// any error up. Callers are expected to hold the write lock.
+func (s *Store) Transact(fn func(s *Store) error) error {
+	if s.begin == nil {
+		return fn(s)
+	}
+	tx, err := s.begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx.store); err != nil {
+		tx.rollback()
+		return err
+	}
+	return tx.commit()
+}
@@ -7,13 +7,13 @@ import (
 	"time"
 )
 
-type UserStore struct {
-	filePath string
+type csvUserStore struct {
+	file csvFile
 }
 
 var userHeader = []string{"id", "username", "pin_hash", "balance", "is_admin", "bingo", "created_at"}
 
-func (s *UserStore) toRow(u *models.User) []string {
+func (s *csvUserStore) toRow(u *models.User) []string {
 	return []string{
 		strconv.Itoa(u.ID),
 		u.Username,
@@ -25,29 +25,22 @@ func (s *UserStore) toRow(u *models.User) []string {
 	}
 }
 
-func (s *UserStore) fromRow(row []string) (*models.User, error) {
+func (s *csvUserStore) fromRow(row []string) (*models.User, error) {
 	id, _ := strconv.Atoi(row[0])
 	balance, _ := strconv.Atoi(row[3])
-	isAdmin := row[4] == "true"
-	bingo := false
-	createdAt := row[5]
-	if len(row) > 6 {
-		bingo = row[5] == "true"
-		createdAt = row[6]
-	}
 	return &models.User{
 		ID:        id,
 		Username:  row[1],
 		PinHash:   row[2],
 		Balance:   balance,
-		IsAdmin:   isAdmin,
-		Bingo:     bingo,
-		CreatedAt: createdAt,
+		IsAdmin:   row[4] == "true",
+		Bingo:     row[5] == "true",
+		CreatedAt: row[6],
 	}, nil
 }
 
-func (s *UserStore) GetAll() ([]models.User, error) {
-	rows, err := readAllRows(s.filePath)
+func (s *csvUserStore) GetAll() ([]models.User, error) {
+	rows, err := s.file.readAll()
 	if err != nil {
 		return nil, err
 	}
@@ -62,8 +55,8 @@ func (s *UserStore) GetAll() ([]models.User, error) {
 	return users, nil
 }
 
-func (s *UserStore) GetByID(id int) (*models.User, error) {
-	rows, err := readAllRows(s.filePath)
+func (s *csvUserStore) GetByID(id int) (*models.User, error) {
+	rows, err := s.file.readAll()
 	if err != nil {
 		return nil, err
 	}
@@ -76,8 +69,8 @@ func (s *UserStore) GetByID(id int) (*models.User, error) {
 	return nil, fmt.Errorf("user not found")
 }
 
-func (s *UserStore) GetByUsername(username string) (*models.User, error) {
-	rows, err := readAllRows(s.filePath)
+func (s *csvUserStore) GetByUsername(username string) (*models.User, error) {
+	rows, err := s.file.readAll()
 	if err != nil {
 		return nil, err
 	}
@@ -89,18 +82,18 @@ func (s *UserStore) GetByUsername(username string) (*models.User, error) {
 	return nil, fmt.Errorf("user not found")
 }
 
-func (s *UserStore) Create(u *models.User) error {
-	id, err := nextID(s.filePath)
+func (s *csvUserStore) Create(u *models.User) error {
+	id, err := s.file.nextID()
 	if err != nil {
 		return err
 	}
 	u.ID = id
 	u.CreatedAt = time.Now().Format(time.RFC3339)
-	return appendRow(s.filePath, s.toRow(u))
+	return s.file.append(s.toRow(u))
 }
 
-func (s *UserStore) Update(u *models.User) error {
-	rows, err := readAllRows(s.filePath)
+func (s *csvUserStore) Update(u *models.User) error {
+	rows, err := s.file.readAll()
 	if err != nil {
 		return err
 	}
@@ -108,7 +101,7 @@ func (s *UserStore) Update(u *models.User) error {
 		rowID, _ := strconv.Atoi(row[0])
 		if rowID == u.ID {
 			rows[i] = s.toRow(u)
-			return writeAllRows(s.filePath, userHeader, rows)
+			return s.file.writeAll(userHeader, rows)
 		}
 	}
 	return fmt.Errorf("user not found")
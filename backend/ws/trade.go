@@ -0,0 +1,67 @@
+package ws
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"pauls-bach/middleware"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// trade runs a trade's HTTP handler as the client's user, as if it had
+// POSTed the message's data to /events/{event_id}/..., and replies with
+// what the handler wrote.
+func (s *session) trade(handle http.HandlerFunc, req request) reply {
+	if s.client.UserID == 0 {
+		return errorReply(req.ID, "unauthorized")
+	}
+	if !s.expires.IsZero() && !time.Now().Before(s.expires) {
+		return errorReply(req.ID, "token expired")
+	}
+
+	r, err := http.NewRequestWithContext(s.ctx, http.MethodPost, "/", bytes.NewReader(req.Data))
+	if err != nil {
+		return errorReply(req.ID, err.Error())
+	}
+	route := chi.NewRouteContext()
+	route.URLParams.Add("id", strconv.Itoa(req.EventID))
+	ctx := context.WithValue(r.Context(), chi.RouteCtxKey, route)
+	ctx = context.WithValue(ctx, middleware.UserIDKey, s.client.UserID)
+	ctx = context.WithValue(ctx, middleware.IsAdminKey, s.client.IsAdmin)
+
+	rec := &recorder{header: make(http.Header), status: http.StatusOK}
+	handle(rec, r.WithContext(ctx))
+
+	body := bytes.TrimSpace(rec.body.Bytes())
+	if rec.status >= http.StatusBadRequest {
+		var resp struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(body, &resp) != nil || resp.Error == "" {
+			resp.Error = http.StatusText(rec.status)
+		}
+		return errorReply(req.ID, resp.Error)
+	}
+	if !json.Valid(body) {
+		body = nil
+	}
+	return reply{Type: replyResult, ID: req.ID, Data: body}
+}
+
+// recorder is the http.ResponseWriter a trade's handler writes to.
+type recorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *recorder) Header() http.Header { return r.header }
+
+func (r *recorder) Write(p []byte) (int, error) { return r.body.Write(p) }
+
+func (r *recorder) WriteHeader(status int) { r.status = status }
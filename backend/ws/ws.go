@@ -0,0 +1,280 @@
+// Package ws connects clients to the hub over WebSocket. They are sent the
+// same messages as SSE clients, with each one's ID in an "id" field, and
+// can send messages back: to change their topics, to acknowledge what
+// they've received, and to trade.
+//
+// Client messages:
+//
+//	{"type": "subscribe", "topics": ["event:3"]}
+//	{"type": "unsubscribe", "topics": ["event:3"]}
+//	{"type": "ack", "id": 1712345678901234}
+//	{"type": "buy", "id": "c1", "event_id": 3, "data": {"outcome_id": 7, "amount": 50}}
+//	{"type": "sell", "id": "c2", "event_id": 3, "data": {"outcome_id": 7, "shares": 1.5}}
+//
+// Apart from acks, the "id" is the client's own, and is echoed in the reply:
+// {"type": "result", "id": "c1", "data": ...} with what the matching HTTP
+// endpoint would have returned, or {"type": "error", "id": "c1", "error":
+// "..."}.
+package ws
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"pauls-bach/hub"
+
+	"github.com/coder/websocket"
+)
+
+// Reply types
+const (
+	replyResult = "result"
+	replyError  = "error"
+)
+
+// maxUnacked is how many messages a client that acknowledges them may be
+// sent without doing so before it counts as lagging.
+const maxUnacked = 256
+
+// writeTimeout bounds how long sending one message may take.
+const writeTimeout = 10 * time.Second
+
+type Handler struct {
+	Hub *hub.Hub
+	// Every connection is pinged this often, and closed if the pong takes
+	// longer than that; 0 disables it
+	Heartbeat time.Duration
+	// Trades are the client message types that run an HTTP handler, by
+	// type, e.g. "buy": TradingHandler.Buy; see trade
+	Trades map[string]http.HandlerFunc
+}
+
+// request is a message from a client.
+type request struct {
+	Type    string          `json:"type"`
+	ID      json.RawMessage `json:"id"`
+	Topics  []string        `json:"topics"`
+	EventID int             `json:"event_id"`
+	Data    json.RawMessage `json:"data"`
+}
+
+type reply struct {
+	Type  string          `json:"type"`
+	ID    json.RawMessage `json:"id,omitempty"`
+	Data  json.RawMessage `json:"data,omitempty"`
+	Error string          `json:"error,omitempty"`
+}
+
+func errorReply(id json.RawMessage, msg string) reply {
+	return reply{Type: replyError, ID: id, Error: msg}
+}
+
+// session is one client's connection.
+type session struct {
+	hub    *hub.Hub
+	conn   *websocket.Conn
+	client *hub.Client
+	// When the token the client connected with expires. The session outlives
+	// it, but can't trade after
+	expires time.Time
+	ctx     context.Context
+	cancel  context.CancelFunc
+	acks    chan uint64
+	// IDs of the messages sent since the client's last ack, once it has
+	// sent one
+	acking  bool
+	unacked []uint64
+}
+
+// ServeHTTP handles the WebSocket endpoint. The query takes the client's
+// token, the topics it wants, comma-separated (see package hub), and when
+// resuming, the ID of the last message it saw as last_event_id.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	userID, isAdmin, expires := h.Hub.Authenticate(r.URL.Query().Get("token"))
+	topics := hub.SplitTopics(r.URL.Query().Get("topics"))
+	c, attached, err := h.Hub.Attach(userID, isAdmin, topics, parseLastEventID(r))
+	if err != nil {
+		status := hub.ErrorStatus(err)
+		if status == http.StatusServiceUnavailable {
+			w.Header().Set("Retry-After", "30")
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	defer h.Hub.Detach(c)
+
+	// Clients authenticate with a token rather than cookies, so as with
+	// SSE, any origin may connect
+	conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{InsecureSkipVerify: true})
+	if err != nil {
+		return
+	}
+	defer conn.CloseNow()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := &session{hub: h.Hub, conn: conn, client: c, expires: expires, ctx: ctx, cancel: cancel, acks: make(chan uint64)}
+	go s.read(h.Trades)
+
+	for _, d := range attached.First() {
+		if err := s.deliver(d); err != nil {
+			return
+		}
+	}
+
+	var heartbeat <-chan time.Time
+	if h.Heartbeat > 0 {
+		ticker := time.NewTicker(h.Heartbeat)
+		defer ticker.Stop()
+		heartbeat = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.Lagged():
+			s.write([]byte(`{"type":"` + hub.EventLagged + `"}`))
+			conn.Close(websocket.StatusTryAgainLater, hub.EventLagged)
+			return
+		case d := <-c.Messages():
+			if err := s.deliver(d); err != nil {
+				return
+			}
+		case id := <-s.acks:
+			s.ack(id)
+		case <-heartbeat:
+			go s.ping(h.Heartbeat)
+		}
+	}
+}
+
+// read handles the client's messages until the connection closes.
+func (s *session) read(trades map[string]http.HandlerFunc) {
+	defer s.cancel()
+	for {
+		_, data, err := s.conn.Read(s.ctx)
+		if err != nil {
+			return
+		}
+		var req request
+		if err := json.Unmarshal(data, &req); err != nil {
+			s.reply(errorReply(nil, "invalid message"))
+			continue
+		}
+
+		switch req.Type {
+		case "subscribe":
+			if err := s.hub.Subscribe(s.client, req.Topics); err != nil {
+				s.reply(errorReply(req.ID, err.Error()))
+			} else if req.ID != nil {
+				s.reply(reply{Type: replyResult, ID: req.ID})
+			}
+		case "unsubscribe":
+			s.hub.Unsubscribe(s.client, req.Topics)
+			if req.ID != nil {
+				s.reply(reply{Type: replyResult, ID: req.ID})
+			}
+		case "ack":
+			id, err := strconv.ParseUint(string(req.ID), 10, 64)
+			if err != nil {
+				s.reply(errorReply(nil, "invalid ack"))
+				continue
+			}
+			select {
+			case s.acks <- id:
+			case <-s.ctx.Done():
+				return
+			}
+		default:
+			handle, ok := trades[req.Type]
+			if !ok {
+				s.reply(errorReply(req.ID, "unknown message type"))
+				continue
+			}
+			s.reply(s.trade(handle, req))
+		}
+	}
+}
+
+// deliver sends a hub message, with its ID added to the JSON object. The
+// hub only publishes objects, but anything else is sent as its "data".
+func (s *session) deliver(d hub.Delivery) error {
+	data := bytes.TrimSpace(d.Data)
+	var msg []byte
+	switch {
+	case len(data) > 0 && data[0] == '{':
+		rest := bytes.TrimSpace(data[1:])
+		if len(rest) > 0 && rest[0] == '}' {
+			msg = fmt.Appendf(nil, `{"id":%d}`, d.ID)
+		} else {
+			msg = fmt.Appendf(nil, `{"id":%d,%s`, d.ID, rest)
+		}
+	case json.Valid(data):
+		msg = fmt.Appendf(nil, `{"id":%d,"data":%s}`, d.ID, data)
+	default:
+		msg = fmt.Appendf(nil, `{"id":%d}`, d.ID)
+	}
+	if err := s.write(msg); err != nil {
+		return err
+	}
+	if s.acking {
+		s.unacked = append(s.unacked, d.ID)
+		if len(s.unacked) > maxUnacked {
+			s.hub.Lag(s.client)
+		}
+	}
+	return nil
+}
+
+// ack records that the client has received every message up to id. Acks
+// are optional; a client that sends them is detached if it falls too far
+// behind, rather than only when the hub can't queue its messages.
+func (s *session) ack(id uint64) {
+	s.acking = true
+	n := 0
+	for n < len(s.unacked) && s.unacked[n] <= id {
+		n++
+	}
+	s.unacked = s.unacked[n:]
+}
+
+func (s *session) reply(r reply) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return
+	}
+	s.write(data)
+}
+
+// write sends a text message. It's safe to call from both the session's
+// goroutines.
+func (s *session) write(data []byte) error {
+	ctx, cancel := context.WithTimeout(s.ctx, writeTimeout)
+	defer cancel()
+	return s.conn.Write(ctx, websocket.MessageText, data)
+}
+
+// ping closes the session if the client doesn't answer a ping in time.
+func (s *session) ping(timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(s.ctx, timeout)
+	defer cancel()
+	if err := s.conn.Ping(ctx); err != nil {
+		s.cancel()
+	}
+}
+
+// parseLastEventID returns the last_event_id a resuming client passed, or
+// nil.
+func parseLastEventID(r *http.Request) *uint64 {
+	id, err := strconv.ParseUint(r.URL.Query().Get("last_event_id"), 10, 64)
+	if err != nil {
+		return nil
+	}
+	return &id
+}
@@ -0,0 +1,284 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"pauls-bach/hub"
+	"pauls-bach/middleware"
+
+	"github.com/coder/websocket"
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const secret = "secret"
+
+// passthrough is a Publisher that lets a test hand the hub any delivery.
+type passthrough struct {
+	hub.Publisher
+	deliver func(hub.Delivery, []string)
+}
+
+func (p *passthrough) Start(deliver func(hub.Delivery, []string)) {
+	p.Publisher.Start(deliver)
+	p.deliver = deliver
+}
+
+// echo is a trade that replies with who asked, on which event, and what
+// for, or fails as a handler does if the amount is negative.
+func echo(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Amount int `json:"amount"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+	if req.Amount < 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "amount must be positive"})
+		return
+	}
+	eventID, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	json.NewEncoder(w).Encode(map[string]int{
+		"user_id":  r.Context().Value(middleware.UserIDKey).(int),
+		"event_id": eventID,
+		"amount":   req.Amount,
+	})
+}
+
+type testServer struct {
+	*httptest.Server
+	hub *hub.Hub
+	pub *passthrough
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	pub := &passthrough{Publisher: hub.NewLocal()}
+	h := hub.New(secret, pub)
+	srv := httptest.NewServer(&Handler{Hub: h, Trades: map[string]http.HandlerFunc{"buy": echo}})
+	t.Cleanup(srv.Close)
+	return &testServer{Server: srv, hub: h, pub: pub}
+}
+
+func token(t *testing.T, userID int, expires time.Time) string {
+	t.Helper()
+	tok, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": userID,
+		"exp":     expires.Unix(),
+	}).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tok
+}
+
+type message struct {
+	ID    json.RawMessage `json:"id"`
+	Type  string          `json:"type"`
+	Data  json.RawMessage `json:"data"`
+	Error string          `json:"error"`
+}
+
+type client struct {
+	t    *testing.T
+	conn *websocket.Conn
+}
+
+// dial connects to the server with the given query.
+func (s *testServer) dial(t *testing.T, query string) *client {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(s.URL, "http")+"?"+query, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.CloseNow() })
+	return &client{t: t, conn: conn}
+}
+
+func (c *client) read() ([]byte, message) {
+	c.t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, data, err := c.conn.Read(ctx)
+	if err != nil {
+		c.t.Fatalf("read: %v", err)
+	}
+	var m message
+	if err := json.Unmarshal(data, &m); err != nil {
+		c.t.Fatalf("message %s: %v", data, err)
+	}
+	return data, m
+}
+
+func (c *client) send(msg string) {
+	c.t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.conn.Write(ctx, websocket.MessageText, []byte(msg)); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// id returns the hub message ID of m.
+func (m message) id(t *testing.T) uint64 {
+	t.Helper()
+	id, err := strconv.ParseUint(string(m.ID), 10, 64)
+	if err != nil {
+		t.Fatalf("message ID %s: %v", m.ID, err)
+	}
+	return id
+}
+
+func TestSubscribe(t *testing.T) {
+	s := newTestServer(t)
+	c := s.dial(t, "topics=global")
+	if _, m := c.read(); m.Type != hub.EventConnected {
+		t.Fatalf("first message %q, want connected", m.Type)
+	}
+
+	s.hub.Publish("odds", map[string]int{"n": 1}, hub.EventTopic(3))
+	c.send(`{"type":"subscribe","id":"s1","topics":["event:3"]}`)
+	if _, m := c.read(); m.Type != replyResult || string(m.ID) != `"s1"` {
+		t.Fatalf("got %+v, want the subscribe's result", m)
+	}
+	s.hub.Publish("odds", map[string]int{"n": 2}, hub.EventTopic(3))
+	if _, m := c.read(); m.Type != "odds" || string(m.Data) != `{"n":2}` {
+		t.Errorf("got %+v, want the second odds message", m)
+	}
+
+	c.send(`{"type":"subscribe","id":"s2","topics":["admin"]}`)
+	if _, m := c.read(); m.Type != replyError || string(m.ID) != `"s2"` || !strings.Contains(m.Error, "not allowed") {
+		t.Errorf("got %+v, want the admin topic refused", m)
+	}
+	c.send(`{"type":"unsubscribe","id":"u1","topics":["event:3"]}`)
+	if _, m := c.read(); m.Type != replyResult {
+		t.Fatalf("got %+v, want the unsubscribe's result", m)
+	}
+	s.hub.Publish("odds", map[string]int{"n": 3}, hub.EventTopic(3))
+	s.hub.Broadcast("news", nil)
+	if _, m := c.read(); m.Type != "news" {
+		t.Errorf("got %+v after unsubscribing, want news", m)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	s := newTestServer(t)
+	s.hub.Broadcast("before", nil)
+	c := s.dial(t, "")
+	_, connected := c.read()
+	last := connected.id(t)
+	c.conn.Close(websocket.StatusNormalClosure, "")
+
+	s.hub.Broadcast("missed", 1)
+	s.hub.Broadcast("missed", 2)
+	c = s.dial(t, "last_event_id="+strconv.FormatUint(last, 10))
+	for i := 1; i <= 2; i++ {
+		_, m := c.read()
+		if m.Type != "missed" || string(m.Data) != strconv.Itoa(i) || m.id(t) != last+uint64(i) {
+			t.Fatalf("replayed %+v, want missed %d with ID %d", m, i, last+uint64(i))
+		}
+	}
+
+	c = s.dial(t, "last_event_id=1")
+	if _, m := c.read(); m.Type != hub.EventResync {
+		t.Errorf("resuming from ID 1 got %q, want resync", m.Type)
+	}
+}
+
+// The message ID goes into the hub's JSON object; anything else the hub
+// is handed still arrives as an object.
+func TestDeliverID(t *testing.T) {
+	s := newTestServer(t)
+	c := s.dial(t, "topics=global")
+	c.read()
+
+	tests := []struct {
+		data string
+		want string
+	}{
+		{`{"type":"a","data":1}`, `{"id":%d,"type":"a","data":1}`},
+		{` { "type":"a"}`, `{"id":%d,"type":"a"}`},
+		{`{}`, `{"id":%d}`},
+		{`{ }`, `{"id":%d}`},
+		{`[1,2]`, `{"id":%d,"data":[1,2]}`},
+		{`"text"`, `{"id":%d,"data":"text"}`},
+		{`not json`, `{"id":%d}`},
+		{``, `{"id":%d}`},
+	}
+	for i, tt := range tests {
+		id := uint64(1000 + i)
+		s.pub.deliver(hub.Delivery{ID: id, Data: []byte(tt.data)}, []string{hub.TopicGlobal})
+		got, _ := c.read()
+		if want := strings.Replace(tt.want, "%d", strconv.FormatUint(id, 10), 1); string(got) != want {
+			t.Errorf("%q sent as %s, want %s", tt.data, got, want)
+		}
+		if !json.Valid(got) {
+			t.Errorf("%q sent as invalid JSON %s", tt.data, got)
+		}
+	}
+}
+
+func TestTrade(t *testing.T) {
+	s := newTestServer(t)
+	c := s.dial(t, "topics=global&token="+token(t, 7, time.Now().Add(time.Hour)))
+	c.read()
+
+	c.send(`{"type":"buy","id":"c1","event_id":3,"data":{"outcome_id":1,"amount":50}}`)
+	_, m := c.read()
+	if m.Type != replyResult || string(m.ID) != `"c1"` {
+		t.Fatalf("got %+v, want the buy's result", m)
+	}
+	var result map[string]int
+	if err := json.Unmarshal(m.Data, &result); err != nil {
+		t.Fatal(err)
+	}
+	if result["user_id"] != 7 || result["event_id"] != 3 || result["amount"] != 50 {
+		t.Errorf("trade ran as %v, want user 7 on event 3 for 50", result)
+	}
+
+	for _, tt := range []struct{ msg, want string }{
+		{`{"type":"buy","id":"c2","event_id":3,"data":{"amount":-1}}`, "amount must be positive"},
+		{`{"type":"short","id":"c3"}`, "unknown message type"},
+		{`not json`, "invalid message"},
+	} {
+		c.send(tt.msg)
+		if _, m := c.read(); m.Type != replyError || m.Error != tt.want {
+			t.Errorf("%s: got %+v, want error %q", tt.msg, m, tt.want)
+		}
+	}
+
+	anon := s.dial(t, "topics=global")
+	anon.read()
+	anon.send(`{"type":"buy","id":"c1","event_id":3,"data":{"amount":50}}`)
+	if _, m := anon.read(); m.Type != replyError || m.Error != "unauthorized" {
+		t.Errorf("anonymous trade got %+v, want unauthorized", m)
+	}
+}
+
+// A session outlives its token, but can't trade once it has expired.
+func TestTradeTokenExpired(t *testing.T) {
+	s := newTestServer(t)
+	// Tokens expire on the second
+	expires := time.Now().Add(2 * time.Second).Truncate(time.Second)
+	c := s.dial(t, "topics=global&token="+token(t, 7, expires))
+	c.read()
+
+	time.Sleep(time.Until(expires) + 10*time.Millisecond)
+	c.send(`{"type":"buy","id":"c1","event_id":3,"data":{"amount":50}}`)
+	if _, m := c.read(); m.Type != replyError || m.Error != "token expired" {
+		t.Errorf("got %+v, want token expired", m)
+	}
+	// It still gets messages
+	s.hub.Broadcast("news", nil)
+	if _, m := c.read(); m.Type != "news" {
+		t.Errorf("got %+v, want news", m)
+	}
+}
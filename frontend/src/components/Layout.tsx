@@ -92,7 +92,8 @@ export default function Layout() {
         }
       },
       [refreshUser]
-    )
+    ),
+    ["global", "user"]
   );
 
   const handleLogout = () => {
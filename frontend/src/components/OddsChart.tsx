@@ -90,7 +90,8 @@ export default function OddsChart({ eventId, outcomes }: OddsChartProps) {
         }
       },
       [eventId, fetchHistory]
-    )
+    ),
+    [`event:${eventId}`]
   );
 
   if (snapshots === null) {
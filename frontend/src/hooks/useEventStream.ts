@@ -6,31 +6,80 @@ export interface SSEMessage {
     | "odds_updated"
     | "event_created"
     | "event_resolved"
+    | "event_closed"
     | "user_resolved"
     | "bingo_resolved"
     | "bingo_winner"
-    | "activity_new";
+    | "activity_new"
+    | "order_updated"
+    | "user_registered"
+    | "resync"
+    | "lagged";
   data?: Record<string, unknown>;
 }
 
 type Listener = (msg: SSEMessage) => void;
 
+/**
+ * Stream topics: "global" (market news, activity, bingo), "events" (every
+ * event's odds), `event:${id}` (one event), "user" (your own orders and
+ * payouts) and "admin".
+ */
+export type Topic = "global" | "events" | `event:${number}` | "user" | "admin";
+
 let globalSource: EventSource | null = null;
-let listeners = new Set<Listener>();
+// Each listener's topics; undefined means all of them
+let listeners = new Map<Listener, Topic[] | undefined>();
 let reconnectTimer: ReturnType<typeof setTimeout> | null = null;
+// The topics the open connection is subscribed to, as sent
+let connectedTopics: string | null = null;
+let resubscribeTimer: ReturnType<typeof setTimeout> | null = null;
+// ID of the last message received, so a new connection can pick up where
+// the old one left off
+let lastEventId = "";
+
+/** The union of the listeners' topics, or "" for all of them. */
+function wantedTopics(): string {
+  const topics = new Set<string>();
+  for (const t of listeners.values()) {
+    if (!t) return "";
+    t.forEach((topic) => topics.add(topic));
+  }
+  // The user topic needs a login
+  if (!localStorage.getItem("token")) topics.delete("user");
+  return [...topics].sort().join(",");
+}
 
 function connect() {
   if (globalSource) return;
 
   const token = localStorage.getItem("token");
-  const url = token ? `/api/stream?token=${encodeURIComponent(token)}` : "/api/stream";
-  const source = new EventSource(url);
+  const topics = wantedTopics();
+  const params = new URLSearchParams();
+  if (token) params.set("token", token);
+  if (topics) params.set("topics", topics);
+  if (lastEventId) params.set("last_event_id", lastEventId);
+  const query = params.toString();
+  const source = new EventSource(query ? `/api/stream?${query}` : "/api/stream");
   globalSource = source;
+  connectedTopics = topics;
 
   source.onmessage = (e) => {
+    if (e.lastEventId) lastEventId = e.lastEventId;
     try {
-      const msg: SSEMessage = JSON.parse(e.data);
-      listeners.forEach((fn) => fn(msg));
+      let msg: SSEMessage = JSON.parse(e.data);
+      if (msg.type === "lagged") {
+        // We fell behind and the server is closing the stream; reconnect
+        // right away to have the rest replayed
+        source.close();
+        globalSource = null;
+        connect();
+        return;
+      }
+      // Missed messages couldn't be replayed; refetch as on a fresh
+      // connection
+      if (msg.type === "resync") msg = { type: "connected" };
+      listeners.forEach((_, fn) => fn(msg));
     } catch {
       // ignore parse errors
     }
@@ -49,18 +98,16 @@ function connect() {
   };
 }
 
-// Reconnect when tab becomes visible again (catches missed events)
+// Reconnect when tab becomes visible again. The server replays what was
+// missed while hidden, or tells us to resync if it can't.
 if (typeof document !== "undefined") {
   document.addEventListener("visibilitychange", () => {
     if (document.visibilityState === "visible" && listeners.size > 0) {
-      // Force reconnect to get a fresh stream
       if (globalSource) {
         globalSource.close();
         globalSource = null;
       }
       connect();
-      // Notify listeners so pages can refetch stale data
-      listeners.forEach((fn) => fn({ type: "connected" }));
     }
   });
 }
@@ -76,12 +123,30 @@ function disconnect() {
   }
 }
 
+/**
+ * Reconnect if the listeners now want different topics. Batched, since
+ * pages mount and unmount several listeners at once; nothing is lost in
+ * between, as the new connection picks up after the last message.
+ */
+function resubscribe() {
+  if (resubscribeTimer) return;
+  resubscribeTimer = setTimeout(() => {
+    resubscribeTimer = null;
+    if (!globalSource || listeners.size === 0) return;
+    if (wantedTopics() === connectedTopics) return;
+    globalSource.close();
+    globalSource = null;
+    connect();
+  }, 0);
+}
+
 /**
  * Subscribe to the global SSE stream. The connection is shared
  * across all components and stays alive as long as at least one
- * subscriber exists.
+ * subscriber exists. It carries the topics every subscriber asked
+ * for, so onMessage may also see messages of other topics.
  */
-export function useEventStream(onMessage: Listener) {
+export function useEventStream(onMessage: Listener, topics?: Topic[]) {
   const callbackRef = useRef(onMessage);
   callbackRef.current = onMessage;
 
@@ -89,15 +154,20 @@ export function useEventStream(onMessage: Listener) {
     callbackRef.current(msg);
   }, []);
 
+  const topicsKey = topics?.join(",");
+
   useEffect(() => {
-    listeners.add(stableListener);
+    listeners.set(stableListener, topicsKey?.split(",") as Topic[] | undefined);
     connect();
+    resubscribe();
 
     return () => {
       listeners.delete(stableListener);
       if (listeners.size === 0) {
         disconnect();
+      } else {
+        resubscribe();
       }
     };
-  }, [stableListener]);
+  }, [stableListener, topicsKey]);
 }
@@ -65,7 +65,7 @@ export const getOddsHistory = (eventId: number) =>
 
 // Trading
 export const buyShares = (eventId: number, outcomeId: number, amount: number) =>
-  api<{ message: string; odds: import("./types").OutcomeOdds[]; balance: number }>(
+  api<{ message: string; shares: number; odds: import("./types").OutcomeOdds[]; balance: number }>(
     `/api/events/${eventId}/buy`,
     { method: "POST", body: JSON.stringify({ outcome_id: outcomeId, amount }) }
   );
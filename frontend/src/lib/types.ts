@@ -18,16 +18,38 @@ export interface Event {
   id: number;
   title: string;
   description: string;
-  event_type: "binary" | "multi";
+  event_type: "binary" | "multi" | "scalar";
+  pricing_model: "pool" | "lmsr";
+  liquidity?: number;
   status: "open" | "closed" | "resolved";
-  winning_outcome_id?: number;
+  resolution?: ResolutionWeight[];
+  voided?: boolean;
   created_at: string;
   resolved_at?: string;
+  closes_at?: string;
+  allow_hedging?: boolean;
+  rules: EventRules;
+  scalar?: { min: number; max: number };
+  resolved_value?: number;
+  expected_value?: number;
   last_trade_at?: string;
   odds: OutcomeOdds[];
   bettors: Record<number, string[]>;
 }
 
+export interface EventRules {
+  sell_payout: number;
+  win_bonus_rate: number;
+  win_bonus_flat: number;
+  bounty_points: number;
+  bounty_bettors: number;
+}
+
+export interface ResolutionWeight {
+  outcome_id: number;
+  weight: number;
+}
+
 export interface EventDetail extends Event {
   user_positions?: UserPosition[];
 }
@@ -39,6 +61,18 @@ export interface UserPosition {
   avg_price: number;
 }
 
+export interface Quote {
+  event_id: number;
+  outcome_id: number;
+  side: "buy" | "sell";
+  amount?: number;
+  shares: number;
+  points?: number;
+  avg_price: number;
+  odds: OutcomeOdds[];
+  potential_payout: number;
+}
+
 export interface LeaderboardEntry {
   rank: number;
   username: string;
@@ -52,6 +86,7 @@ export interface OddsSnapshot {
   outcome_id: number;
   odds: number;
   created_at: string;
+  expected_value?: number;
 }
 
 export interface HistoryEntry {
@@ -60,10 +95,42 @@ export interface HistoryEntry {
   event_title: string;
   outcome_id: number;
   outcome_label: string;
-  tx_type: "buy" | "sell" | "payout" | "bonus";
+  tx_type:
+    | "grant"
+    | "buy"
+    | "sell"
+    | "payout"
+    | "bonus"
+    | "bounty"
+    | "refund"
+    | "reversal"
+    | "admin_adjust"
+    | "order_filled"
+    | "order_cancelled"
+    | "order_expired";
   shares: number;
   points: number;
+  reason?: string;
+  created_at: string;
+  side?: "buy" | "sell";
+  limit_price?: number;
+}
+
+export interface Order {
+  id: number;
+  user_id: number;
+  event_id: number;
+  outcome_id: number;
+  side: "buy" | "sell";
+  limit_price: number;
+  amount?: number;
+  shares?: number;
+  status: "open" | "filled" | "cancelled" | "expired";
+  filled_shares?: number;
+  filled_points?: number;
+  expires_at?: string;
   created_at: string;
+  closed_at?: string;
 }
 
 export interface BingoEvent {
@@ -96,6 +163,7 @@ export interface PortfolioPosition {
   shares: number;
   avg_price: number;
   potential_payout: number;
+  hedged?: boolean;
 }
 
 export interface Portfolio {
@@ -103,6 +171,7 @@ export interface Portfolio {
   total_invested: number;
   total_potential: number;
   active_markets: number;
+  reserved_points: number;
 }
 
 export interface ActivityEntry {
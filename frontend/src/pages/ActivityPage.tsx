@@ -57,7 +57,8 @@ export default function ActivityPage() {
       if (msg.type === "connected") {
         getActivity().then(setEntries).catch(() => {});
       }
-    }, [])
+    }, []),
+    ["global"]
   );
 
   if (loading) {
@@ -1,4 +1,4 @@
-import { useState, useEffect } from "react";
+import { useState, useEffect, useCallback } from "react";
 import type { Event, BingoEvent } from "@/lib/types";
 import {
   getEvents,
@@ -17,6 +17,7 @@ import {
   unresolveEvent,
   unresolveBingoEvent,
 } from "@/lib/api";
+import { useEventStream } from "@/hooks/useEventStream";
 import { Button } from "@/components/ui/button";
 import { Input } from "@/components/ui/input";
 import { Label } from "@/components/ui/label";
@@ -111,6 +112,15 @@ export default function AdminPage() {
     fetchUsers();
   }, []);
 
+  useEventStream(
+    useCallback((msg) => {
+      if (msg.type === "user_registered") {
+        fetchUsers();
+      }
+    }, []),
+    ["admin"]
+  );
+
   const handleCreate = async () => {
     if (!title.trim()) {
       toast.error("Title is required");
@@ -119,7 +119,8 @@ export default function BingoPage() {
         }
       },
       [fetchData]
-    )
+    ),
+    ["global"]
   );
 
   const handleSquareChange = (position: number, update: Partial<BingoSquare>) => {
@@ -80,7 +80,8 @@ export default function EventDetailPage() {
         }
       },
       [id, fetchEvent]
-    )
+    ),
+    [`event:${Number(id)}`]
   );
 
   const handleTrade = async () => {
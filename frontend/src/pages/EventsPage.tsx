@@ -193,7 +193,8 @@ export default function EventsPage() {
         }
       },
       [fetchEvents]
-    )
+    ),
+    ["global", "events"]
   );
 
   const handleEventTypeChange = (value: string) => {
@@ -9,10 +9,18 @@ import { Skeleton } from "@/components/ui/skeleton";
 import { ScrollText } from "lucide-react";
 
 const txTypeConfig = {
+  grant: { label: "Starting balance", variant: "outline" as const },
   buy: { label: "Buy", variant: "default" as const },
   sell: { label: "Sell", variant: "secondary" as const },
   payout: { label: "Payout", variant: "outline" as const },
   bonus: { label: "Bonus", variant: "outline" as const },
+  bounty: { label: "Bounty", variant: "outline" as const },
+  refund: { label: "Refund", variant: "outline" as const },
+  reversal: { label: "Reversed", variant: "destructive" as const },
+  admin_adjust: { label: "Adjustment", variant: "secondary" as const },
+  order_filled: { label: "Order filled", variant: "secondary" as const },
+  order_cancelled: { label: "Order cancelled", variant: "outline" as const },
+  order_expired: { label: "Order expired", variant: "outline" as const },
 };
 
 export default function HistoryPage() {
@@ -72,21 +80,31 @@ export default function HistoryPage() {
                 const isPositive =
                   entry.tx_type === "sell" ||
                   entry.tx_type === "payout" ||
-                  entry.tx_type === "bonus";
+                  entry.tx_type === "bonus" ||
+                  entry.tx_type === "bounty" ||
+                  entry.tx_type === "refund" ||
+                  entry.tx_type === "grant" ||
+                  (entry.tx_type === "admin_adjust" && entry.points >= 0);
 
                 return (
                   <div
-                    key={entry.id}
+                    key={`${entry.tx_type}-${entry.id}`}
                     className="flex items-center justify-between rounded-lg border px-3 py-2.5"
                   >
                     <div className="min-w-0 flex-1">
                       <div className="flex items-center gap-2">
-                        <Link
-                          to={`/events/${entry.event_id}`}
-                          className="truncate font-medium hover:underline"
-                        >
-                          {entry.event_title}
-                        </Link>
+                        {entry.event_title ? (
+                          <Link
+                            to={`/events/${entry.event_id}`}
+                            className="truncate font-medium hover:underline"
+                          >
+                            {entry.event_title}
+                          </Link>
+                        ) : (
+                          <span className="truncate font-medium">
+                            {entry.reason ?? "Deleted event"}
+                          </span>
+                        )}
                         <Badge variant={config.variant} className="shrink-0">
                           {config.label}
                         </Badge>
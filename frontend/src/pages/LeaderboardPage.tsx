@@ -67,7 +67,8 @@ export default function LeaderboardPage() {
         }
       },
       [fetchLeaderboard]
-    )
+    ),
+    ["global", "events"]
   );
 
   if (loading) {
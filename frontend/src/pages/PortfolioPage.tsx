@@ -39,7 +39,8 @@ export default function PortfolioPage() {
         }
       },
       [fetchPortfolio]
-    )
+    ),
+    ["global", "events"]
   );
 
   if (loading) {